@@ -83,8 +83,17 @@ func (srv *Server) initAPI() {
 
 	// Host API Calls
 	if srv.host != nil {
-		srv.handleHTTPRequest(mux, "/host", srv.hostHandler)                  // GET, POST
-		srv.handleHTTPRequest(mux, "/host/announce", srv.hostAnnounceHandler) // POST
+		srv.handleHTTPRequest(mux, "/host", srv.hostHandler)                                            // GET, POST
+		srv.handleHTTPRequest(mux, "/host/announce", srv.hostAnnounceHandler)                           // POST
+		srv.handleHTTPRequest(mux, "/host/connections", srv.hostConnectionsHandler)                     // GET, POST
+		srv.handleHTTPRequest(mux, "/host/contracts", srv.hostContractsHandler)                         // GET
+		srv.handleHTTPRequest(mux, "/host/financials", srv.hostFinancialsHandler)                       // GET
+		srv.handleHTTPRequest(mux, "/host/pricing", srv.hostPricingHandler)                             // GET, POST
+		srv.handleHTTPRequest(mux, "/host/scrub", srv.hostScrubHandler)                                 // GET, POST
+		srv.handleHTTPRequest(mux, "/host/storage", srv.hostStorageHandler)                             // GET
+		srv.handleHTTPRequest(mux, "/host/storage/folders/add", srv.hostStorageFoldersAddHandler)       // POST
+		srv.handleHTTPRequest(mux, "/host/storage/folders/remove", srv.hostStorageFoldersRemoveHandler) // POST
+		srv.handleHTTPRequest(mux, "/host/storage/folders/resize", srv.hostStorageFoldersResizeHandler) // POST
 	}
 
 	// HostDB API Calls - DEPRECATED
@@ -93,6 +102,18 @@ func (srv *Server) initAPI() {
 		srv.handleHTTPRequest(mux, "/hostdb/hosts/all", srv.renterHostsAllHandler)
 	}
 
+	// HostDB API Calls
+	if srv.renter != nil {
+		srv.handleHTTPRequest(mux, "/hostdb/diversity", srv.hostdbDiversityHandler)    // GET, POST
+		srv.handleHTTPRequest(mux, "/hostdb/filter", srv.hostdbFilterHandler)          // GET, POST
+		srv.handleHTTPRequest(mux, "/hostdb/host", srv.hostdbHostHandler)              // GET
+		srv.handleHTTPRequest(mux, "/hostdb/host/rescan", srv.hostdbHostRescanHandler) // POST
+		srv.handleHTTPRequest(mux, "/hostdb/hosts", srv.hostdbHostsHandler)            // GET
+		srv.handleHTTPRequest(mux, "/hostdb/market", srv.hostdbMarketHandler)          // GET
+		srv.handleHTTPRequest(mux, "/hostdb/scanpolicy", srv.hostdbScanPolicyHandler)  // GET, POST
+		srv.handleHTTPRequest(mux, "/hostdb/score", srv.hostdbScoreHandler)            // GET
+	}
+
 	// Miner API Calls
 	if srv.miner != nil {
 		srv.handleHTTPRequest(mux, "/miner", srv.minerHandler)                            // GET
@@ -115,6 +136,8 @@ func (srv *Server) initAPI() {
 		srv.handleHTTPRequest(mux, "/renter/files/share", srv.renterFilesShareHandler)
 		srv.handleHTTPRequest(mux, "/renter/files/shareascii", srv.renterFilesShareAsciiHandler)
 		srv.handleHTTPRequest(mux, "/renter/files/upload", srv.renterFilesUploadHandler)
+		srv.handleHTTPRequest(mux, "/renter/files/versions", srv.renterFilesVersionsHandler)
+		srv.handleHTTPRequest(mux, "/renter/retention", srv.renterRetentionHandler) // GET, POST
 		srv.handleHTTPRequest(mux, "/renter/status", srv.renterStatusHandler)
 	}
 
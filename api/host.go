@@ -3,6 +3,8 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -12,36 +14,90 @@ type (
 	// HostGET contains the information that is returned after a GET request to
 	// /host.
 	HostGET struct {
-		Collateral   types.Currency     `json:"collateral"`
-		IPAddress    modules.NetAddress `json:"ipaddress"`
-		MaxDuration  types.BlockHeight  `json:"maxduration"`
-		MinDuration  types.BlockHeight  `json:"minduration"`
-		Price        types.Currency     `json:"price"`
-		TotalStorage int64              `json:"totalstorage"`
-		UnlockHash   types.UnlockHash   `json:"unlockhash"`
-		WindowSize   types.BlockHeight  `json:"windowsize"`
+		Collateral    types.Currency     `json:"collateral"`
+		DownloadPrice types.Currency     `json:"downloadprice"`
+		IPAddress     modules.NetAddress `json:"ipaddress"`
+		MaxDuration   types.BlockHeight  `json:"maxduration"`
+		MinDuration   types.BlockHeight  `json:"minduration"`
+		Price         types.Currency     `json:"price"`
+		TotalStorage  int64              `json:"totalstorage"`
+		UnlockHash    types.UnlockHash   `json:"unlockhash"`
+		WindowSize    types.BlockHeight  `json:"windowsize"`
 
+		CollateralBudget types.Currency `json:"collateralbudget"`
+		LockedCollateral types.Currency `json:"lockedcollateral"`
+		Maintenance      bool           `json:"maintenance"`
 		NumContracts     uint64         `json:"numcontracts"`
 		Revenue          types.Currency `json:"revenue"`
 		StorageRemaining int64          `json:"storageremaining"`
 		UpcomingRevenue  types.Currency `json:"upcomingrevenue"`
 	}
+
+	// HostConnectionsGET contains the information that is returned after a
+	// GET request to /host/connections.
+	HostConnectionsGET struct {
+		Limits  modules.HostConnectionLimits  `json:"limits"`
+		Metrics modules.HostConnectionMetrics `json:"metrics"`
+	}
+
+	// HostContractsGET contains the information that is returned after a GET
+	// request to /host/contracts.
+	HostContractsGET struct {
+		Contracts []modules.HostContract `json:"contracts"`
+	}
+
+	// HostFinancialsGET contains the information that is returned after a GET
+	// request to /host/financials.
+	HostFinancialsGET struct {
+		PotentialStorageRevenue   types.Currency                `json:"potentialstoragerevenue"`
+		PotentialBandwidthRevenue types.Currency                `json:"potentialbandwidthrevenue"`
+		LockedCollateral          types.Currency                `json:"lockedcollateral"`
+		Periods                   []modules.HostFinancialPeriod `json:"periods"`
+	}
+
+	// HostPricingGET contains the information that is returned after a GET
+	// request to /host/pricing.
+	HostPricingGET struct {
+		Enabled  bool           `json:"enabled"`
+		MinPrice types.Currency `json:"minprice"`
+		MaxPrice types.Currency `json:"maxprice"`
+		Price    types.Currency `json:"price"`
+	}
+
+	// HostScrubGET contains the information that is returned after a GET
+	// request to /host/scrub.
+	HostScrubGET struct {
+		Scrubbing        bool                          `json:"scrubbing"`
+		LastScrub        time.Time                     `json:"lastscrub"`
+		CorruptContracts []modules.HostCorruptContract `json:"corruptcontracts"`
+	}
+
+	// HostStorageGET contains the information that is returned after a GET
+	// request to /host/storage.
+	HostStorageGET struct {
+		Folders []modules.StorageFolderMetadata `json:"folders"`
+	}
 )
 
 // hostHandlerGET handles GET requests to the /host API endpoint.
 func (srv *Server) hostHandlerGET(w http.ResponseWriter, req *http.Request) {
 	settings := srv.host.Settings()
 	upcomingRevenue, revenue := srv.host.Revenue()
+	lockedCollateral, collateralBudget := srv.host.LockedCollateral()
 	hg := HostGET{
-		Collateral:   settings.Collateral,
-		IPAddress:    settings.IPAddress,
-		MaxDuration:  settings.MaxDuration,
-		MinDuration:  settings.MinDuration,
-		Price:        settings.Price,
-		TotalStorage: settings.TotalStorage,
-		UnlockHash:   settings.UnlockHash,
-		WindowSize:   settings.WindowSize,
+		Collateral:    settings.Collateral,
+		DownloadPrice: settings.DownloadPrice,
+		IPAddress:     settings.IPAddress,
+		MaxDuration:   settings.MaxDuration,
+		MinDuration:   settings.MinDuration,
+		Price:         settings.Price,
+		TotalStorage:  settings.TotalStorage,
+		UnlockHash:    settings.UnlockHash,
+		WindowSize:    settings.WindowSize,
 
+		CollateralBudget: collateralBudget,
+		LockedCollateral: lockedCollateral,
+		Maintenance:      srv.host.Maintenance(),
 		NumContracts:     srv.host.Contracts(),
 		Revenue:          revenue,
 		StorageRemaining: srv.host.Capacity(),
@@ -55,12 +111,13 @@ func (srv *Server) hostHandlerPOST(w http.ResponseWriter, req *http.Request) {
 	// Map each query string to a field in the host settings.
 	settings := srv.host.Settings()
 	qsVars := map[string]interface{}{
-		"collateral":   &settings.Collateral,
-		"maxduration":  &settings.MaxDuration,
-		"minduration":  &settings.MinDuration,
-		"price":        &settings.Price,
-		"totalstorage": &settings.TotalStorage,
-		"windowsize":   &settings.WindowSize,
+		"collateral":    &settings.Collateral,
+		"downloadprice": &settings.DownloadPrice,
+		"maxduration":   &settings.MaxDuration,
+		"minduration":   &settings.MinDuration,
+		"price":         &settings.Price,
+		"totalstorage":  &settings.TotalStorage,
+		"windowsize":    &settings.WindowSize,
 	}
 
 	// Iterate through the query string and replace any fields that have been
@@ -74,7 +131,32 @@ func (srv *Server) hostHandlerPOST(w http.ResponseWriter, req *http.Request) {
 			}
 		}
 	}
+	// The collateral budget and maintenance mode are not part of the
+	// advertised settings.
+	var collateralBudget types.Currency
+	if req.FormValue("collateralbudget") != "" {
+		_, err := fmt.Sscan(req.FormValue("collateralbudget"), &collateralBudget)
+		if err != nil {
+			writeError(w, "Malformed collateralbudget", http.StatusBadRequest)
+			return
+		}
+	}
+	var maintenance bool
+	if req.FormValue("maintenance") != "" {
+		var err error
+		maintenance, err = strconv.ParseBool(req.FormValue("maintenance"))
+		if err != nil {
+			writeError(w, "Malformed maintenance", http.StatusBadRequest)
+			return
+		}
+	}
 	srv.host.SetSettings(settings)
+	if req.FormValue("collateralbudget") != "" {
+		srv.host.SetCollateralBudget(collateralBudget)
+	}
+	if req.FormValue("maintenance") != "" {
+		srv.host.SetMaintenance(maintenance)
+	}
 	writeSuccess(w)
 }
 
@@ -114,3 +196,220 @@ func (srv *Server) hostAnnounceHandler(w http.ResponseWriter, req *http.Request)
 		writeError(w, "unrecognized method when calling /host/announce", http.StatusBadRequest)
 	}
 }
+
+// hostConnectionsHandlerPOST handles the API call that sets the host's
+// connection limits.
+func (srv *Server) hostConnectionsHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	limits := srv.host.ConnectionLimits()
+	qsVars := map[string]*int{
+		"maxconnections":      &limits.MaxConnections,
+		"maxconnectionsperip": &limits.MaxConnectionsPerIP,
+		"maxrpcsperminute":    &limits.MaxRPCsPerMinute,
+	}
+	for qs := range qsVars {
+		if req.FormValue(qs) != "" { // skip empty values
+			_, err := fmt.Sscan(req.FormValue(qs), qsVars[qs])
+			if err != nil || *qsVars[qs] < 0 {
+				writeError(w, "Malformed "+qs, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	srv.host.SetConnectionLimits(limits)
+	writeSuccess(w)
+}
+
+// hostConnectionsHandler handles the API calls that report and set the host's
+// connection limits.
+func (srv *Server) hostConnectionsHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "" || req.Method == "GET" {
+		writeJSON(w, HostConnectionsGET{
+			Limits:  srv.host.ConnectionLimits(),
+			Metrics: srv.host.ConnectionMetrics(),
+		})
+	} else if req.Method == "POST" {
+		srv.hostConnectionsHandlerPOST(w, req)
+	} else {
+		writeError(w, "unrecognized method when calling /host/connections", http.StatusBadRequest)
+	}
+}
+
+// hostContractsHandler handles the API call that lists the host's file
+// contract obligations, optionally filtered by proof status.
+func (srv *Server) hostContractsHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "" && req.Method != "GET" {
+		writeError(w, "unrecognized method when calling /host/contracts", http.StatusBadRequest)
+		return
+	}
+	status := req.FormValue("status")
+	switch status {
+	case "", modules.HostContractActive, modules.HostContractProving, modules.HostContractSubmitted,
+		modules.HostContractConfirmed, modules.HostContractExpired:
+	default:
+		writeError(w, "unrecognized contract status "+status, http.StatusBadRequest)
+		return
+	}
+	contracts := []modules.HostContract{}
+	for _, hc := range srv.host.ContractObligations() {
+		if status == "" || hc.ProofStatus == status {
+			contracts = append(contracts, hc)
+		}
+	}
+	writeJSON(w, HostContractsGET{Contracts: contracts})
+}
+
+// hostFinancialsHandler handles the API call that reports the host's revenue
+// in each accounting period.
+func (srv *Server) hostFinancialsHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "" && req.Method != "GET" {
+		writeError(w, "unrecognized method when calling /host/financials", http.StatusBadRequest)
+		return
+	}
+	fin := srv.host.Financials()
+	writeJSON(w, HostFinancialsGET{
+		PotentialStorageRevenue:   fin.PotentialStorageRevenue,
+		PotentialBandwidthRevenue: fin.PotentialBandwidthRevenue,
+		LockedCollateral:          fin.LockedCollateral,
+		Periods:                   fin.Periods,
+	})
+}
+
+// hostPricingHandlerPOST handles the API call that sets the host's pricing
+// policy.
+func (srv *Server) hostPricingHandlerPOST(w http.ResponseWriter, req *http.Request) {
+	policy := srv.host.PricingPolicy()
+	if req.FormValue("enabled") != "" {
+		var err error
+		policy.Enabled, err = strconv.ParseBool(req.FormValue("enabled"))
+		if err != nil {
+			writeError(w, "Malformed enabled", http.StatusBadRequest)
+			return
+		}
+	}
+	qsVars := map[string]*types.Currency{
+		"minprice": &policy.MinPrice,
+		"maxprice": &policy.MaxPrice,
+	}
+	for qs := range qsVars {
+		if req.FormValue(qs) != "" { // skip empty values
+			_, err := fmt.Sscan(req.FormValue(qs), qsVars[qs])
+			if err != nil {
+				writeError(w, "Malformed "+qs, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	err := srv.host.SetPricingPolicy(policy)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostPricingHandler handles the API calls that report and set the host's
+// pricing policy.
+func (srv *Server) hostPricingHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "" || req.Method == "GET" {
+		policy := srv.host.PricingPolicy()
+		writeJSON(w, HostPricingGET{
+			Enabled:  policy.Enabled,
+			MinPrice: policy.MinPrice,
+			MaxPrice: policy.MaxPrice,
+			Price:    srv.host.Settings().Price,
+		})
+	} else if req.Method == "POST" {
+		srv.hostPricingHandlerPOST(w, req)
+	} else {
+		writeError(w, "unrecognized method when calling /host/pricing", http.StatusBadRequest)
+	}
+}
+
+// hostScrubHandler handles the API calls that report and start the host's
+// checks of the integrity of its contract data.
+func (srv *Server) hostScrubHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "" || req.Method == "GET" {
+		status := srv.host.ScrubStatus()
+		writeJSON(w, HostScrubGET{
+			Scrubbing:        status.Scrubbing,
+			LastScrub:        status.LastScrub,
+			CorruptContracts: status.CorruptContracts,
+		})
+	} else if req.Method == "POST" {
+		err := srv.host.Scrub()
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeSuccess(w)
+	} else {
+		writeError(w, "unrecognized method when calling /host/scrub", http.StatusBadRequest)
+	}
+}
+
+// hostStorageHandler handles the API call that lists the host's storage
+// folders.
+func (srv *Server) hostStorageHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "" || req.Method == "GET" {
+		writeJSON(w, HostStorageGET{Folders: srv.host.StorageFolders()})
+	} else {
+		writeError(w, "unrecognized method when calling /host/storage", http.StatusBadRequest)
+	}
+}
+
+// hostStorageFoldersAddHandler handles the API call that adds a storage
+// folder to the host.
+func (srv *Server) hostStorageFoldersAddHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		writeError(w, "unrecognized method when calling /host/storage/folders/add", http.StatusBadRequest)
+		return
+	}
+	var size int64
+	_, err := fmt.Sscan(req.FormValue("size"), &size)
+	if err != nil {
+		writeError(w, "Malformed size", http.StatusBadRequest)
+		return
+	}
+	err = srv.host.AddStorageFolder(req.FormValue("path"), size)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostStorageFoldersRemoveHandler handles the API call that removes a storage
+// folder from the host.
+func (srv *Server) hostStorageFoldersRemoveHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		writeError(w, "unrecognized method when calling /host/storage/folders/remove", http.StatusBadRequest)
+		return
+	}
+	err := srv.host.RemoveStorageFolder(req.FormValue("path"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostStorageFoldersResizeHandler handles the API call that resizes one of
+// the host's storage folders.
+func (srv *Server) hostStorageFoldersResizeHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		writeError(w, "unrecognized method when calling /host/storage/folders/resize", http.StatusBadRequest)
+		return
+	}
+	var size int64
+	_, err := fmt.Sscan(req.FormValue("newsize"), &size)
+	if err != nil {
+		writeError(w, "Malformed newsize", http.StatusBadRequest)
+		return
+	}
+	err = srv.host.ResizeStorageFolder(req.FormValue("path"), size)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
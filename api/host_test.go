@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/url"
 	"path/filepath"
@@ -85,3 +86,240 @@ func TestIntegrationHosting(t *testing.T) {
 		t.Fatalf("host's profit was not affected: expected %v, got %v", expRevenue, hg.Revenue)
 	}
 }
+
+// TestIntegrationHostStorage tests the calls that manage the host's storage
+// folders.
+func TestIntegrationHostStorage(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostStorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hsg HostStorageGET
+	err = st.getAPI("/host/storage", &hsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hsg.Folders) != 1 {
+		t.Fatal("host should start with one storage folder")
+	}
+
+	// Add, resize, and remove a folder.
+	dir := filepath.Join(st.dir, "folder")
+	err = st.stdPostAPI("/host/storage/folders/add", url.Values{"path": {dir}, "size": {"1000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.stdPostAPI("/host/storage/folders/resize", url.Values{"path": {dir}, "newsize": {"2000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.getAPI("/host/storage", &hsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hsg.Folders) != 2 || hsg.Folders[1].Path != dir || hsg.Folders[1].Capacity != 2000 {
+		t.Fatal("storage folder was not added and resized:", hsg.Folders)
+	}
+	var hg HostGET
+	err = st.getAPI("/host", &hg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hg.TotalStorage != hsg.Folders[0].Capacity+2000 {
+		t.Fatal("total storage does not include the new folder")
+	}
+	err = st.stdPostAPI("/host/storage/folders/remove", url.Values{"path": {dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.getAPI("/host/storage", &hsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hsg.Folders) != 1 {
+		t.Fatal("storage folder was not removed")
+	}
+
+	// Removing an unknown folder is an error.
+	err = st.stdPostAPI("/host/storage/folders/remove", url.Values{"path": {dir}})
+	if err == nil {
+		t.Fatal("expected an error when removing an unknown folder")
+	}
+}
+
+// TestIntegrationHostContracts tests the call that lists the host's file
+// contracts.
+func TestIntegrationHostContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostContracts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hcg HostContractsGET
+	err = st.getAPI("/host/contracts", &hcg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hcg.Contracts == nil || len(hcg.Contracts) != 0 {
+		t.Fatal("expected an empty list of contracts, got", hcg.Contracts)
+	}
+	err = st.getAPI("/host/contracts?status=proving", &hcg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.getAPI("/host/contracts?status=bogus", &hcg)
+	if err == nil {
+		t.Fatal("expected an error for an unknown status")
+	}
+}
+
+// TestIntegrationHostFinancials tests the call that reports the host's
+// revenue.
+func TestIntegrationHostFinancials(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostFinancials")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hfg HostFinancialsGET
+	err = st.getAPI("/host/financials", &hfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hfg.PotentialStorageRevenue.IsZero() || !hfg.LockedCollateral.IsZero() || len(hfg.Periods) != 0 {
+		t.Fatal("new host should have no revenue:", hfg)
+	}
+}
+
+// TestIntegrationHostScrub checks that the host's data can be scrubbed
+// through the API.
+func TestIntegrationHostScrub(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostScrub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = st.stdPostAPI("/host/scrub", url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hsg HostScrubGET
+	for i := 0; i < 50; i++ {
+		err = st.getAPI("/host/scrub", &hsg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hsg.LastScrub.IsZero() {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if hsg.Scrubbing || hsg.LastScrub.IsZero() {
+		t.Fatal("scrub did not finish:", hsg)
+	}
+	if len(hsg.CorruptContracts) != 0 {
+		t.Fatal("new host should have no corrupt contracts:", hsg.CorruptContracts)
+	}
+}
+
+// TestIntegrationHostMaintenance checks that the host can be put in and taken
+// out of maintenance mode through the API.
+func TestIntegrationHostMaintenance(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostMaintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, maintenance := range []bool{true, false} {
+		err = st.stdPostAPI("/host", url.Values{"maintenance": {fmt.Sprint(maintenance)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hg HostGET
+		err = st.getAPI("/host", &hg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hg.Maintenance != maintenance {
+			t.Fatalf("expected maintenance %v, got %v", maintenance, hg.Maintenance)
+		}
+	}
+	if err := st.stdPostAPI("/host", url.Values{"maintenance": {"sometimes"}}); err == nil {
+		t.Fatal("malformed maintenance mode was accepted")
+	}
+}
+
+// TestIntegrationHostConnections checks that the host's connection limits can
+// be viewed and set through the API.
+func TestIntegrationHostConnections(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostConnections")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = st.stdPostAPI("/host/connections", url.Values{"maxconnectionsperip": {"3"}, "maxrpcsperminute": {"0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hcg HostConnectionsGET
+	err = st.getAPI("/host/connections", &hcg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hcg.Limits.MaxConnectionsPerIP != 3 || hcg.Limits.MaxRPCsPerMinute != 0 || hcg.Limits.MaxConnections == 0 {
+		t.Fatal("connection limits were not set:", hcg.Limits)
+	}
+	if err := st.stdPostAPI("/host/connections", url.Values{"maxconnections": {"-1"}}); err == nil {
+		t.Fatal("negative connection limit was accepted")
+	}
+}
+
+// TestIntegrationHostPricing checks that the host's pricing policy can be
+// viewed and set through the API.
+func TestIntegrationHostPricing(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostPricing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = st.stdPostAPI("/host/pricing", url.Values{"enabled": {"true"}, "minprice": {"1000"}, "maxprice": {"2000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hpg HostPricingGET
+	err = st.getAPI("/host/pricing", &hpg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hpg.Enabled || hpg.MinPrice.Cmp(types.NewCurrency64(1000)) != 0 || hpg.MaxPrice.Cmp(types.NewCurrency64(2000)) != 0 {
+		t.Fatal("pricing policy was not set:", hpg)
+	}
+	if hpg.Price.Cmp(hpg.MinPrice) < 0 || hpg.Price.Cmp(hpg.MaxPrice) > 0 {
+		t.Fatal("price is out of bounds:", hpg.Price)
+	}
+	if err := st.stdPostAPI("/host/pricing", url.Values{"minprice": {"3000"}}); err == nil {
+		t.Fatal("minimum price above the maximum was accepted")
+	}
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// HostdbFilterGET contains the host filter of the hostdb.
+type HostdbFilterGET struct {
+	Mode  string               `json:"mode"`
+	Hosts []modules.NetAddress `json:"hosts"`
+}
+
+// HostdbHostsGET lists hosts known to the hostdb.
+type HostdbHostsGET struct {
+	Hosts []modules.HostDBEntry `json:"hosts"`
+}
+
+// hostsByPrice sorts hosts by price, cheapest first.
+type hostsByPrice []modules.HostDBEntry
+
+func (hs hostsByPrice) Len() int           { return len(hs) }
+func (hs hostsByPrice) Less(i, j int) bool { return hs[i].Price.Cmp(hs[j].Price) < 0 }
+func (hs hostsByPrice) Swap(i, j int)      { hs[i], hs[j] = hs[j], hs[i] }
+
+// hostsByScore sorts hosts by score, best first.
+type hostsByScore []modules.HostDBEntry
+
+func (hs hostsByScore) Len() int           { return len(hs) }
+func (hs hostsByScore) Less(i, j int) bool { return hs[i].Score.Score.Cmp(hs[j].Score.Score) > 0 }
+func (hs hostsByScore) Swap(i, j int)      { hs[i], hs[j] = hs[j], hs[i] }
+
+// hostdbHostsHandler handles the API call to list hosts, with optional
+// filtering and sorting.
+func (srv *Server) hostdbHostsHandler(w http.ResponseWriter, req *http.Request) {
+	// Parse the filters.
+	activeOnly := req.FormValue("active") == "true"
+	var maxPrice types.Currency
+	if req.FormValue("maxprice") != "" {
+		_, err := fmt.Sscan(req.FormValue("maxprice"), &maxPrice)
+		if err != nil {
+			writeError(w, "Couldn't parse maxprice: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var minScore types.Currency
+	if req.FormValue("minscore") != "" {
+		_, err := fmt.Sscan(req.FormValue("minscore"), &minScore)
+		if err != nil {
+			writeError(w, "Couldn't parse minscore: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var limit int
+	if req.FormValue("limit") != "" {
+		_, err := fmt.Sscan(req.FormValue("limit"), &limit)
+		if err != nil {
+			writeError(w, "Couldn't parse limit: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	hosts := make([]modules.HostDBEntry, 0)
+	for _, host := range srv.renter.Hosts() {
+		if activeOnly && !host.Active {
+			continue
+		}
+		if req.FormValue("maxprice") != "" && host.Price.Cmp(maxPrice) > 0 {
+			continue
+		}
+		if host.Score.Score.Cmp(minScore) < 0 {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+
+	// Sort the hosts.
+	var sorter sort.Interface
+	switch req.FormValue("sort") {
+	case "", "score":
+		sorter = hostsByScore(hosts)
+	case "price":
+		sorter = hostsByPrice(hosts)
+	default:
+		writeError(w, "Unrecognized sort: "+req.FormValue("sort"), http.StatusBadRequest)
+		return
+	}
+	if req.FormValue("reverse") == "true" {
+		sorter = sort.Reverse(sorter)
+	}
+	sort.Sort(sorter)
+
+	if limit > 0 && limit < len(hosts) {
+		hosts = hosts[:limit]
+	}
+	writeJSON(w, HostdbHostsGET{Hosts: hosts})
+}
+
+// hostdbHostHandler handles the API call to view a single host in detail.
+func (srv *Server) hostdbHostHandler(w http.ResponseWriter, req *http.Request) {
+	host, err := srv.renter.Host(modules.NetAddress(req.FormValue("address")))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, host)
+}
+
+// hostdbHostRescanHandler handles the API call to scan a host immediately.
+func (srv *Server) hostdbHostRescanHandler(w http.ResponseWriter, req *http.Request) {
+	err := srv.renter.RescanHost(modules.NetAddress(req.FormValue("address")))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostdbDiversityHandler handles the API calls to view and change the subnet
+// sizes used to keep the hosts of a chunk on different networks.
+func (srv *Server) hostdbDiversityHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "" || req.Method == "GET" {
+		writeJSON(w, srv.renter.HostDiversity())
+		return
+	} else if req.Method != "POST" {
+		writeError(w, "unrecognized method when calling /hostdb/diversity", http.StatusBadRequest)
+		return
+	}
+
+	hd := srv.renter.HostDiversity()
+	if req.FormValue("ipv4subnetbits") != "" {
+		_, err := fmt.Sscan(req.FormValue("ipv4subnetbits"), &hd.IPv4SubnetBits)
+		if err != nil {
+			writeError(w, "Couldn't parse ipv4subnetbits: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.FormValue("ipv6subnetbits") != "" {
+		_, err := fmt.Sscan(req.FormValue("ipv6subnetbits"), &hd.IPv6SubnetBits)
+		if err != nil {
+			writeError(w, "Couldn't parse ipv6subnetbits: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	err := srv.renter.SetHostDiversity(hd)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostdbFilterHandler handles the API calls to view and change the host
+// filter, which determines which hosts may be selected for uploads.
+func (srv *Server) hostdbFilterHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "" || req.Method == "GET" {
+		mode, hosts := srv.renter.HostFilter()
+		writeJSON(w, HostdbFilterGET{
+			Mode:  mode.String(),
+			Hosts: hosts,
+		})
+		return
+	} else if req.Method != "POST" {
+		writeError(w, "unrecognized method when calling /hostdb/filter", http.StatusBadRequest)
+		return
+	}
+
+	mode, err := modules.ParseHostFilterMode(req.FormValue("mode"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var hosts []modules.NetAddress
+	for _, addr := range strings.Split(req.FormValue("hosts"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			hosts = append(hosts, modules.NetAddress(addr))
+		}
+	}
+	err = srv.renter.SetHostFilter(mode, hosts)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostdbMarketHandler handles the API call that summarizes the settings of the
+// active hosts.
+func (srv *Server) hostdbMarketHandler(w http.ResponseWriter, req *http.Request) {
+	var since types.BlockHeight
+	if req.FormValue("since") != "" {
+		_, err := fmt.Sscan(req.FormValue("since"), &since)
+		if err != nil {
+			writeError(w, "Couldn't parse since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	market := srv.renter.HostMarket()
+	history := make([]modules.HostMarketStats, 0, len(market.History))
+	for _, stats := range market.History {
+		if stats.Height >= since {
+			history = append(history, stats)
+		}
+	}
+	market.History = history
+	writeJSON(w, market)
+}
+
+// hostdbScanPolicyHandler handles the API calls to view and change the policy
+// used to scan hosts. Durations are given in Go's duration format, e.g. "90m".
+func (srv *Server) hostdbScanPolicyHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "" || req.Method == "GET" {
+		writeJSON(w, srv.renter.HostScanPolicy())
+		return
+	} else if req.Method != "POST" {
+		writeError(w, "unrecognized method when calling /hostdb/scanpolicy", http.StatusBadRequest)
+		return
+	}
+
+	sp := srv.renter.HostScanPolicy()
+	durations := map[string]*time.Duration{
+		"minscaninterval": &sp.MinScanInterval,
+		"maxscaninterval": &sp.MaxScanInterval,
+		"requesttimeout":  &sp.RequestTimeout,
+		"maxscanbackoff":  &sp.MaxScanBackoff,
+	}
+	for param, d := range durations {
+		if req.FormValue(param) == "" {
+			continue
+		}
+		var err error
+		*d, err = time.ParseDuration(req.FormValue(param))
+		if err != nil {
+			writeError(w, "Couldn't parse "+param+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	ints := map[string]*int{
+		"scanthreads":          &sp.ScanThreads,
+		"maxactivehosts":       &sp.MaxActiveHosts,
+		"inactivehostcheckups": &sp.InactiveHostCheckups,
+	}
+	for param, n := range ints {
+		if req.FormValue(param) == "" {
+			continue
+		}
+		_, err := fmt.Sscan(req.FormValue(param), n)
+		if err != nil {
+			writeError(w, "Couldn't parse "+param+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	currencies := map[string]*types.Currency{
+		"maxreliability":     &sp.MaxReliability,
+		"unreachablepenalty": &sp.UnreachablePenalty,
+	}
+	for param, c := range currencies {
+		if req.FormValue(param) == "" {
+			continue
+		}
+		_, err := fmt.Sscan(req.FormValue(param), c)
+		if err != nil {
+			writeError(w, "Couldn't parse "+param+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	err := srv.renter.SetHostScanPolicy(sp)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
+// hostdbScoreHandler handles the API call that explains the score of a host.
+func (srv *Server) hostdbScoreHandler(w http.ResponseWriter, req *http.Request) {
+	sb, err := srv.renter.HostScore(modules.NetAddress(req.FormValue("address")))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, sb)
+}
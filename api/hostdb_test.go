@@ -0,0 +1,215 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestIntegrationHostDBFilter checks that the host filter can be viewed and
+// changed through the API.
+func TestIntegrationHostDBFilter(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostDBFilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hf HostdbFilterGET
+	err = st.getAPI("/hostdb/filter", &hf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hf.Mode != "disable" || len(hf.Hosts) != 0 {
+		t.Fatal("unexpected default filter:", hf)
+	}
+
+	values := url.Values{}
+	values.Set("mode", "blacklist")
+	values.Set("hosts", "foo.com:1234, bar.com:1234")
+	err = st.stdPostAPI("/hostdb/filter", values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.getAPI("/hostdb/filter", &hf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hf.Mode != "blacklist" || len(hf.Hosts) != 2 {
+		t.Fatal("filter was not updated:", hf)
+	}
+
+	values.Set("mode", "graylist")
+	err = st.stdPostAPI("/hostdb/filter", values)
+	if err == nil {
+		t.Fatal("expected an error for an unknown filter mode")
+	}
+}
+
+// TestIntegrationHostDBHosts checks the calls for listing, viewing, and
+// rescanning hosts.
+func TestIntegrationHostDBHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostDBHosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Announce the host and wait for the hostdb to scan it.
+	err = st.stdPostAPI("/host/announce", url.Values{"address": {string(st.host.NetAddress())}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.miner.AddBlock()
+	var hosts HostdbHostsGET
+	for i := 0; i < 50; i++ {
+		err = st.getAPI("/hostdb/hosts?active=true", &hosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hosts.Hosts) != 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(hosts.Hosts) != 1 {
+		t.Fatal("expected 1 active host, got", len(hosts.Hosts))
+	}
+	if st.stdGetAPI("/hostdb/hosts?sort=foo") == nil {
+		t.Fatal("expected an error for an unknown sort")
+	}
+	var filtered HostdbHostsGET
+	score := hosts.Hosts[0].Score.Score
+	err = st.getAPI("/hostdb/hosts?active=true&minscore="+score.String(), &filtered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered.Hosts) != 1 {
+		t.Fatal("host with the minimum score was excluded")
+	}
+	err = st.getAPI("/hostdb/hosts?active=true&minscore="+score.Add(types.NewCurrency64(1)).String(), &filtered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered.Hosts) != 0 {
+		t.Fatal("host below the minimum score was listed")
+	}
+	if st.stdGetAPI("/hostdb/hosts?minscore=foo") == nil {
+		t.Fatal("expected an error for an invalid minscore")
+	}
+
+	// View the host in detail, then rescan it.
+	addr := string(hosts.Hosts[0].IPAddress)
+	var host modules.HostDBEntry
+	err = st.getAPI("/hostdb/host?address="+addr, &host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !host.Active || len(host.History) == 0 || host.Uptime != 1 {
+		t.Fatal("unexpected host details:", host)
+	}
+	err = st.stdPostAPI("/hostdb/host/rescan", url.Values{"address": {addr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.stdPostAPI("/hostdb/host/rescan", url.Values{"address": {"foo.com:1234"}})
+	if err == nil {
+		t.Fatal("expected an error when rescanning an unknown host")
+	}
+}
+
+// TestIntegrationHostDBScanPolicy checks that the scan policy can be viewed
+// and changed through the API.
+func TestIntegrationHostDBScanPolicy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostDBScanPolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sp modules.HostScanPolicy
+	err = st.getAPI("/hostdb/scanpolicy", &sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp.ScanThreads == 0 || sp.RequestTimeout == 0 {
+		t.Fatal("unexpected default scan policy:", sp)
+	}
+
+	values := url.Values{}
+	values.Set("requesttimeout", "12s")
+	values.Set("scanthreads", "7")
+	values.Set("maxreliability", "300")
+	err = st.stdPostAPI("/hostdb/scanpolicy", values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.getAPI("/hostdb/scanpolicy", &sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp.RequestTimeout != 12*time.Second || sp.ScanThreads != 7 || sp.MaxReliability.Cmp(types.NewCurrency64(300)) != 0 {
+		t.Fatal("scan policy was not updated:", sp)
+	}
+
+	values = url.Values{}
+	values.Set("maxscaninterval", "1s")
+	err = st.stdPostAPI("/hostdb/scanpolicy", values)
+	if err == nil {
+		t.Fatal("expected an error for a max scan interval below the minimum")
+	}
+}
+
+// TestIntegrationHostDBMarket checks that the host market is sampled as
+// blocks are mined.
+func TestIntegrationHostDBMarket(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createServerTester("TestIntegrationHostDBMarket")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var market modules.HostMarket
+	err = st.getAPI("/hostdb/market", &market)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startSamples := len(market.History)
+
+	// Mine enough blocks for at least one more sample to be taken.
+	for i := 0; i < 10; i++ {
+		_, err = st.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = st.getAPI("/hostdb/market", &market)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(market.History) <= startSamples {
+		t.Fatal("market was not sampled while mining")
+	}
+	last := market.History[len(market.History)-1]
+
+	// Samples before 'since' are excluded.
+	err = st.getAPI(fmt.Sprintf("/hostdb/market?since=%d", last.Height), &market)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(market.History) != 1 || market.History[0].Height != last.Height {
+		t.Fatal("since did not filter the market history:", market.History)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -18,6 +19,11 @@ type FileInfo struct {
 	modules.FileInfo
 }
 
+// RenterFilesVersionsResponse lists every version of a file.
+type RenterFilesVersionsResponse struct {
+	Versions []modules.FileVersionInfo
+}
+
 // LoadedFiles lists files that were loaded into the renter.
 type RenterFilesLoadResponse struct {
 	FilesAdded []string
@@ -49,7 +55,18 @@ func (srv *Server) renterHostsAllHandler(w http.ResponseWriter, req *http.Reques
 
 // renterFilesDownloadHandler handles the API call to download a file.
 func (srv *Server) renterFilesDownloadHandler(w http.ResponseWriter, req *http.Request) {
-	err := srv.renter.Download(req.FormValue("nickname"), req.FormValue("destination"))
+	var err error
+	if req.FormValue("version") != "" {
+		var version uint64
+		_, err = fmt.Sscan(req.FormValue("version"), &version)
+		if err != nil {
+			writeError(w, "Couldn't parse version: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = srv.renter.DownloadVersion(req.FormValue("nickname"), version, req.FormValue("destination"))
+	} else {
+		err = srv.renter.Download(req.FormValue("nickname"), req.FormValue("destination"))
+	}
 	if err != nil {
 		writeError(w, "Download failed: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -81,6 +98,51 @@ func (srv *Server) renterFilesListHandler(w http.ResponseWriter, req *http.Reque
 	writeJSON(w, fileSet)
 }
 
+// renterFilesVersionsHandler handles the API call to list the versions of a
+// file.
+func (srv *Server) renterFilesVersionsHandler(w http.ResponseWriter, req *http.Request) {
+	versions, err := srv.renter.FileVersions(req.FormValue("nickname"))
+	if err != nil {
+		writeError(w, "Couldn't list versions: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, RenterFilesVersionsResponse{Versions: versions})
+}
+
+// renterRetentionHandler handles the API calls to view and change the
+// retention policy for prior file versions.
+func (srv *Server) renterRetentionHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "" || req.Method == "GET" {
+		writeJSON(w, srv.renter.RetentionPolicy())
+		return
+	} else if req.Method != "POST" {
+		writeError(w, "unrecognized method when calling /renter/retention", http.StatusBadRequest)
+		return
+	}
+
+	rp := srv.renter.RetentionPolicy()
+	if req.FormValue("versions") != "" {
+		_, err := fmt.Sscan(req.FormValue("versions"), &rp.Versions)
+		if err != nil {
+			writeError(w, "Couldn't parse versions: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.FormValue("blocks") != "" {
+		_, err := fmt.Sscan(req.FormValue("blocks"), &rp.Blocks)
+		if err != nil {
+			writeError(w, "Couldn't parse blocks: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	err := srv.renter.SetRetentionPolicy(rp)
+	if err != nil {
+		writeError(w, "Couldn't set retention policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSuccess(w)
+}
+
 // renterFilesDeleteHander handles the API call to delete a file entry from the
 // renter.
 func (srv *Server) renterFilesDeleteHandler(w http.ResponseWriter, req *http.Request) {
@@ -172,13 +234,49 @@ func (srv *Server) renterFilesUploadHandler(w http.ResponseWriter, req *http.Req
 			return
 		}
 	}
+	var cipherType crypto.CipherType
+	switch req.FormValue("cipher") {
+	case "":
+		// let the renter decide
+	case crypto.TypeTwofish.String():
+		cipherType = crypto.TypeTwofish
+	case crypto.TypeXChaCha20.String():
+		cipherType = crypto.TypeXChaCha20
+	default:
+		writeError(w, "Unrecognized cipher: "+req.FormValue("cipher"), http.StatusBadRequest)
+		return
+	}
+	var dataPieces, parityPieces int
+	if req.FormValue("datapieces") != "" {
+		_, err := fmt.Sscan(req.FormValue("datapieces"), &dataPieces)
+		if err != nil {
+			writeError(w, "Couldn't parse datapieces: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.FormValue("paritypieces") != "" {
+		_, err := fmt.Sscan(req.FormValue("paritypieces"), &parityPieces)
+		if err != nil {
+			writeError(w, "Couldn't parse paritypieces: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	switch req.FormValue("erasurecode") {
+	case "", modules.ErasureCodeReedSolomon, modules.ErasureCodeReedSolomonSubchunk, modules.ErasureCodeReplication:
+	default:
+		writeError(w, "Unrecognized erasure code: "+req.FormValue("erasurecode"), http.StatusBadRequest)
+		return
+	}
 	err := srv.renter.Upload(modules.FileUploadParams{
-		Filename: req.FormValue("source"),
-		Nickname: req.FormValue("nickname"),
-		Duration: duration,
-		// let the renter decide these values; eventually they will be configurable
-		ErasureCode: nil,
-		PieceSize:   0,
+		Filename:        req.FormValue("source"),
+		Nickname:        req.FormValue("nickname"),
+		Duration:        duration,
+		CipherType:      cipherType,
+		ErasureCodeType: req.FormValue("erasurecode"),
+		DataPieces:      dataPieces,
+		ParityPieces:    parityPieces,
+		// let the renter decide the piece size
+		PieceSize: 0,
 	})
 	if err != nil {
 		writeError(w, "Upload failed: "+err.Error(), http.StatusInternalServerError)
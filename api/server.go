@@ -66,6 +66,9 @@ func (srv *Server) Serve() error {
 	}
 
 	// safely close each module
+	if srv.renter != nil {
+		srv.renter.Close()
+	}
 	if srv.cs != nil {
 		srv.cs.Close()
 	}
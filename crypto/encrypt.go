@@ -10,22 +10,80 @@ import (
 	"errors"
 	"io"
 
+	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/twofish"
 )
 
 const (
-	TwofishOverhead = 28 // number of bytes added by EncryptBytes
+	TwofishOverhead   = 28 // number of bytes added by TwofishKey.EncryptBytes
+	XChaCha20Overhead = 40 // number of bytes added by XChaCha20Key.EncryptBytes
 )
 
 var (
 	ErrInsufficientLen = errors.New("supplied ciphertext is not long enough to contain a nonce")
+	ErrUnknownCipher   = errors.New("unknown cipher type")
+
+	// TypeTwofish identifies the Twofish-GCM encryption scheme.
+	TypeTwofish = CipherType{0, 0, 0, 0, 0, 0, 0, 1}
+
+	// TypeXChaCha20 identifies the XChaCha20-Poly1305 encryption scheme.
+	TypeXChaCha20 = CipherType{0, 0, 0, 0, 0, 0, 0, 2}
 )
 
 type (
-	Ciphertext []byte
-	TwofishKey [EntropySize]byte
+	Ciphertext   []byte
+	TwofishKey   [EntropySize]byte
+	XChaCha20Key [EntropySize]byte
+
+	// A CipherType identifies an encryption scheme and version.
+	CipherType [8]byte
+
+	// A CipherKey is a key that can encrypt and decrypt byte slices using
+	// authenticated encryption.
+	CipherKey interface {
+		EncryptBytes([]byte) (Ciphertext, error)
+		DecryptBytes(Ciphertext) ([]byte, error)
+	}
 )
 
+// NewKey returns a key of the cipher type that is created from the supplied
+// entropy.
+func (ct CipherType) NewKey(entropy [EntropySize]byte) (CipherKey, error) {
+	switch ct {
+	case TypeTwofish:
+		return TwofishKey(entropy), nil
+	case TypeXChaCha20:
+		return XChaCha20Key(entropy), nil
+	default:
+		return nil, ErrUnknownCipher
+	}
+}
+
+// Overhead returns the number of bytes that EncryptBytes adds to the
+// plaintext when using the cipher type.
+func (ct CipherType) Overhead() uint64 {
+	switch ct {
+	case TypeTwofish:
+		return TwofishOverhead
+	case TypeXChaCha20:
+		return XChaCha20Overhead
+	default:
+		return 0
+	}
+}
+
+// String returns the name of the cipher type.
+func (ct CipherType) String() string {
+	switch ct {
+	case TypeTwofish:
+		return "twofish"
+	case TypeXChaCha20:
+		return "xchacha20"
+	default:
+		return "unknown"
+	}
+}
+
 // GenerateEncryptionKey produces a key that can be used for encrypting and
 // decrypting files.
 func GenerateTwofishKey() (key TwofishKey, err error) {
@@ -92,6 +150,43 @@ func (key TwofishKey) NewReader(r io.Reader) io.Reader {
 	return &cipher.StreamReader{S: stream, R: r}
 }
 
+// GenerateXChaCha20Key produces a key that can be used for encrypting and
+// decrypting data with XChaCha20-Poly1305.
+func GenerateXChaCha20Key() (key XChaCha20Key, err error) {
+	_, err = rand.Read(key[:])
+	return key, err
+}
+
+// EncryptBytes encrypts a []byte using XChaCha20-Poly1305 and prepends the
+// nonce (24 bytes) to the ciphertext.
+func (key XChaCha20Key) EncryptBytes(plaintext []byte) (Ciphertext, error) {
+	// NOTE: NewX only returns an error if len(key) != 32.
+	aead, _ := chacha20poly1305.NewX(key[:])
+
+	// Create the nonce. XChaCha20 nonces are large enough to be chosen at
+	// random.
+	nonce, err := RandBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// DecryptBytes decrypts the ciphertext created by EncryptBytes. The nonce is
+// expected to be the first 24 bytes of the ciphertext.
+func (key XChaCha20Key) DecryptBytes(ct Ciphertext) ([]byte, error) {
+	// NOTE: NewX only returns an error if len(key) != 32.
+	aead, _ := chacha20poly1305.NewX(key[:])
+
+	// Check for a nonce.
+	if len(ct) < aead.NonceSize() {
+		return nil, ErrInsufficientLen
+	}
+
+	// Decrypt the data.
+	return aead.Open(nil, ct[:aead.NonceSize()], ct[aead.NonceSize():], nil)
+}
+
 func (c Ciphertext) MarshalJSON() ([]byte, error) {
 	return json.Marshal([]byte(c))
 }
@@ -74,6 +74,83 @@ func TestTwofishEncryption(t *testing.T) {
 	key.DecryptBytes(nil)
 }
 
+// TestXChaCha20Encryption checks that XChaCha20-Poly1305 encryption and
+// decryption works correctly.
+func TestXChaCha20Encryption(t *testing.T) {
+	key, err := GenerateXChaCha20Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := make([]byte, 600)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := key.EncryptBytes(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ciphertext) != len(plaintext)+XChaCha20Overhead {
+		t.Fatal("ciphertext has wrong length:", len(ciphertext))
+	}
+	decryptedPlaintext, err := key.DecryptBytes(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, decryptedPlaintext) {
+		t.Fatal("Encrypted and decrypted plaintext do not match")
+	}
+
+	// Try to decrypt using a different key.
+	key2, err := GenerateXChaCha20Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = key2.DecryptBytes(ciphertext)
+	if err == nil {
+		t.Fatal("Expecting failed authentication err", err)
+	}
+
+	// Try to decrypt using bad ciphertexts.
+	ciphertext[0]++
+	_, err = key.DecryptBytes(ciphertext)
+	if err == nil {
+		t.Fatal("Expecting failed authentication err", err)
+	}
+	_, err = key.DecryptBytes(ciphertext[:10])
+	if err != ErrInsufficientLen {
+		t.Error("Expecting ErrInsufficientLen:", err)
+	}
+}
+
+// TestCipherTypes checks that each cipher type produces keys with the
+// advertised overhead.
+func TestCipherTypes(t *testing.T) {
+	var entropy [EntropySize]byte
+	_, err := rand.Read(entropy[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ct := range []CipherType{TypeTwofish, TypeXChaCha20} {
+		key, err := ct.NewKey(entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ciphertext, err := key.EncryptBytes(make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(len(ciphertext)) != 100+ct.Overhead() {
+			t.Fatalf("%v: expected overhead of %v, got %v", ct, ct.Overhead(), len(ciphertext)-100)
+		}
+	}
+	_, err = CipherType{}.NewKey(entropy)
+	if err != ErrUnknownCipher {
+		t.Fatal("expected ErrUnknownCipher, got", err)
+	}
+}
+
 // TestReaderWriter probes the NewReader and NewWriter methods of the key type.
 func TestReaderWriter(t *testing.T) {
 	// Get a key for encryption.
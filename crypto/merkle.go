@@ -34,10 +34,16 @@ func (t MerkleTree) PushObject(obj interface{}) {
 func (t MerkleTree) ReadSegments(r io.Reader) error {
 	buf := make([]byte, SegmentSize)
 	for {
-		_, err := io.ReadFull(r, buf)
+		n, err := io.ReadFull(r, buf)
 		if err == io.EOF {
 			break
-		} else if err != nil && err != io.ErrUnexpectedEOF {
+		} else if err == io.ErrUnexpectedEOF {
+			// Clear the remainder of the previous segment, so that the
+			// root of the data does not depend on what preceded it.
+			for i := n; i < len(buf); i++ {
+				buf[i] = 0
+			}
+		} else if err != nil {
 			return err
 		}
 		t.Push(buf)
@@ -67,6 +73,57 @@ func MerkleRoot(leaves [][]byte) (h Hash) {
 	return tree.Root()
 }
 
+// nodeHash returns the hash of an interior node of a Merkle tree, using the
+// same node prefix as the merkletree package.
+func nodeHash(left, right Hash) (h Hash) {
+	hasher := NewHash()
+	hasher.Write([]byte{1})
+	hasher.Write(left[:])
+	hasher.Write(right[:])
+	copy(h[:], hasher.Sum(nil))
+	return
+}
+
+// subtreeSplit returns the number of leaves in the left subtree of a tree
+// with n leaves, which is the largest power of 2 smaller than n.
+func subtreeSplit(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+// CachedMerkleRoot returns the Merkle root of a file given the Merkle roots
+// of its sectors, without rehashing the sectors. Every sector except the last
+// must contain the same power-of-2 number of segments; the last sector may be
+// shorter.
+func CachedMerkleRoot(roots []Hash) Hash {
+	switch len(roots) {
+	case 0:
+		return MerkleRoot(nil)
+	case 1:
+		return roots[0]
+	}
+	k := subtreeSplit(len(roots))
+	return nodeHash(CachedMerkleRoot(roots[:k]), CachedMerkleRoot(roots[k:]))
+}
+
+// BuildCachedProof returns the hashes that prove that the sector at index is
+// part of the file with the given sector roots, ordered from the sector up to
+// the file's root. Appending them to a proof of a segment within the sector
+// produces a proof of the segment within the file.
+func BuildCachedProof(roots []Hash, index uint64) []Hash {
+	if len(roots) <= 1 {
+		return nil
+	}
+	k := subtreeSplit(len(roots))
+	if index < uint64(k) {
+		return append(BuildCachedProof(roots[:k], index), CachedMerkleRoot(roots[k:]))
+	}
+	return append(BuildCachedProof(roots[k:], index-uint64(k)), CachedMerkleRoot(roots[:k]))
+}
+
 // Calculates the number of leaves in the file when building a Merkle tree.
 func CalculateLeaves(fileSize uint64) uint64 {
 	numSegments := fileSize / SegmentSize
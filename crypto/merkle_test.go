@@ -95,3 +95,46 @@ func TestPaddedStorageProof(t *testing.T) {
 		t.Error("padded segment proof failed")
 	}
 }
+
+// TestCachedMerkleRoot checks that the root and proofs built from sector
+// roots match those built from the whole file.
+func TestCachedMerkleRoot(t *testing.T) {
+	const sectorSize = 4 * SegmentSize
+	for _, fileSize := range []int{1, sectorSize, sectorSize + 1, 3 * sectorSize, 5*sectorSize + 70} {
+		data := make([]byte, fileSize)
+		rand.Read(data)
+		var roots []Hash
+		for i := 0; i < fileSize; i += sectorSize {
+			end := i + sectorSize
+			if end > fileSize {
+				end = fileSize
+			}
+			root, err := ReaderMerkleRoot(bytes.NewReader(data[i:end]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			roots = append(roots, root)
+		}
+		fileRoot, err := ReaderMerkleRoot(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if CachedMerkleRoot(roots) != fileRoot {
+			t.Fatal("cached root does not match file root for size", fileSize)
+		}
+
+		// Prove the last segment using the sector roots.
+		numSegments := CalculateLeaves(uint64(fileSize))
+		index := numSegments - 1
+		sectorIndex := index / (sectorSize / SegmentSize)
+		sector := data[sectorIndex*sectorSize:]
+		base, hashSet, err := BuildReaderProof(bytes.NewReader(sector), index%(sectorSize/SegmentSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashSet = append(hashSet, BuildCachedProof(roots, sectorIndex)...)
+		if !VerifySegment(base, hashSet, numSegments, index, fileRoot) {
+			t.Fatal("cached proof did not verify for size", fileSize)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package modules
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// ErrAnnNotAnnouncement is returned when arbitrary data does not carry
+	// the host announcement prefix.
+	ErrAnnNotAnnouncement = errors.New("arbitrary data is not a host announcement")
+
+	// ErrAnnBadSignature is returned when a signed host announcement has an
+	// unsupported public key or an invalid signature.
+	ErrAnnBadSignature = errors.New("host announcement has an invalid signature")
+)
+
+// announcementHash returns the hash that is signed by a signed host
+// announcement.
+func announcementHash(addr NetAddress, pk types.SiaPublicKey) crypto.Hash {
+	return crypto.HashAll(PrefixHostAnnouncement, addr, pk)
+}
+
+// CreateSignedAnnouncement returns the arbitrary data of a host announcement
+// for addr, signed by the host's key pair.
+func CreateSignedAnnouncement(addr NetAddress, pk types.SiaPublicKey, sk crypto.SecretKey) ([]byte, error) {
+	sig, err := crypto.SignHash(announcementHash(addr, pk), sk)
+	if err != nil {
+		return nil, err
+	}
+	ann := encoding.Marshal(SignedHostAnnouncement{
+		HostAnnouncement: HostAnnouncement{IPAddress: addr},
+		PublicKey:        pk,
+		Signature:        sig,
+	})
+	return append(PrefixHostAnnouncement[:], ann...), nil
+}
+
+// DecodeAnnouncement decodes the host announcement in a piece of arbitrary
+// data. Both signed and legacy announcements are accepted; for legacy
+// announcements, the returned public key is empty. A signed announcement with
+// an invalid signature is rejected.
+func DecodeAnnouncement(arb []byte) (addr NetAddress, pk types.SiaPublicKey, err error) {
+	var prefix types.Specifier
+	copy(prefix[:], arb)
+	if len(arb) < types.SpecifierLen || prefix != PrefixHostAnnouncement {
+		return "", types.SiaPublicKey{}, ErrAnnNotAnnouncement
+	}
+	payload := arb[types.SpecifierLen:]
+
+	var sha SignedHostAnnouncement
+	if encoding.Unmarshal(payload, &sha) != nil {
+		// Not a signed announcement; try the legacy format.
+		var ha HostAnnouncement
+		err = encoding.Unmarshal(payload, &ha)
+		if err != nil {
+			return "", types.SiaPublicKey{}, err
+		}
+		return ha.IPAddress, types.SiaPublicKey{}, nil
+	}
+
+	// Only ed25519 keys are supported.
+	if sha.PublicKey.Algorithm != types.SignatureEd25519 || len(sha.PublicKey.Key) != crypto.PublicKeySize {
+		return "", types.SiaPublicKey{}, ErrAnnBadSignature
+	}
+	var cpk crypto.PublicKey
+	copy(cpk[:], sha.PublicKey.Key)
+	err = crypto.VerifyHash(announcementHash(sha.IPAddress, sha.PublicKey), cpk, sha.Signature)
+	if err != nil {
+		return "", types.SiaPublicKey{}, ErrAnnBadSignature
+	}
+	return sha.IPAddress, sha.PublicKey, nil
+}
@@ -0,0 +1,70 @@
+package modules
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestDecodeAnnouncement probes the decoding of signed and legacy host
+// announcements.
+func TestDecodeAnnouncement(t *testing.T) {
+	sk, pk, err := crypto.StdKeyGen.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       pk[:],
+	}
+
+	// A signed announcement yields the address and the public key.
+	arb, err := CreateSignedAnnouncement("foo.com:1234", spk, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, decodedKey, err := DecodeAnnouncement(arb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "foo.com:1234" || string(decodedKey.Key) != string(spk.Key) {
+		t.Fatal("signed announcement decoded incorrectly:", addr, decodedKey)
+	}
+
+	// Nodes that only understand legacy announcements can still read the
+	// address of a signed announcement.
+	var ha HostAnnouncement
+	err = encoding.Unmarshal(arb[types.SpecifierLen:], &ha)
+	if err != nil || ha.IPAddress != "foo.com:1234" {
+		t.Fatal("signed announcement is not readable as a legacy announcement:", ha, err)
+	}
+
+	// Tampering with the address invalidates the signature.
+	var sha SignedHostAnnouncement
+	err = encoding.Unmarshal(arb[types.SpecifierLen:], &sha)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha.IPAddress = "bar.com:1234"
+	forged := append(PrefixHostAnnouncement[:], encoding.Marshal(sha)...)
+	if _, _, err := DecodeAnnouncement(forged); err != ErrAnnBadSignature {
+		t.Fatal("expected ErrAnnBadSignature, got", err)
+	}
+
+	// A legacy announcement yields an empty public key.
+	legacy := append(PrefixHostAnnouncement[:], encoding.Marshal(HostAnnouncement{IPAddress: "baz.com:1234"})...)
+	addr, decodedKey, err = DecodeAnnouncement(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "baz.com:1234" || len(decodedKey.Key) != 0 {
+		t.Fatal("legacy announcement decoded incorrectly:", addr, decodedKey)
+	}
+
+	// Data without the announcement prefix is rejected.
+	if _, _, err := DecodeAnnouncement(PrefixNonSia[:]); err != ErrAnnNotAnnouncement {
+		t.Fatal("expected ErrAnnNotAnnouncement, got", err)
+	}
+}
@@ -0,0 +1,41 @@
+package modules
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// ErrBadChallengeResponse is returned when the response to a challenge
+	// is not signed by the expected key.
+	ErrBadChallengeResponse = errors.New("challenge response has an invalid signature")
+)
+
+// challengeHash returns the hash that is signed in response to a challenge
+// issued during an RPC. Including the RPC's specifier prevents a response
+// from being replayed in a different RPC.
+func challengeHash(rpc types.Specifier, challenge crypto.Hash) crypto.Hash {
+	return crypto.HashAll(rpc, challenge)
+}
+
+// SignChallenge signs a challenge issued during an RPC, proving that the
+// signer holds sk.
+func SignChallenge(rpc types.Specifier, challenge crypto.Hash, sk crypto.SecretKey) (crypto.Signature, error) {
+	return crypto.SignHash(challengeHash(rpc, challenge), sk)
+}
+
+// VerifyChallenge checks that sig is a response to a challenge issued during
+// an RPC, signed by the ed25519 key pk.
+func VerifyChallenge(rpc types.Specifier, challenge crypto.Hash, pk types.SiaPublicKey, sig crypto.Signature) error {
+	if pk.Algorithm != types.SignatureEd25519 || len(pk.Key) != crypto.PublicKeySize {
+		return ErrBadChallengeResponse
+	}
+	var cpk crypto.PublicKey
+	copy(cpk[:], pk.Key)
+	if crypto.VerifyHash(challengeHash(rpc, challenge), cpk, sig) != nil {
+		return ErrBadChallengeResponse
+	}
+	return nil
+}
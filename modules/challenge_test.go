@@ -0,0 +1,41 @@
+package modules
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestChallenge checks that a challenge response only verifies against the
+// signer's key, the same challenge, and the same RPC.
+func TestChallenge(t *testing.T) {
+	sk, pk, err := crypto.StdKeyGen.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}
+	challenge := crypto.HashObject("challenge")
+
+	sig, err := SignChallenge(RPCKeyProof, challenge, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyChallenge(RPCKeyProof, challenge, spk, sig); err != nil {
+		t.Fatal(err)
+	}
+	if VerifyChallenge(RPCKeyProof, crypto.HashObject("other"), spk, sig) != ErrBadChallengeResponse {
+		t.Error("response verified against a different challenge")
+	}
+	if VerifyChallenge(RPCLastRevision, challenge, spk, sig) != ErrBadChallengeResponse {
+		t.Error("response verified in a different RPC")
+	}
+	_, otherPK, err := crypto.StdKeyGen.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: otherPK[:]}
+	if VerifyChallenge(RPCKeyProof, challenge, other, sig) != ErrBadChallengeResponse {
+		t.Error("response verified against a different key")
+	}
+}
@@ -149,7 +149,19 @@ func (cs *ConsensusSet) ConsensusSetSubscribe(subscriber modules.ConsensusSetSub
 func (cs *ConsensusSet) ConsensusSetPersistentSubscribe(subscriber modules.ConsensusSetSubscriber, start modules.ConsensusChangeID) error {
 	// Add the subscriber to the list of subscribers under lock, and then
 	// demote while sending the subscriber all of the changes they've missed.
+	// The subscriber is only added if the starting change is known.
 	cs.mu.Lock()
+	if start != (modules.ConsensusChangeID{}) {
+		var exists bool
+		_ = cs.db.View(func(tx *bolt.Tx) error {
+			_, exists = getEntry(tx, start)
+			return nil
+		})
+		if !exists {
+			cs.mu.Unlock()
+			return errChangeEntryNotFound
+		}
+	}
 	cs.subscribers = append(cs.subscribers, subscriber)
 	cs.mu.Demote()
 	defer cs.mu.DemotedUnlock()
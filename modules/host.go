@@ -1,6 +1,9 @@
 package modules
 
 import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -10,6 +13,27 @@ const (
 
 	// HostDir names the directory that contains the host persistence.
 	HostDir = "host"
+
+	// HostContractActive is the proof status of a contract whose proof
+	// window has not yet started.
+	HostContractActive = "active"
+
+	// HostContractProving is the proof status of a contract whose proof
+	// window is open.
+	HostContractProving = "proving"
+
+	// HostContractSubmitted is the proof status of a contract whose storage
+	// proof has been submitted to the transaction pool.
+	HostContractSubmitted = "submitted"
+
+	// HostContractConfirmed is the proof status of a contract whose storage
+	// proof is in the blockchain, but not yet buried deep enough to be safe
+	// from reorgs.
+	HostContractConfirmed = "confirmed"
+
+	// HostContractExpired is the proof status of a contract whose proof
+	// window has ended without the host's obligation being resolved.
+	HostContractExpired = "expired"
 )
 
 var (
@@ -22,9 +46,22 @@ var (
 	// RPCRevise is the specifier for revising an existing file contract.
 	RPCRevise = types.Specifier{'R', 'e', 'v', 'i', 's', 'e'}
 
-	// RPCDownload is the specifier for downloading a file from a host.
+	// RPCDownload is the specifier for downloading a file from a host. Each
+	// request must be paid for with a revision of the file contract.
 	RPCDownload = types.Specifier{'D', 'o', 'w', 'n', 'l', 'o', 'a', 'd'}
 
+	// RPCLastRevision is the specifier for requesting the host's most recent
+	// signed revision of a file contract. The host sends a random challenge,
+	// which the renter must sign with its key from the contract's unlock
+	// conditions.
+	RPCLastRevision = types.Specifier{'L', 'a', 's', 't', 'R', 'e', 'v', 'i', 's', 'i', 'o', 'n'}
+
+	// RPCKeyProof is the specifier for asking a host to prove that it holds
+	// the secret key of its public key. The renter sends a random challenge,
+	// and the host responds with its public key and its signature of the
+	// challenge.
+	RPCKeyProof = types.Specifier{'K', 'e', 'y', 'P', 'r', 'o', 'o', 'f'}
+
 	// PrefixHostAnnouncement is used to indicate that a transaction's
 	// Arbitrary Data field contains a host announcement. The encoded
 	// announcement will follow this prefix.
@@ -33,7 +70,9 @@ var (
 
 type (
 	// A DownloadRequest is used to retrieve a particular segment of a file from a
-	// host.
+	// host. Unless Length is zero, which ends the download, the request is
+	// followed by a transaction containing a contract revision that pays the
+	// host for Length bytes.
 	DownloadRequest struct {
 		Offset uint64
 		Length uint64
@@ -45,6 +84,17 @@ type (
 		IPAddress NetAddress
 	}
 
+	// SignedHostAnnouncement is a HostAnnouncement signed by the host's
+	// public key, which gives the host a stable identity across changes of
+	// address. It uses the same prefix as a HostAnnouncement; nodes that do
+	// not understand signed announcements read the leading HostAnnouncement
+	// and ignore the rest.
+	SignedHostAnnouncement struct {
+		HostAnnouncement
+		PublicKey types.SiaPublicKey
+		Signature crypto.Signature
+	}
+
 	// HostSettings are the parameters advertised by the host. These are the
 	// values that the renter will request from the host in order to build its
 	// database.
@@ -59,12 +109,128 @@ type (
 		Price        types.Currency
 		Collateral   types.Currency
 		UnlockHash   types.UnlockHash
+		Version      string // Empty for hosts that predate the field.
+
+		// DownloadPrice is the number of hastings per byte that the host
+		// charges for downloads. It is zero for hosts that predate the
+		// field.
+		DownloadPrice types.Currency
+
+		// RemainingStorage is the number of bytes that the host can still
+		// store. Renters fill it in from TotalStorage for hosts that
+		// predate the field.
+		RemainingStorage int64
+	}
+
+	// A HostContract describes a file contract that the host is obligated
+	// to fulfill.
+	HostContract struct {
+		ID             types.FileContractID `json:"id"`
+		FileSize       uint64               `json:"filesize"`
+		RevisionNumber uint64               `json:"revisionnumber"`
+		Payout         types.Currency       `json:"payout"`
+		WindowStart    types.BlockHeight    `json:"windowstart"`
+		WindowEnd      types.BlockHeight    `json:"windowend"`
+		ProofStatus    string               `json:"proofstatus"`
+
+		// StorageFolders lists the storage folders that hold the
+		// contract's sectors.
+		StorageFolders []string `json:"storagefolders"`
+
+		// Corrupt is true if the last scrub found that the contract's data
+		// does not match its Merkle root.
+		Corrupt bool `json:"corrupt"`
+	}
+
+	// HostConnectionLimits restrict the connections and RPCs that the host
+	// accepts. A limit of 0 means no limit.
+	HostConnectionLimits struct {
+		// MaxConnections is the most connections that the host serves at
+		// once, and MaxConnectionsPerIP the most it serves from a single IP
+		// address.
+		MaxConnections      int `json:"maxconnections"`
+		MaxConnectionsPerIP int `json:"maxconnectionsperip"`
+
+		// MaxRPCsPerMinute is the most times per minute that a single IP
+		// address may call each RPC.
+		MaxRPCsPerMinute int `json:"maxrpcsperminute"`
+	}
+
+	// HostConnectionMetrics count the host's connections, and the
+	// connections and RPCs that it rejected because of its connection
+	// limits since it started.
+	HostConnectionMetrics struct {
+		ActiveConnections     int    `json:"activeconnections"`
+		RejectedConnections   uint64 `json:"rejectedconnections"`
+		RejectedIPConnections uint64 `json:"rejectedipconnections"`
+		RateLimitedRPCs       uint64 `json:"ratelimitedrpcs"`
+	}
+
+	// A HostPricingPolicy lets the host adjust its storage price between
+	// MinPrice and MaxPrice, raising it as its storage fills up and as
+	// demand for new contracts grows. Prices are in hastings per byte per
+	// block.
+	HostPricingPolicy struct {
+		Enabled  bool           `json:"enabled"`
+		MinPrice types.Currency `json:"minprice"`
+		MaxPrice types.Currency `json:"maxprice"`
+	}
+
+	// A HostCorruptContract identifies a contract whose data failed the
+	// host's integrity check, and describes the failure.
+	HostCorruptContract struct {
+		ID    types.FileContractID `json:"id"`
+		Error string               `json:"error"`
+	}
+
+	// HostScrubStatus describes the host's checks of the integrity of its
+	// contract data. LastScrub is the zero time if no scrub has finished.
+	HostScrubStatus struct {
+		Scrubbing        bool                  `json:"scrubbing"`
+		LastScrub        time.Time             `json:"lastscrub"`
+		CorruptContracts []HostCorruptContract `json:"corruptcontracts"`
+	}
+
+	// A HostFinancialPeriod records the revenue that the host realized and
+	// lost during a range of block heights, along with the fees it paid to
+	// submit storage proofs.
+	HostFinancialPeriod struct {
+		StartHeight types.BlockHeight `json:"startheight"`
+		EndHeight   types.BlockHeight `json:"endheight"`
+
+		StorageRevenue   types.Currency `json:"storagerevenue"`
+		BandwidthRevenue types.Currency `json:"bandwidthrevenue"`
+		LostRevenue      types.Currency `json:"lostrevenue"`
+		LostCollateral   types.Currency `json:"lostcollateral"`
+		ProofFees        types.Currency `json:"prooffees"`
+	}
+
+	// HostFinancials describes the host's revenue from unresolved file
+	// contracts, and its realized revenue in each accounting period.
+	HostFinancials struct {
+		PotentialStorageRevenue   types.Currency        `json:"potentialstoragerevenue"`
+		PotentialBandwidthRevenue types.Currency        `json:"potentialbandwidthrevenue"`
+		LockedCollateral          types.Currency        `json:"lockedcollateral"`
+		Periods                   []HostFinancialPeriod `json:"periods"`
+	}
+
+	// StorageFolderMetadata contains information about a directory in which
+	// the host stores contract data.
+	StorageFolderMetadata struct {
+		Path              string `json:"path"`
+		Capacity          int64  `json:"capacity"`
+		CapacityRemaining int64  `json:"capacityremaining"` // Can go negative.
+		Sectors           uint64 `json:"sectors"`
 	}
 
 	// Host can take storage from disk and offer it to the network, managing things
 	// such as announcements, settings, and implementing all of the RPCs of the
 	// host protocol.
 	Host interface {
+		// AddStorageFolder adds a directory in which the host can store up
+		// to size bytes of contract data.
+		AddStorageFolder(path string, size int64) error
+
 		// Announce announces the host on the blockchain, returning an error if the
 		// external ip address is unknown.
 		Announce() error
@@ -81,21 +247,88 @@ type (
 		// host is responsible for.
 		Contracts() uint64
 
+		// ConnectionLimits returns the limits on the connections and RPCs
+		// that the host accepts.
+		ConnectionLimits() HostConnectionLimits
+
+		// ConnectionMetrics returns the number of connections that the host
+		// is serving, and the number of connections and RPCs that it has
+		// rejected.
+		ConnectionMetrics() HostConnectionMetrics
+
+		// ContractObligations returns the unresolved file contracts that the
+		// host is responsible for, ordered by the start of their proof
+		// windows.
+		ContractObligations() []HostContract
+
+		// Financials returns the host's potential revenue and its realized
+		// revenue in each accounting period.
+		Financials() HostFinancials
+
+		// LockedCollateral returns the amount of collateral that the host
+		// has locked in unresolved file contracts, and the most that it is
+		// willing to lock.
+		LockedCollateral() (locked, budget types.Currency)
+
+		// Maintenance reports whether the host is in maintenance mode.
+		Maintenance() bool
+
 		// NetAddress returns the host's network address
 		NetAddress() NetAddress
 
+		// PricingPolicy returns the policy by which the host adjusts its
+		// storage price.
+		PricingPolicy() HostPricingPolicy
+
+		// RemoveStorageFolder moves the contract data in a storage folder
+		// to the host's other folders and stops using the folder.
+		RemoveStorageFolder(path string) error
+
+		// ResizeStorageFolder changes the amount of contract data that the
+		// host will store in a storage folder.
+		ResizeStorageFolder(path string, size int64) error
+
 		// Revenue returns the amount of revenue that the host has lined up, as
 		// well as the amount of revenue that the host has successfully
 		// captured.
 		Revenue() (unresolved, resolved types.Currency)
 
+		// Scrub starts checking the integrity of the host's contract data.
+		Scrub() error
+
+		// ScrubStatus reports the progress and results of the host's checks
+		// of the integrity of its contract data.
+		ScrubStatus() HostScrubStatus
+
+		// SetCollateralBudget sets the most collateral that the host will
+		// lock in unresolved file contracts.
+		SetCollateralBudget(types.Currency)
+
+		// SetConnectionLimits sets the limits on the connections and RPCs
+		// that the host accepts.
+		SetConnectionLimits(HostConnectionLimits)
+
+		// SetMaintenance puts the host in or takes it out of maintenance
+		// mode, in which it rejects new file contracts but continues to
+		// honor existing ones.
+		SetMaintenance(bool)
+
+		// SetPricingPolicy sets the policy by which the host adjusts its
+		// storage price.
+		SetPricingPolicy(HostPricingPolicy) error
+
 		// SetConfig sets the hosting parameters of the host.
 		SetSettings(HostSettings)
 
 		// Settings returns the host's settings.
 		Settings() HostSettings
 
-		// Close saves the state of the host and stops its listener process.
+		// StorageFolders returns the capacity and usage of each of the
+		// host's storage folders.
+		StorageFolders() []StorageFolderMetadata
+
+		// Close stops the host's listener process, waits for in-flight RPCs
+		// to finish, and saves the state of the host.
 		Close() error
 	}
 )
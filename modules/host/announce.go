@@ -3,7 +3,6 @@ package host
 import (
 	"errors"
 
-	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -17,23 +16,27 @@ func (h *Host) announce(addr modules.NetAddress) error {
 			return err
 		}
 		h.UnlockHash = uc.UnlockHash()
-		err = h.save()
+		err = h.saveSettings()
 		if err != nil {
 			return err
 		}
 	}
 
-	// Create a transaction with a host announcement.
+	// Create a transaction with a host announcement, signed by the host's
+	// public key.
+	h.mu.RLock()
+	announcement, err := modules.CreateSignedAnnouncement(addr, h.publicKey, h.secretKey)
+	h.mu.RUnlock()
+	if err != nil {
+		return err
+	}
 	txnBuilder := h.wallet.StartTransaction()
-	announcement := encoding.Marshal(modules.HostAnnouncement{
-		IPAddress: addr,
-	})
-	_ = txnBuilder.AddArbitraryData(append(modules.PrefixHostAnnouncement[:], announcement...))
+	_ = txnBuilder.AddArbitraryData(announcement)
 	txn, parents := txnBuilder.View()
 	txnSet := append(parents, txn)
 
 	// Add the transaction to the transaction pool.
-	err := h.tpool.AcceptTransactionSet(txnSet)
+	err = h.tpool.AcceptTransactionSet(txnSet)
 	if err == modules.ErrDuplicateTransactionSet {
 		return errors.New("you have already announced yourself")
 	}
@@ -0,0 +1,97 @@
+package host
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// defaultCollateralBudget is the most collateral that a new host will
+	// lock in unresolved file contracts.
+	defaultCollateralBudget = types.SiacoinPrecision.Mul(types.NewCurrency64(5e3)) // 5000 SC
+
+	errCollateralBudgetExceeded = errors.New("host has reached its collateral budget")
+	errCollateralNotForfeited   = errors.New("file contract collateral must be lost if the storage proof is missed")
+	errCollateralTooHigh        = errors.New("file contract collateral is higher than the host offers")
+)
+
+// contractCollateral returns the collateral that the host put up when
+// forming a file contract. The collateral is returned to the host with a
+// valid storage proof, and sent to the void otherwise.
+func contractCollateral(fc types.FileContract) types.Currency {
+	if len(fc.ValidProofOutputs) != 2 {
+		return types.ZeroCurrency
+	}
+	return fc.ValidProofOutputs[1].Value
+}
+
+// lockedCollateral returns the total collateral that the host has put up in
+// unresolved file contracts.
+func (h *Host) lockedCollateral() types.Currency {
+	var locked types.Currency
+	for _, ob := range h.obligationsByID {
+		locked = locked.Add(contractCollateral(ob.FileContract))
+	}
+	return locked
+}
+
+// considerCollateral checks that the collateral requested by a file contract
+// is proportional to the renter's payment for storage, and that locking it
+// would keep the host within its collateral budget.
+func (h *Host) considerCollateral(fc types.FileContract) error {
+	collateral := contractCollateral(fc)
+	if fc.MissedProofOutputs[1].Value.Cmp(collateral) != 0 {
+		return errCollateralNotForfeited
+	}
+	if collateral.IsZero() {
+		return nil
+	}
+	// The renter pays Price per byte per block of storage, and the host
+	// offers Collateral per byte per block, so the collateral may be at most
+	// the renter's payment scaled by Collateral/Price.
+	if fc.Payout.Cmp(collateral) < 0 {
+		return errCollateralTooHigh
+	}
+	renterFunds := fc.Payout.Sub(collateral)
+	if h.Price.IsZero() || collateral.Mul(h.Price).Cmp(renterFunds.Mul(h.Collateral)) > 0 {
+		return errCollateralTooHigh
+	}
+	if h.lockedCollateral().Add(h.reservedCollateral).Add(collateral).Cmp(h.collateralBudget) > 0 {
+		return errCollateralBudgetExceeded
+	}
+	return nil
+}
+
+// reserveCollateral reserves the collateral of a file contract that is being
+// negotiated, so that concurrent negotiations cannot exceed the budget
+// between them. The reservation must be
+// released with releaseCollateral once the contract is added to the host's
+// obligations or the negotiation fails.
+func (h *Host) reserveCollateral(fc types.FileContract) {
+	h.reservedCollateral = h.reservedCollateral.Add(contractCollateral(fc))
+}
+
+// releaseCollateral releases collateral reserved by reserveCollateral.
+func (h *Host) releaseCollateral(fc types.FileContract) {
+	h.reservedCollateral = h.reservedCollateral.Sub(contractCollateral(fc))
+}
+
+// LockedCollateral returns the amount of collateral that the host has locked
+// in unresolved file contracts, and the most that it is willing to lock.
+func (h *Host) LockedCollateral() (locked, budget types.Currency) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.lockedCollateral(), h.collateralBudget
+}
+
+// SetCollateralBudget sets the most collateral that the host will lock in
+// unresolved file contracts. Lowering the budget below the collateral that is
+// already locked prevents new contracts with collateral, but does not affect
+// existing contracts.
+func (h *Host) SetCollateralBudget(budget types.Currency) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.collateralBudget = budget
+	h.saveSettings()
+}
@@ -0,0 +1,78 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestConsiderCollateral checks that the host only accepts collateral that is
+// proportional to the renter's payment, forfeited on a missed proof, and
+// within the host's budget.
+func TestConsiderCollateral(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestConsiderCollateral", t)
+	h := ht.host
+	h.Price = types.NewCurrency64(10)
+	h.Collateral = types.NewCurrency64(5) // half the price
+	h.collateralBudget = types.NewCurrency64(1000)
+
+	// contract returns a file contract in which the renter pays renterFunds
+	// and the host puts up collateral.
+	contract := func(renterFunds, collateral types.Currency) types.FileContract {
+		return types.FileContract{
+			Payout: renterFunds.Add(collateral),
+			ValidProofOutputs: []types.SiacoinOutput{
+				{Value: renterFunds},
+				{Value: collateral, UnlockHash: h.UnlockHash},
+			},
+			MissedProofOutputs: []types.SiacoinOutput{
+				{Value: renterFunds},
+				{Value: collateral},
+			},
+		}
+	}
+	notForfeited := contract(types.NewCurrency64(1000), types.NewCurrency64(500))
+	notForfeited.MissedProofOutputs[1].Value = types.ZeroCurrency
+
+	tests := []struct {
+		fc  types.FileContract
+		err error
+	}{
+		{contract(types.NewCurrency64(1000), types.ZeroCurrency), nil},
+		{contract(types.NewCurrency64(1000), types.NewCurrency64(500)), nil},
+		{contract(types.NewCurrency64(1000), types.NewCurrency64(501)), errCollateralTooHigh},
+		{contract(types.NewCurrency64(4000), types.NewCurrency64(1001)), errCollateralBudgetExceeded},
+		{notForfeited, errCollateralNotForfeited},
+	}
+	for i, test := range tests {
+		if err := h.considerCollateral(test.fc); err != test.err {
+			t.Errorf("%v: expected %v, got %v", i, test.err, err)
+		}
+	}
+
+	// collateral locked in existing contracts counts against the budget
+	h.obligationsByID[types.FileContractID{1}] = &contractObligation{
+		FileContract: contract(types.NewCurrency64(1000), types.NewCurrency64(500)),
+	}
+	if locked, budget := h.LockedCollateral(); locked.Cmp(types.NewCurrency64(500)) != 0 || budget.Cmp(types.NewCurrency64(1000)) != 0 {
+		t.Fatal("wrong locked collateral or budget:", locked, budget)
+	}
+	if err := h.considerCollateral(contract(types.NewCurrency64(1200), types.NewCurrency64(600))); err != errCollateralBudgetExceeded {
+		t.Fatal("expected collateral beyond the budget to be rejected, got", err)
+	}
+
+	// collateral reserved by a contract under negotiation also counts against
+	// the budget until it is released
+	reserved := contract(types.NewCurrency64(600), types.NewCurrency64(300))
+	h.reserveCollateral(reserved)
+	if err := h.considerCollateral(contract(types.NewCurrency64(600), types.NewCurrency64(300))); err != errCollateralBudgetExceeded {
+		t.Fatal("expected collateral beyond the reserved budget to be rejected, got", err)
+	}
+	h.releaseCollateral(reserved)
+	if err := h.considerCollateral(contract(types.NewCurrency64(600), types.NewCurrency64(300))); err != nil {
+		t.Fatal("expected released collateral to be available, got", err)
+	}
+}
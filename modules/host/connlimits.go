@@ -0,0 +1,112 @@
+package host
+
+import (
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// defaultConnectionLimits are the connection limits of a new host.
+	defaultConnectionLimits = modules.HostConnectionLimits{
+		MaxConnections:      128,
+		MaxConnectionsPerIP: 32,
+		MaxRPCsPerMinute:    120,
+	}
+
+	// rpcRateWindow is the period over which the host counts the RPCs
+	// called by each IP address.
+	rpcRateWindow = time.Minute
+)
+
+// An rpcKey identifies the calls of an RPC from an IP address.
+type rpcKey struct {
+	ip string
+	id types.Specifier
+}
+
+// remoteIP returns the IP address at the other end of a connection.
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// acquireConn reserves a connection slot for a connection from ip. It returns
+// false if accepting the connection would exceed the host's connection
+// limits.
+func (h *Host) acquireConn(ip string) bool {
+	switch {
+	case h.connLimits.MaxConnections != 0 && h.connMetrics.ActiveConnections >= h.connLimits.MaxConnections:
+		h.connMetrics.RejectedConnections++
+		return false
+	case h.connLimits.MaxConnectionsPerIP != 0 && h.connsByIP[ip] >= h.connLimits.MaxConnectionsPerIP:
+		h.connMetrics.RejectedIPConnections++
+		return false
+	}
+	h.connMetrics.ActiveConnections++
+	h.connsByIP[ip]++
+	return true
+}
+
+// releaseConn releases the connection slot of a connection from ip.
+func (h *Host) releaseConn(ip string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.connMetrics.ActiveConnections--
+	h.connsByIP[ip]--
+	if h.connsByIP[ip] == 0 {
+		delete(h.connsByIP, ip)
+	}
+}
+
+// allowRPC reports whether ip may call the RPC id without exceeding the
+// host's rate limit, and counts the call if so.
+func (h *Host) allowRPC(ip string, id types.Specifier) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.connLimits.MaxRPCsPerMinute == 0 {
+		return true
+	}
+	if time.Since(h.rpcWindowStart) >= rpcRateWindow {
+		h.rpcCalls = make(map[rpcKey]int)
+		h.rpcWindowStart = time.Now()
+	}
+	key := rpcKey{ip, id}
+	if h.rpcCalls[key] >= h.connLimits.MaxRPCsPerMinute {
+		h.connMetrics.RateLimitedRPCs++
+		return false
+	}
+	h.rpcCalls[key]++
+	return true
+}
+
+// ConnectionLimits returns the limits on the connections and RPCs that the
+// host accepts.
+func (h *Host) ConnectionLimits() modules.HostConnectionLimits {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.connLimits
+}
+
+// ConnectionMetrics returns the number of connections that the host is
+// serving, and the number of connections and RPCs that it has rejected since
+// it started.
+func (h *Host) ConnectionMetrics() modules.HostConnectionMetrics {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.connMetrics
+}
+
+// SetConnectionLimits sets the limits on the connections and RPCs that the
+// host accepts. Connections that are already open are not affected.
+func (h *Host) SetConnectionLimits(limits modules.HostConnectionLimits) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.connLimits = limits
+	h.saveSettings()
+}
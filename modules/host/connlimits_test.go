@@ -0,0 +1,84 @@
+package host
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestConnectionLimits checks that the host closes connections beyond its
+// per IP limit, and refuses RPCs beyond its rate limit.
+func TestConnectionLimits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestConnectionLimits", t)
+	h := ht.host
+	h.SetConnectionLimits(modules.HostConnectionLimits{MaxConnectionsPerIP: 1, MaxRPCsPerMinute: 2})
+
+	// settings requests an RPC, and returns whether the host responded.
+	settings := func(conn net.Conn) bool {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if err := encoding.WriteObject(conn, modules.RPCSettings); err != nil {
+			return false
+		}
+		var hs modules.HostSettings
+		return encoding.ReadObject(conn, &hs, 1e3) == nil
+	}
+
+	// a second connection from the same IP is closed while the first is open
+	first, err := net.Dial("tcp", string(h.netAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	second, err := net.Dial("tcp", string(h.netAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings(second) {
+		t.Error("host served a connection beyond its per IP limit")
+	}
+	second.Close()
+	if !settings(first) {
+		t.Fatal("host did not serve a connection within its limits")
+	}
+	first.Close()
+	if metrics := h.ConnectionMetrics(); metrics.RejectedIPConnections != 1 {
+		t.Error("expected 1 rejected connection, got", metrics.RejectedIPConnections)
+	}
+
+	// the third call of RPCSettings within a minute is refused
+	for i := 0; i < 2; i++ {
+		time.Sleep(100 * time.Millisecond) // wait for the previous connection to be released
+		conn, err := net.Dial("tcp", string(h.netAddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok := settings(conn)
+		conn.Close()
+		if ok != (i == 0) {
+			t.Fatalf("call %v: expected response %v, got %v", i+2, i == 0, ok)
+		}
+	}
+	metrics := h.ConnectionMetrics()
+	if metrics.RateLimitedRPCs != 1 {
+		t.Error("expected 1 rate limited RPC, got", metrics.RateLimitedRPCs)
+	}
+
+	// the rate limit resets after rpcRateWindow
+	h.mu.Lock()
+	h.rpcWindowStart = h.rpcWindowStart.Add(-rpcRateWindow)
+	h.mu.Unlock()
+	if !h.allowRPC("127.0.0.1", modules.RPCSettings) {
+		t.Error("rate limit was not reset")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if metrics := h.ConnectionMetrics(); metrics.ActiveConnections != 0 {
+		t.Error("connections were not released:", metrics.ActiveConnections)
+	}
+}
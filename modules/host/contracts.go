@@ -0,0 +1,86 @@
+package host
+
+import (
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// obligationStatus returns the proof status of an obligation at the given
+// height.
+func obligationStatus(ob *contractObligation, height types.BlockHeight) string {
+	switch {
+	case ob.ProofHeight != 0:
+		return modules.HostContractConfirmed
+	case height < ob.FileContract.WindowStart:
+		return modules.HostContractActive
+	case height < ob.FileContract.WindowEnd && ob.proofSubmitted:
+		return modules.HostContractSubmitted
+	case height < ob.FileContract.WindowEnd:
+		return modules.HostContractProving
+	default:
+		return modules.HostContractExpired
+	}
+}
+
+// contractInfo returns a description of an obligation.
+func (h *Host) contractInfo(ob *contractObligation) modules.HostContract {
+	fc := ob.FileContract
+	hc := modules.HostContract{
+		ID:          ob.ID,
+		FileSize:    fc.FileSize,
+		Payout:      fc.Payout,
+		WindowStart: fc.WindowStart,
+		WindowEnd:   fc.WindowEnd,
+		ProofStatus: obligationStatus(ob, h.blockHeight),
+	}
+	_, hc.Corrupt = h.corruptContracts[ob.ID]
+	// The first revision of a contract is empty.
+	if len(ob.LastRevisionTxn.FileContractRevisions) == 1 {
+		if rev := ob.LastRevisionTxn.FileContractRevisions[0]; rev.NewRevisionNumber != 0 {
+			hc.FileSize = rev.NewFileSize
+			hc.RevisionNumber = rev.NewRevisionNumber
+		}
+	}
+
+	// list each storage folder that holds one of the contract's sectors once
+	seen := make(map[string]struct{})
+	for _, root := range ob.SectorRoots {
+		s, exists := h.sectors[root]
+		if !exists {
+			continue
+		}
+		if _, ok := seen[s.Folder]; !ok {
+			seen[s.Folder] = struct{}{}
+			hc.StorageFolders = append(hc.StorageFolders, s.Folder)
+		}
+	}
+	return hc
+}
+
+// ContractObligations returns the unresolved file contracts that the host is
+// responsible for, ordered by the start of their proof windows.
+func (h *Host) ContractObligations() []modules.HostContract {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	contracts := make([]modules.HostContract, 0, len(h.obligationsByID))
+	for _, ob := range h.obligationsByID {
+		contracts = append(contracts, h.contractInfo(ob))
+	}
+	sort.Sort(byWindowStart(contracts))
+	return contracts
+}
+
+// byWindowStart sorts contracts by the start of their proof windows, breaking
+// ties by ID.
+type byWindowStart []modules.HostContract
+
+func (s byWindowStart) Len() int      { return len(s) }
+func (s byWindowStart) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byWindowStart) Less(i, j int) bool {
+	if s[i].WindowStart != s[j].WindowStart {
+		return s[i].WindowStart < s[j].WindowStart
+	}
+	return s[i].ID.String() < s[j].ID.String()
+}
@@ -0,0 +1,75 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestContractObligations checks that the host reports the latest revision,
+// proof status, and storage folders of each of its contracts.
+func TestContractObligations(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestContractObligations", t)
+	h := ht.host
+
+	h.mu.Lock()
+	roots, err := h.addSectors([][]byte{[]byte("contract data")})
+	h.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := roots[0]
+	height := h.blockHeight + 20
+	obligation := func(id byte, windowStart types.BlockHeight) *contractObligation {
+		return &contractObligation{
+			ID: types.FileContractID{id},
+			FileContract: types.FileContract{
+				Payout:      types.NewCurrency64(1000),
+				WindowStart: windowStart,
+				WindowEnd:   windowStart + 10,
+			},
+		}
+	}
+	revised := obligation(1, height+5)
+	revised.LastRevisionTxn = types.Transaction{FileContractRevisions: []types.FileContractRevision{{
+		NewRevisionNumber: 3,
+		NewFileSize:       13,
+	}}}
+	revised.SectorRoots = []crypto.Hash{root, root}
+	h.mu.Lock()
+	h.blockHeight = height
+	h.obligationsByID[revised.ID] = revised
+	h.obligationsByID[types.FileContractID{2}] = obligation(2, height-5)
+	h.obligationsByID[types.FileContractID{3}] = obligation(3, height-20)
+	h.mu.Unlock()
+
+	contracts := h.ContractObligations()
+	if len(contracts) != 3 {
+		t.Fatal("expected 3 contracts, got", len(contracts))
+	}
+	expected := []struct {
+		id     types.FileContractID
+		status string
+	}{
+		{types.FileContractID{3}, modules.HostContractExpired},
+		{types.FileContractID{2}, modules.HostContractProving},
+		{types.FileContractID{1}, modules.HostContractActive},
+	}
+	for i, e := range expected {
+		if contracts[i].ID != e.id || contracts[i].ProofStatus != e.status {
+			t.Errorf("%v: expected contract %v to be %v, got %v %v", i, e.id, e.status, contracts[i].ID, contracts[i].ProofStatus)
+		}
+	}
+	c := contracts[2]
+	if c.FileSize != 13 || c.RevisionNumber != 3 || c.Payout.Cmp(types.NewCurrency64(1000)) != 0 {
+		t.Error("contract does not reflect its latest revision:", c)
+	}
+	if len(c.StorageFolders) != 1 || c.StorageFolders[0] != h.sectors[root].Folder {
+		t.Error("wrong storage folders:", c.StorageFolders)
+	}
+}
@@ -0,0 +1,276 @@
+package host
+
+// database.go contains the functions that store the host's state in a bolt
+// database. Host-wide settings are kept in a single record, while each
+// obligation and each sector has its own record, so that forming or revising
+// a contract only rewrites the records that it changes.
+//
+// Sector records are written before the sector data reaches disk, and an
+// obligation's record is written before the renter receives the host's
+// signature. If the host stops in between, the sector is not referenced by any
+// obligation and is deleted at startup.
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+const (
+	// DatabaseFilename is the name of the database that stores the host's
+	// settings, obligations, and sectors.
+	DatabaseFilename = "host.db"
+)
+
+var (
+	dbMetadata = persist.Metadata{
+		Header:  "Host Database",
+		Version: "0.5.0",
+	}
+
+	// bucketSettings is a database bucket holding the host-wide record.
+	bucketSettings = []byte("Settings")
+
+	// bucketObligations is a database bucket mapping contract IDs to
+	// obligations.
+	bucketObligations = []byte("Obligations")
+
+	// bucketSectors is a database bucket mapping Merkle roots to sectors.
+	bucketSectors = []byte("Sectors")
+
+	// keyHost is the key within the settings bucket that holds the
+	// host-wide record.
+	keyHost = []byte("Host")
+)
+
+// hostRecord contains the host-wide state stored in the settings bucket.
+type hostRecord struct {
+	BlockHeight      types.BlockHeight
+	RecentChange     modules.ConsensusChangeID
+	CollateralBudget types.Currency
+	ConnectionLimits modules.HostConnectionLimits
+	Maintenance      bool
+	PricingPolicy    modules.HostPricingPolicy
+	FinancialPeriods []modules.HostFinancialPeriod
+	HostSettings     modules.HostSettings
+	StorageFolders   []storageFolder
+	SecretKey        crypto.SecretKey
+	PublicKey        types.SiaPublicKey
+}
+
+// openDB opens the host database, creating the buckets if they do not yet
+// exist.
+func (h *Host) openDB(filename string) (err error) {
+	h.db, err = persist.OpenDatabase(dbMetadata, filename)
+	if err != nil {
+		return err
+	}
+	return h.db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{bucketSettings, bucketObligations, bucketSectors} {
+			_, err := tx.CreateBucketIfNotExists(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// dbPutHost writes the host-wide record.
+func (h *Host) dbPutHost(tx *bolt.Tx) error {
+	b, err := json.Marshal(hostRecord{
+		BlockHeight:      h.blockHeight,
+		RecentChange:     h.recentChange,
+		CollateralBudget: h.collateralBudget,
+		ConnectionLimits: h.connLimits,
+		Maintenance:      h.maintenance,
+		PricingPolicy:    h.pricingPolicy,
+		FinancialPeriods: h.financialPeriods,
+		HostSettings:     h.HostSettings,
+		StorageFolders:   h.storageFolders,
+		SecretKey:        h.secretKey,
+		PublicKey:        h.publicKey,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketSettings).Put(keyHost, b)
+}
+
+// dbPutObligation writes the record of an obligation.
+func dbPutObligation(tx *bolt.Tx, ob *contractObligation) error {
+	b, err := json.Marshal(ob)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketObligations).Put(ob.ID[:], b)
+}
+
+// dbPutSector writes the record of a sector.
+func dbPutSector(tx *bolt.Tx, s *sector) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketSectors).Put(s.Root[:], b)
+}
+
+// dbDeleteSectors deletes the records of the sectors that the host no longer
+// stores.
+func (h *Host) dbDeleteSectors(tx *bolt.Tx, roots []crypto.Hash) error {
+	for _, root := range roots {
+		if _, exists := h.sectors[root]; exists {
+			continue
+		}
+		err := tx.Bucket(bucketSectors).Delete(root[:])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveSettings writes the host-wide record to the database.
+func (h *Host) saveSettings() error {
+	return h.db.Update(h.dbPutHost)
+}
+
+// saveObligation writes an obligation to the database.
+func (h *Host) saveObligation(ob *contractObligation) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return dbPutObligation(tx, ob)
+	})
+}
+
+// deleteObligationRecord deletes the record of an obligation from the
+// database.
+func (h *Host) deleteObligationRecord(id types.FileContractID) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketObligations).Delete(id[:])
+	})
+}
+
+// saveSector writes a sector to the database.
+func (h *Host) saveSector(s *sector) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return dbPutSector(tx, s)
+	})
+}
+
+// deleteSectorRecords deletes the records of the sectors in roots that the
+// host no longer stores.
+func (h *Host) deleteSectorRecords(roots ...crypto.Hash) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		return h.dbDeleteSectors(tx, roots)
+	})
+}
+
+// saveConsensusChange writes the host-wide record and the changed
+// obligations to the database, and deletes the resolved obligations and the
+// sectors that they no longer share with other obligations, in a single
+// database transaction.
+func (h *Host) saveConsensusChange(changed, resolved []*contractObligation) error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		err := h.dbPutHost(tx)
+		if err != nil {
+			return err
+		}
+		for _, ob := range changed {
+			if _, exists := h.obligationsByID[ob.ID]; !exists {
+				continue
+			}
+			err = dbPutObligation(tx, ob)
+			if err != nil {
+				return err
+			}
+		}
+		for _, ob := range resolved {
+			err = tx.Bucket(bucketObligations).Delete(ob.ID[:])
+			if err != nil {
+				return err
+			}
+			err = h.dbDeleteSectors(tx, ob.SectorRoots)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// saveAll writes the entire state of the host to the database.
+func (h *Host) saveAll() error {
+	return h.db.Update(func(tx *bolt.Tx) error {
+		err := h.dbPutHost(tx)
+		if err != nil {
+			return err
+		}
+		for _, ob := range h.obligationsByID {
+			err = dbPutObligation(tx, ob)
+			if err != nil {
+				return err
+			}
+		}
+		for _, s := range h.sectors {
+			err = dbPutSector(tx, s)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// loadDB reads the host's state from the database. It returns
+// os.ErrNotExist if the database has no host-wide record.
+func (h *Host) loadDB() error {
+	return h.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSettings).Get(keyHost)
+		if b == nil {
+			return os.ErrNotExist
+		}
+		// Records written before a setting was added keep its default.
+		rec := hostRecord{CollateralBudget: h.collateralBudget, ConnectionLimits: h.connLimits}
+		err := json.Unmarshal(b, &rec)
+		if err != nil {
+			return err
+		}
+		h.blockHeight = rec.BlockHeight
+		h.recentChange = rec.RecentChange
+		h.collateralBudget = rec.CollateralBudget
+		h.connLimits = rec.ConnectionLimits
+		h.maintenance = rec.Maintenance
+		h.pricingPolicy = rec.PricingPolicy
+		h.financialPeriods = rec.FinancialPeriods
+		h.HostSettings = rec.HostSettings
+		h.storageFolders = rec.StorageFolders
+		h.secretKey = rec.SecretKey
+		h.publicKey = rec.PublicKey
+
+		err = tx.Bucket(bucketObligations).ForEach(func(_, v []byte) error {
+			ob := new(contractObligation)
+			if err := json.Unmarshal(v, ob); err != nil {
+				return err
+			}
+			h.obligationsByID[ob.ID] = ob
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketSectors).ForEach(func(_, v []byte) error {
+			s := new(sector)
+			if err := json.Unmarshal(v, s); err != nil {
+				return err
+			}
+			h.sectors[s.Root] = s
+			return nil
+		})
+	})
+}
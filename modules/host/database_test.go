@@ -0,0 +1,136 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestDatabasePersistence checks that the host reloads its settings,
+// obligations, and sectors from its database, and deletes sectors that no
+// obligation refers to.
+func TestDatabasePersistence(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestDatabasePersistence", t)
+	h := ht.host
+	h.SetCollateralBudget(types.NewCurrency64(123))
+
+	h.mu.Lock()
+	roots, err := h.addSectors([][]byte{[]byte("contract data")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob := &contractObligation{ID: types.FileContractID{1}, SectorRoots: roots, ProofHeight: 7}
+	h.obligationsByID[ob.ID] = ob
+	err = h.saveObligation(ob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a sector stored during a revision that was never saved
+	orphans, err := h.addSectors([][]byte{[]byte("orphaned data")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphanPath := h.sectors[orphans[0]].path()
+	h.mu.Unlock()
+
+	err = h.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := New(ht.cs, ht.tpool, ht.wallet, ":0", h.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+
+	if h2.secretKey != h.secretKey {
+		t.Error("host key was not reloaded")
+	}
+	if _, budget := h2.LockedCollateral(); budget.Cmp(types.NewCurrency64(123)) != 0 {
+		t.Error("collateral budget was not reloaded:", budget)
+	}
+	ob2, exists := h2.obligationsByID[ob.ID]
+	if !exists || ob2.ProofHeight != 7 || len(ob2.SectorRoots) != 1 {
+		t.Fatal("obligation was not reloaded:", ob2)
+	}
+	if s, exists := h2.sectors[roots[0]]; !exists || s.refs != 1 {
+		t.Fatal("sector was not reloaded")
+	}
+	if _, exists := h2.sectors[orphans[0]]; exists {
+		t.Error("orphaned sector was not deleted")
+	}
+	if _, err := os.Stat(orphanPath); !os.IsNotExist(err) {
+		t.Error("orphaned sector file was not deleted")
+	}
+}
+
+// TestMigrateLegacy checks that a host stored in settings.json is migrated to
+// the host database.
+func TestMigrateLegacy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestMigrateLegacy", t)
+	h := ht.host
+	err := h.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(filepath.Join(h.persistDir, DatabaseFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settingsFile := filepath.Join(h.persistDir, "settings.json")
+	sHost := savedHost{
+		HostSettings: h.HostSettings,
+		Obligations: []contractObligation{{
+			ID:           types.FileContractID{1},
+			FileContract: types.FileContract{WindowStart: 1000, WindowEnd: 2000},
+		}},
+		SecretKey: h.secretKey,
+		PublicKey: h.publicKey,
+		Profit:    types.NewCurrency64(50),
+	}
+	err = persist.SaveFile(persistMetadata, sHost, settingsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h2, err := New(ht.cs, ht.tpool, ht.wallet, ":0", h.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := h2.obligationsByID[types.FileContractID{1}]; !exists {
+		t.Error("obligation was not migrated")
+	}
+	if _, resolved := h2.Revenue(); resolved.Cmp(types.NewCurrency64(50)) != 0 {
+		t.Error("profit was not migrated:", resolved)
+	}
+	if _, err := os.Stat(settingsFile); !os.IsNotExist(err) {
+		t.Error("settings.json was not moved out of the way")
+	}
+	if _, err := os.Stat(settingsFile + ".bck"); err != nil {
+		t.Error("settings.json was not backed up:", err)
+	}
+
+	// the migrated host is loaded from the database
+	err = h2.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3, err := New(ht.cs, ht.tpool, ht.wallet, ":0", h.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h3.Close()
+	if _, exists := h3.obligationsByID[types.FileContractID{1}]; !exists {
+		t.Error("migrated obligation was not saved")
+	}
+}
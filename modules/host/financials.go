@@ -0,0 +1,97 @@
+package host
+
+import (
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// accountingPeriod is the number of blocks covered by each of the host's
+	// financial periods.
+	accountingPeriod = 4320 // 30 days
+)
+
+// hostPayout returns the amount that the host receives for a valid storage
+// proof, according to the obligation's latest revision.
+func hostPayout(ob *contractObligation) types.Currency {
+	outputs := ob.FileContract.ValidProofOutputs
+	// The first revision of a contract is empty.
+	if len(ob.LastRevisionTxn.FileContractRevisions) == 1 && ob.LastRevisionTxn.FileContractRevisions[0].NewRevisionNumber != 0 {
+		outputs = ob.LastRevisionTxn.FileContractRevisions[0].NewValidProofOutputs
+	}
+	if len(outputs) != 2 {
+		return types.ZeroCurrency
+	}
+	return outputs[1].Value
+}
+
+// obligationRevenue returns the revenue that the host will realize from an
+// obligation once its storage proof is confirmed, split into payments for
+// storage and payments for downloads. The host's collateral is not revenue.
+func obligationRevenue(ob *contractObligation) (storage, bandwidth types.Currency) {
+	revenue := hostPayout(ob)
+	collateral := contractCollateral(ob.FileContract)
+	if revenue.Cmp(collateral) < 0 {
+		return types.ZeroCurrency, types.ZeroCurrency
+	}
+	revenue = revenue.Sub(collateral)
+	if revenue.Cmp(ob.DownloadRevenue) < 0 {
+		return types.ZeroCurrency, revenue
+	}
+	return revenue.Sub(ob.DownloadRevenue), ob.DownloadRevenue
+}
+
+// financialPeriod returns the financial period containing a height, creating
+// it if necessary.
+func (h *Host) financialPeriod(height types.BlockHeight) *modules.HostFinancialPeriod {
+	start := height - height%accountingPeriod
+	i := sort.Search(len(h.financialPeriods), func(i int) bool {
+		return h.financialPeriods[i].StartHeight >= start
+	})
+	if i == len(h.financialPeriods) || h.financialPeriods[i].StartHeight != start {
+		h.financialPeriods = append(h.financialPeriods, modules.HostFinancialPeriod{})
+		copy(h.financialPeriods[i+1:], h.financialPeriods[i:])
+		h.financialPeriods[i] = modules.HostFinancialPeriod{
+			StartHeight: start,
+			EndHeight:   start + accountingPeriod,
+		}
+	}
+	return &h.financialPeriods[i]
+}
+
+// realizeRevenue records the revenue from an obligation whose storage proof
+// has been confirmed.
+func (h *Host) realizeRevenue(ob *contractObligation) {
+	storage, bandwidth := obligationRevenue(ob)
+	p := h.financialPeriod(h.blockHeight)
+	p.StorageRevenue = p.StorageRevenue.Add(storage)
+	p.BandwidthRevenue = p.BandwidthRevenue.Add(bandwidth)
+}
+
+// loseRevenue records the revenue and collateral lost by an obligation whose
+// proof window closed without a storage proof.
+func (h *Host) loseRevenue(ob *contractObligation) {
+	storage, bandwidth := obligationRevenue(ob)
+	p := h.financialPeriod(h.blockHeight)
+	p.LostRevenue = p.LostRevenue.Add(storage).Add(bandwidth)
+	p.LostCollateral = p.LostCollateral.Add(contractCollateral(ob.FileContract))
+}
+
+// Financials returns the host's potential revenue from unresolved file
+// contracts and its realized revenue in each accounting period.
+func (h *Host) Financials() modules.HostFinancials {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var fin modules.HostFinancials
+	for _, ob := range h.obligationsByID {
+		storage, bandwidth := obligationRevenue(ob)
+		fin.PotentialStorageRevenue = fin.PotentialStorageRevenue.Add(storage)
+		fin.PotentialBandwidthRevenue = fin.PotentialBandwidthRevenue.Add(bandwidth)
+	}
+	fin.LockedCollateral = h.lockedCollateral()
+	fin.Periods = make([]modules.HostFinancialPeriod, len(h.financialPeriods))
+	copy(fin.Periods, h.financialPeriods)
+	return fin
+}
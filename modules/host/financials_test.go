@@ -0,0 +1,74 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestFinancials checks that the host splits contract revenue into storage
+// and bandwidth revenue, and records it in the right accounting period.
+func TestFinancials(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestFinancials", t)
+	h := ht.host
+
+	// obligation returns an obligation whose host payout includes 100
+	// hastings of collateral and 30 hastings of download payments.
+	obligation := func(id byte) *contractObligation {
+		fc := types.FileContract{
+			ValidProofOutputs: []types.SiacoinOutput{{Value: types.NewCurrency64(1000)}, {Value: types.NewCurrency64(100)}},
+		}
+		rev := types.FileContractRevision{
+			NewRevisionNumber:    2,
+			NewValidProofOutputs: []types.SiacoinOutput{{Value: types.NewCurrency64(850)}, {Value: types.NewCurrency64(250)}},
+		}
+		return &contractObligation{
+			ID:              types.FileContractID{id},
+			FileContract:    fc,
+			LastRevisionTxn: types.Transaction{FileContractRevisions: []types.FileContractRevision{rev}},
+			DownloadRevenue: types.NewCurrency64(30),
+		}
+	}
+	storage, bandwidth := obligationRevenue(obligation(1))
+	if storage.Cmp(types.NewCurrency64(120)) != 0 || bandwidth.Cmp(types.NewCurrency64(30)) != 0 {
+		t.Fatal("wrong obligation revenue:", storage, bandwidth)
+	}
+
+	h.mu.Lock()
+	h.obligationsByID[types.FileContractID{1}] = obligation(1)
+	h.blockHeight = 2*accountingPeriod + 5
+	h.realizeRevenue(obligation(2))
+	h.blockHeight = accountingPeriod - 1
+	h.loseRevenue(obligation(3))
+	h.mu.Unlock()
+
+	fin := h.Financials()
+	if fin.PotentialStorageRevenue.Cmp(types.NewCurrency64(120)) != 0 || fin.PotentialBandwidthRevenue.Cmp(types.NewCurrency64(30)) != 0 {
+		t.Error("wrong potential revenue:", fin.PotentialStorageRevenue, fin.PotentialBandwidthRevenue)
+	}
+	if fin.LockedCollateral.Cmp(types.NewCurrency64(100)) != 0 {
+		t.Error("wrong locked collateral:", fin.LockedCollateral)
+	}
+	if len(fin.Periods) != 2 {
+		t.Fatal("expected 2 periods, got", len(fin.Periods))
+	}
+	lost, realized := fin.Periods[0], fin.Periods[1]
+	if lost.StartHeight != 0 || lost.EndHeight != accountingPeriod {
+		t.Error("wrong bounds for the first period:", lost.StartHeight, lost.EndHeight)
+	}
+	if lost.LostRevenue.Cmp(types.NewCurrency64(150)) != 0 || lost.LostCollateral.Cmp(types.NewCurrency64(100)) != 0 {
+		t.Error("wrong lost revenue or collateral:", lost.LostRevenue, lost.LostCollateral)
+	}
+	if realized.StartHeight != 2*accountingPeriod {
+		t.Error("wrong start of the second period:", realized.StartHeight)
+	}
+	if realized.StorageRevenue.Cmp(types.NewCurrency64(120)) != 0 || realized.BandwidthRevenue.Cmp(types.NewCurrency64(30)) != 0 {
+		t.Error("wrong realized revenue:", realized.StorageRevenue, realized.BandwidthRevenue)
+	}
+	if _, resolved := h.Revenue(); resolved.Cmp(types.NewCurrency64(150)) != 0 {
+		t.Error("wrong resolved revenue:", resolved)
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"log"
 	"net"
 	"sync"
+	"time"
 
+	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -17,10 +20,20 @@ const (
 	// of a reorg.
 	StorageProofReorgDepth = 10
 	maxContractLen         = 1 << 16 // The maximum allowed size of a file contract coming in over the wire. This does not include the file.
+
+	// storageProofRetryInterval is how many blocks the host waits for a
+	// storage proof to be confirmed before submitting it again.
+	storageProofRetryInterval = 5
 )
 
 var (
-	defaultPrice = types.SiacoinPrecision.Div(types.NewCurrency64(4320e9 / 200)) // 200 SC / GB / Month
+	// rpcDrainTimeout is how long Close waits for in-flight RPCs to finish.
+	rpcDrainTimeout = 30 * time.Second
+)
+
+var (
+	defaultPrice         = types.SiacoinPrecision.Div(types.NewCurrency64(4320e9 / 200)) // 200 SC / GB / Month
+	defaultDownloadPrice = types.SiacoinPrecision.Div(types.NewCurrency64(1e9 / 10))     // 10 SC / GB
 )
 
 // A contractObligation tracks a file contract that the host is obligated to
@@ -29,7 +42,34 @@ type contractObligation struct {
 	ID              types.FileContractID
 	FileContract    types.FileContract
 	LastRevisionTxn types.Transaction
-	Path            string // Where on disk the file is stored.
+	SectorRoots     []crypto.Hash // Merkle roots of the contract's data, in order.
+
+	// Path is where the contract's data was stored before the host stored
+	// data in sectors. Such files are converted to sectors at startup.
+	Path string
+
+	// FormationHeight is the height at which the host formed the contract.
+	// It is 0 for contracts formed before the field was added.
+	FormationHeight types.BlockHeight
+
+	// Price is the host's storage price when the contract was formed.
+	// Revisions are priced at this rate, so that adjusting the price only
+	// affects new contracts. It is zero for contracts formed before the
+	// field was added, which are revised at the current price.
+	Price types.Currency
+
+	// ProofHeight is the height of the block containing the contract's
+	// storage proof, or 0 if no proof has been confirmed. proofAttempt is the
+	// height at which the host last tried to submit a proof, and
+	// proofSubmitted reports whether that proof was accepted by the
+	// transaction pool.
+	ProofHeight    types.BlockHeight
+	proofAttempt   types.BlockHeight
+	proofSubmitted bool
+
+	// DownloadRevenue is the amount that renters have paid the host to
+	// download the contract's data.
+	DownloadRevenue types.Currency
 
 	// revisions must happen in serial
 	mu sync.Mutex
@@ -44,24 +84,57 @@ type Host struct {
 	wallet modules.Wallet
 
 	// File management.
-	fileCounter         int
-	obligationsByID     map[types.FileContractID]*contractObligation
-	obligationsByHeight map[types.BlockHeight][]*contractObligation
-	profit              types.Currency
-	spaceRemaining      int64
+	obligationsByID  map[types.FileContractID]*contractObligation
+	collateralBudget types.Currency
+	financialPeriods []modules.HostFinancialPeriod
+	sectors          map[crypto.Hash]*sector
+	storageFolders   []storageFolder
+
+	// reservedCollateral is the collateral of contracts that are still being
+	// negotiated, which counts against the budget in addition to the
+	// collateral of the host's obligations.
+	reservedCollateral types.Currency
+
+	// Data integrity. corruptContracts maps the contracts whose data failed
+	// the last scrub to the reason.
+	corruptContracts map[types.FileContractID]string
+	lastScrub        time.Time
+	scrubbing        bool
+
+	// Connection limits. connsByIP counts the open connections from each IP
+	// address, and rpcCalls the RPCs called by each IP address since
+	// rpcWindowStart.
+	connLimits     modules.HostConnectionLimits
+	connMetrics    modules.HostConnectionMetrics
+	connsByIP      map[string]int
+	rpcCalls       map[rpcKey]int
+	rpcWindowStart time.Time
+
+	// Pricing. lastPriceAdjustment is the height at which the host last
+	// adjusted its storage price according to pricingPolicy.
+	lastPriceAdjustment types.BlockHeight
+	pricingPolicy       modules.HostPricingPolicy
 
 	// Persistent settings.
-	blockHeight types.BlockHeight
-	netAddr     modules.NetAddress
-	secretKey   crypto.SecretKey
-	publicKey   types.SiaPublicKey
+	blockHeight  types.BlockHeight
+	recentChange modules.ConsensusChangeID
+	maintenance  bool
+	netAddr      modules.NetAddress
+	secretKey    crypto.SecretKey
+	publicKey    types.SiaPublicKey
 	modules.HostSettings
 
-	// Utilities.
+	// Utilities. rpcs counts the RPCs in progress and conns holds their
+	// connections. closing is set once Close has been called, after which no
+	// new RPCs are started.
+	closing    bool
+	conns      map[net.Conn]struct{}
+	db         *persist.BoltDatabase
 	listener   net.Listener
 	log        *log.Logger
 	mu         sync.RWMutex
 	persistDir string
+	rpcs       sync.WaitGroup
 }
 
 // New returns an initialized Host.
@@ -89,14 +162,24 @@ func New(cs modules.ConsensusSet, tpool modules.TransactionPool, wallet modules.
 			WindowSize:   288,          // 48 hours
 			Price:        defaultPrice, // 200 SC / GB / Month
 			Collateral:   types.NewCurrency64(0),
+
+			DownloadPrice: defaultDownloadPrice, // 10 SC / GB
 		},
 
 		persistDir: persistDir,
 
-		obligationsByID:     make(map[types.FileContractID]*contractObligation),
-		obligationsByHeight: make(map[types.BlockHeight][]*contractObligation),
+		collateralBudget: defaultCollateralBudget,
+		connLimits:       defaultConnectionLimits,
+		conns:            make(map[net.Conn]struct{}),
+		connsByIP:        make(map[string]int),
+		corruptContracts: make(map[types.FileContractID]string),
+		obligationsByID:  make(map[types.FileContractID]*contractObligation),
+		rpcCalls:         make(map[rpcKey]int),
+		sectors:          make(map[crypto.Hash]*sector),
 	}
-	h.spaceRemaining = h.TotalStorage
+	// Contract data is kept in the persist directory until other storage
+	// folders are added.
+	h.storageFolders = []storageFolder{{Path: persistDir, Size: h.TotalStorage}}
 
 	// Generate signing key, for revising contracts.
 	sk, pk, err := crypto.StdKeyGen.Generate()
@@ -131,7 +214,23 @@ func New(cs modules.ConsensusSet, tpool modules.TransactionPool, wallet modules.
 	// spawn listener
 	go h.listen()
 
-	h.cs.ConsensusSetSubscribe(h)
+	// Periodically check the contract data for corruption.
+	go h.threadedScrub()
+
+	// Resume from the last consensus change that the host processed. If the
+	// consensus set no longer knows about that change, rescan the blockchain.
+	err = h.cs.ConsensusSetPersistentSubscribe(h, h.recentChange)
+	if err != nil {
+		h.log.Println("WARN: could not resume from the last consensus change, rescanning the blockchain:", err)
+		h.mu.Lock()
+		h.blockHeight = 0
+		h.recentChange = modules.ConsensusChangeID{}
+		h.mu.Unlock()
+		err = h.cs.ConsensusSetPersistentSubscribe(h, modules.ConsensusChangeID{})
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return h, nil
 }
@@ -142,7 +241,7 @@ func New(cs modules.ConsensusSet, tpool modules.TransactionPool, wallet modules.
 func (h *Host) Capacity() int64 {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	return h.spaceRemaining
+	return h.capacity()
 }
 
 // Contracts returns the number of unresolved file contracts that the host is
@@ -165,39 +264,90 @@ func (h *Host) NetAddress() modules.NetAddress {
 func (h *Host) Revenue() (unresolved, resolved types.Currency) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	for _, obligation := range h.obligationsByID {
-		fc := obligation.FileContract
-		unresolved = unresolved.Add(types.PostTax(h.blockHeight, fc.Payout))
+	for _, ob := range h.obligationsByID {
+		storage, bandwidth := obligationRevenue(ob)
+		unresolved = unresolved.Add(storage).Add(bandwidth)
+	}
+	for _, p := range h.financialPeriods {
+		resolved = resolved.Add(p.StorageRevenue).Add(p.BandwidthRevenue)
 	}
-	return unresolved, h.profit
+	return unresolved, resolved
 }
 
-// SetSettings updates the host's internal HostSettings object.
+// SetSettings updates the host's internal HostSettings object. The total
+// storage is the combined size of the storage folders; changing it resizes the
+// storage folder of a host that has only one, and is otherwise ignored. Like
+// ResizeStorageFolder, a size too small for the folder's data is ignored.
 func (h *Host) SetSettings(settings modules.HostSettings) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.spaceRemaining += settings.TotalStorage - h.TotalStorage
+	if settings.TotalStorage != h.TotalStorage {
+		if len(h.storageFolders) != 1 {
+			h.log.Println("WARN: ignoring change to total storage of a host with multiple storage folders")
+			settings.TotalStorage = h.TotalStorage
+		} else if err := h.checkFolderSize(0, settings.TotalStorage); err != nil {
+			h.log.Println("WARN: ignoring change to total storage:", err)
+			settings.TotalStorage = h.TotalStorage
+		} else {
+			h.storageFolders[0].Size = settings.TotalStorage
+		}
+	}
 	h.HostSettings = settings
-	h.save()
+	h.saveSettings()
 }
 
 // Settings returns the settings of a host.
 func (h *Host) Settings() modules.HostSettings {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	return h.HostSettings
+	settings := h.HostSettings
+	settings.Version = build.Version
+	settings.RemainingStorage = h.capacity()
+	return settings
 }
 
-// Close saves the state of the Gateway and stops its listener process.
+// Close stops the host's listener, waits up to rpcDrainTimeout for in-flight
+// RPCs to finish, and then saves the state of the host and closes its
+// database. RPCs that are still running after rpcDrainTimeout have their
+// connections closed, and the database is closed once they return.
 func (h *Host) Close() error {
-	h.mu.RLock()
+	h.mu.Lock()
+	h.closing = true
+	h.mu.Unlock()
+
+	// shut down the listener
+	listenErr := h.listener.Close()
+	// clear the port mapping (no effect if UPnP not supported)
+	h.clearPort(h.netAddr.Port())
+
+	drained := make(chan struct{})
+	go func() {
+		h.rpcs.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(rpcDrainTimeout):
+		// Closing the connections makes the remaining RPCs fail, including
+		// those waiting for a contract that is locked by another RPC.
+		h.log.Println("WARN: closing the connections of RPCs that did not finish")
+		h.mu.Lock()
+		for conn := range h.conns {
+			conn.Close()
+		}
+		h.mu.Unlock()
+		<-drained
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	// save the latest host state
-	if err := h.save(); err != nil {
+	err := h.saveSettings()
+	if err == nil {
+		err = h.db.Close()
+	}
+	if err != nil {
 		return err
 	}
-	h.mu.RUnlock()
-	// clear the port mapping (no effect if UPnP not supported)
-	h.clearPort(h.netAddr.Port())
-	// shut down the listener
-	return h.listener.Close()
+	return listenErr
 }
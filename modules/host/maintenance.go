@@ -0,0 +1,29 @@
+package host
+
+import (
+	"errors"
+)
+
+var (
+	errMaintenanceMode = errors.New("host is in maintenance mode and is not accepting new contracts")
+)
+
+// Maintenance reports whether the host is in maintenance mode.
+func (h *Host) Maintenance() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.maintenance
+}
+
+// SetMaintenance puts the host in or takes it out of maintenance mode. In
+// maintenance mode the host rejects new file contracts, but continues to
+// revise existing contracts, serve downloads, and submit storage proofs.
+func (h *Host) SetMaintenance(maintenance bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if maintenance != h.maintenance {
+		h.log.Println("INFO: maintenance mode set to", maintenance)
+	}
+	h.maintenance = maintenance
+	h.saveSettings()
+}
@@ -0,0 +1,147 @@
+package host
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestMaintenance checks that a host in maintenance mode rejects new
+// contracts, and stays in maintenance mode after restarting.
+func TestMaintenance(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestMaintenance", t)
+	h := ht.host
+
+	txn := types.Transaction{FileContracts: []types.FileContract{{}}}
+	h.SetMaintenance(true)
+	h.mu.RLock()
+	err := h.considerContract(txn, types.SiaPublicKey{})
+	h.mu.RUnlock()
+	if err != errMaintenanceMode {
+		t.Fatal("expected errMaintenanceMode, got", err)
+	}
+
+	err = h.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := New(ht.cs, ht.tpool, ht.wallet, ":0", h.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+	if !h2.Maintenance() {
+		t.Fatal("maintenance mode was not reloaded")
+	}
+	h2.SetMaintenance(false)
+	h2.mu.RLock()
+	err = h2.considerContract(txn, types.SiaPublicKey{})
+	h2.mu.RUnlock()
+	if err == errMaintenanceMode {
+		t.Fatal("host is still in maintenance mode")
+	}
+}
+
+// TestCloseDrainsRPCs checks that closing the host waits for in-flight RPCs
+// to finish.
+func TestCloseDrainsRPCs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestCloseDrainsRPCs", t)
+	h := ht.host
+
+	conn, err := net.Dial("tcp", string(h.netAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = encoding.WriteObject(conn, modules.RPCLastRevision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// give the host time to start the RPC
+	time.Sleep(100 * time.Millisecond)
+
+	// finish the RPC while the host is closing
+	const delay = 300 * time.Millisecond
+	go func() {
+		time.Sleep(delay)
+		encoding.WriteObject(conn, types.FileContractID{})
+		var challenge crypto.Hash
+		encoding.ReadObject(conn, &challenge, crypto.HashSize)
+		encoding.WriteObject(conn, crypto.Signature{})
+	}()
+	start := time.Now()
+	err = h.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < delay {
+		t.Fatal("host closed before the RPC finished")
+	}
+	var resp string
+	err = encoding.ReadObject(conn, &resp, 128)
+	if err != nil || resp != "no record of that contract" {
+		t.Fatal("RPC did not finish:", resp, err)
+	}
+
+	// the host accepts no new RPCs once closed
+	if _, err := net.Dial("tcp", string(h.netAddr)); err == nil {
+		t.Fatal("host accepted a connection after closing")
+	}
+}
+
+// TestCloseStalledRPCs checks that Close closes the connections of RPCs that
+// outlast rpcDrainTimeout, and waits for those RPCs to return.
+func TestCloseStalledRPCs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestCloseStalledRPCs", t)
+	h := ht.host
+
+	oldTimeout := rpcDrainTimeout
+	rpcDrainTimeout = 100 * time.Millisecond
+	defer func() {
+		rpcDrainTimeout = oldTimeout
+	}()
+
+	// start an RPC that never finishes
+	conn, err := net.Dial("tcp", string(h.netAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = encoding.WriteObject(conn, modules.RPCRevise)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// give the host time to start the RPC
+	time.Sleep(100 * time.Millisecond)
+
+	err = h.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.mu.RLock()
+	open := len(h.conns)
+	h.mu.RUnlock()
+	if open != 0 {
+		t.Fatal("host closed with open connections:", open)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("stalled RPC was not closed")
+	} else if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		t.Fatal("connection of the stalled RPC is still open")
+	}
+}
@@ -1,13 +1,9 @@
 package host
 
 import (
-	"bytes"
 	"errors"
 	"io"
 	"net"
-	"os"
-	"path/filepath"
-	"strconv"
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -25,16 +21,6 @@ var (
 	HostCapacityErr = errors.New("host is at capacity and cannot take more files")
 )
 
-// deallocate deletes a file and restores its allocated space.
-func (h *Host) deallocate(path string) error {
-	stat, err := os.Stat(path)
-	if err != nil {
-		return err
-	}
-	h.spaceRemaining += stat.Size()
-	return os.Remove(path)
-}
-
 // considerContract checks that the provided transaction matches the host's
 // terms, and doesn't contain any flagrant errors.
 func (h *Host) considerContract(txn types.Transaction, renterKey types.SiaPublicKey) error {
@@ -50,6 +36,12 @@ func (h *Host) considerContract(txn types.Transaction, renterKey types.SiaPublic
 
 	// check contract fields for sanity and acceptability
 	switch {
+	case h.maintenance:
+		return errMaintenanceMode
+
+	case h.emptiestStorageFolder() == nil:
+		return HostCapacityErr
+
 	case fc.FileSize != 0:
 		return errors.New("initial file size must be 0")
 
@@ -77,14 +69,14 @@ func (h *Host) considerContract(txn types.Transaction, renterKey types.SiaPublic
 	case len(fc.MissedProofOutputs) != 2:
 		return errors.New("bad file contract missed proof outputs")
 
-	case !fc.ValidProofOutputs[1].Value.IsZero(), !fc.MissedProofOutputs[1].Value.IsZero():
-		return errors.New("file contract collateral is not zero")
-
 	case fc.ValidProofOutputs[1].UnlockHash != h.UnlockHash:
 		return errors.New("file contract valid proof output not sent to host")
 	case fc.MissedProofOutputs[1].UnlockHash != voidAddress:
 		return errors.New("file contract missed proof output not sent to void")
 	}
+	if err := h.considerCollateral(fc); err != nil {
+		return err
+	}
 
 	// check unlock hash
 	uc := types.UnlockConditions{
@@ -117,7 +109,14 @@ func (h *Host) considerRevision(txn types.Transaction, obligation contractObliga
 	lastRev := obligation.LastRevisionTxn.FileContractRevisions[0]
 	fc := obligation.FileContract
 	duration := types.NewCurrency64(uint64(fc.WindowStart - h.blockHeight))
-	minHostPrice := types.NewCurrency64(rev.NewFileSize).Mul(duration).Mul(h.Price)
+	price := obligation.Price
+	if price.IsZero() {
+		price = h.Price
+	}
+	minHostPrice := types.NewCurrency64(rev.NewFileSize).Mul(duration).Mul(price)
+	// the host's output also holds the collateral, which the renter cannot
+	// use to pay for storage
+	minHostPrice = minHostPrice.Add(contractCollateral(fc))
 	expectedPayout := types.PostTax(h.blockHeight, fc.Payout)
 
 	switch {
@@ -143,12 +142,14 @@ func (h *Host) considerRevision(txn types.Transaction, obligation contractObliga
 	case rev.NewRevisionNumber <= lastRev.NewRevisionNumber:
 		return errors.New("revision must have higher revision number")
 
-	case rev.NewFileSize > uint64(h.spaceRemaining) || rev.NewFileSize > h.MaxFilesize:
+	case rev.NewFileSize > h.MaxFilesize:
 		return errors.New("revision file size is too large")
 	case rev.NewFileSize <= lastRev.NewFileSize:
 		return errors.New("revision must add data")
 	case rev.NewFileSize-lastRev.NewFileSize > maxRevisionSize:
 		return errors.New("revision adds too much data")
+	case int64(rev.NewFileSize-lastRev.NewFileSize) > h.capacity():
+		return errors.New("host does not have enough space for revision")
 
 	// valid and missing outputs should still sum to payout
 	case rev.NewValidProofOutputs[0].Value.Add(rev.NewValidProofOutputs[1].Value).Cmp(expectedPayout) != 0,
@@ -156,7 +157,7 @@ func (h *Host) considerRevision(txn types.Transaction, obligation contractObliga
 		return errors.New("revision outputs do not sum to original payout")
 
 	// outputs should have been adjusted proportional to the new filesize
-	case rev.NewValidProofOutputs[1].Value.Cmp(minHostPrice) <= 0:
+	case rev.NewValidProofOutputs[1].Value.Cmp(minHostPrice) < 0:
 		return errors.New("revision price is too small")
 	case rev.NewMissedProofOutputs[0].Value.Cmp(rev.NewValidProofOutputs[0].Value) != 0:
 		return errors.New("revision missed renter payout does not match valid payout")
@@ -192,49 +193,101 @@ func (h *Host) rpcUpload(conn net.Conn) error {
 	}
 
 	// check the contract transaction, which should be the last txn in the set.
+	// The collateral is reserved under the same lock as the check, so that
+	// concurrent negotiations cannot exceed the collateral budget.
 	contractTxn := unsignedTxnSet[len(unsignedTxnSet)-1]
-	h.mu.RLock()
+	h.mu.Lock()
 	err := h.considerContract(contractTxn, renterKey)
-	h.mu.RUnlock()
+	if err == nil {
+		h.reserveCollateral(contractTxn.FileContracts[0])
+	}
+	h.mu.Unlock()
 	if err != nil {
 		encoding.WriteObject(conn, err.Error())
 		return errors.New("rejected file contract: " + err.Error())
 	}
+	reserved := true
+	defer func() {
+		if reserved {
+			h.mu.Lock()
+			h.releaseCollateral(contractTxn.FileContracts[0])
+			h.mu.Unlock()
+		}
+	}()
+
+	// fund the collateral from the host's wallet
+	parents := append([]types.Transaction(nil), unsignedTxnSet[:len(unsignedTxnSet)-1]...)
+	txnBuilder := h.wallet.RegisterTransaction(contractTxn, parents)
+	if collateral := contractCollateral(contractTxn.FileContracts[0]); !collateral.IsZero() {
+		err = txnBuilder.FundSiacoins(collateral)
+		if err != nil {
+			encoding.WriteObject(conn, "host could not fund collateral")
+			return errors.New("couldn't fund collateral: " + err.Error())
+		}
+	}
 
 	// send acceptance
 	if err := encoding.WriteObject(conn, modules.AcceptResponse); err != nil {
+		txnBuilder.Drop()
 		return errors.New("couldn't write acceptance: " + err.Error())
 	}
 
-	// add collateral to txn and send. For now, we never add collateral, so no
-	// changes are made.
-	if err := encoding.WriteObject(conn, unsignedTxnSet); err != nil {
+	// send the transaction set with the collateral added
+	collateralTxn, collateralParents := txnBuilder.View()
+	collateralTxnSet := append(collateralParents, collateralTxn)
+	if err := encoding.WriteObject(conn, collateralTxnSet); err != nil {
+		txnBuilder.Drop()
 		return errors.New("couldn't write collateral transaction set: " + err.Error())
 	}
 
 	// read signed transaction set
 	var signedTxnSet []types.Transaction
 	if err := encoding.ReadObject(conn, &signedTxnSet, maxContractLen); err != nil {
+		txnBuilder.Drop()
 		return errors.New("couldn't read signed transaction set:" + err.Error())
 	}
 
 	// check that transaction set was not modified
-	if len(signedTxnSet) != len(unsignedTxnSet) {
+	if len(signedTxnSet) != len(collateralTxnSet) {
+		txnBuilder.Drop()
 		return errors.New("renter sent bad signed transaction set")
 	}
 	for i := range signedTxnSet {
-		if signedTxnSet[i].ID() != unsignedTxnSet[i].ID() {
+		if signedTxnSet[i].ID() != collateralTxnSet[i].ID() {
+			txnBuilder.Drop()
 			return errors.New("renter sent bad signed transaction set")
 		}
 	}
 
-	// sign and submit to blockchain
-	signedTxn, parents := signedTxnSet[len(signedTxnSet)-1], signedTxnSet[:len(signedTxnSet)-1]
-	txnBuilder := h.wallet.RegisterTransaction(signedTxn, parents)
+	// add the renter's signatures, then sign and submit to blockchain
+	for _, sig := range signedTxnSet[len(signedTxnSet)-1].TransactionSignatures {
+		txnBuilder.AddTransactionSignature(sig)
+	}
 	signedTxnSet, err = txnBuilder.Sign(true)
 	if err != nil {
+		txnBuilder.Drop()
 		return err
 	}
+
+	// Save a record of this contract before submitting it, so that the host
+	// cannot lose track of a contract that it has signed. If the transaction
+	// pool rejects the contract, the record is deleted.
+	h.mu.RLock()
+	co := &contractObligation{
+		// the contract ID depends on the inputs that fund the collateral
+		ID:              signedTxnSet[len(signedTxnSet)-1].FileContractID(0),
+		FileContract:    contractTxn.FileContracts[0],
+		FormationHeight: h.blockHeight,
+		Price:           h.Price,
+	}
+	h.mu.RUnlock()
+	// first revision is empty
+	co.LastRevisionTxn.FileContractRevisions = []types.FileContractRevision{{}}
+	if err := h.saveObligation(co); err != nil {
+		txnBuilder.Drop()
+		return errors.New("couldn't save obligation: " + err.Error())
+	}
+
 	err = h.tpool.AcceptTransactionSet(signedTxnSet)
 	if err == modules.ErrDuplicateTransactionSet {
 		// this can happen if the host is uploading to itself
@@ -244,24 +297,19 @@ func (h *Host) rpcUpload(conn net.Conn) error {
 		err = nil
 	}
 	if err != nil {
+		if dbErr := h.deleteObligationRecord(co.ID); dbErr != nil {
+			h.log.Printf("WARN: couldn't delete record of rejected contract %v: %v", co.ID, dbErr)
+		}
+		txnBuilder.Drop()
 		return err
 	}
 
-	// Add this contract to the host's list of obligations.
-	// TODO: is there a race condition here?
+	// Add this contract to the host's list of obligations, whose collateral
+	// replaces the reservation.
 	h.mu.Lock()
-	h.fileCounter++
-	co := &contractObligation{
-		ID:           contractTxn.FileContractID(0),
-		FileContract: contractTxn.FileContracts[0],
-		Path:         filepath.Join(h.persistDir, strconv.Itoa(h.fileCounter)),
-	}
-	// first revision is empty
-	co.LastRevisionTxn.FileContractRevisions = []types.FileContractRevision{{}}
-	proofHeight := co.FileContract.WindowStart + StorageProofReorgDepth
-	h.obligationsByHeight[proofHeight] = append(h.obligationsByHeight[proofHeight], co)
 	h.obligationsByID[co.ID] = co
-	h.save()
+	h.releaseCollateral(contractTxn.FileContracts[0])
+	reserved = false
 	h.mu.Unlock()
 
 	// send doubly-signed transaction set
@@ -281,7 +329,7 @@ func (h *Host) rpcRevise(conn net.Conn) error {
 		return errors.New("couldn't read contract ID: " + err.Error())
 	}
 
-	// remove conn deadline while we wait for lock and rebuild the Merkle tree
+	// remove conn deadline while we wait for lock
 	conn.SetDeadline(time.Time{})
 
 	h.mu.RLock()
@@ -297,20 +345,6 @@ func (h *Host) rpcRevise(conn net.Conn) error {
 	obligation.mu.Lock()
 	defer obligation.mu.Unlock()
 
-	// open the file in append mode
-	file, err := os.OpenFile(obligation.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0660)
-	if err != nil {
-		return err
-	}
-
-	// rebuild current Merkle tree
-	tree := crypto.NewTree()
-	err = tree.ReadSegments(file)
-	if err != nil {
-		file.Close()
-		return err
-	}
-
 	// accept new revisions in a loop. The final good transaction will be
 	// submitted to the blockchain.
 	revisionErr := func() error {
@@ -355,12 +389,39 @@ func (h *Host) rpcRevise(conn net.Conn) error {
 				return errors.New("couldn't read piece data: " + err.Error())
 			}
 
-			// verify Merkle root
-			err = tree.ReadSegments(bytes.NewReader(piece))
+			// The piece is appended to the contract's last sector if that
+			// sector is not full.
+			oldRoots := obligation.SectorRoots
+			data := piece
+			if last.NewFileSize%sectorSize != 0 {
+				partial, err := h.readSector(oldRoots[len(oldRoots)-1])
+				if err != nil {
+					return errors.New("couldn't read last sector: " + err.Error())
+				}
+				data = append(partial, piece...)
+				oldRoots = oldRoots[:len(oldRoots)-1]
+			}
+
+			// store the new sectors and verify the Merkle root using the
+			// cached roots of the existing sectors
+			h.mu.Lock()
+			added, err := h.addSectors(splitSectors(data))
+			h.mu.Unlock()
 			if err != nil {
-				return errors.New("couldn't verify Merkle root: " + err.Error())
+				return errors.New("couldn't store piece: " + err.Error())
 			}
-			if tree.Root() != rev.NewFileMerkleRoot {
+			newRoots := append(append([]crypto.Hash(nil), oldRoots...), added...)
+			// removeAdded discards the new sectors if the revision fails.
+			removeAdded := func() {
+				h.mu.Lock()
+				for _, root := range added {
+					h.removeSector(root)
+				}
+				h.deleteSectorRecords(added...)
+				h.mu.Unlock()
+			}
+			if crypto.CachedMerkleRoot(newRoots) != rev.NewFileMerkleRoot {
+				removeAdded()
 				return errors.New("revision has bad Merkle root")
 			}
 
@@ -372,37 +433,45 @@ func (h *Host) rpcRevise(conn net.Conn) error {
 			})
 			encodedSig, err := crypto.SignHash(revTxn.SigHash(1), h.secretKey)
 			if err != nil {
+				removeAdded()
 				return err
 			}
 			revTxn.TransactionSignatures[1].Signature = encodedSig[:]
 
+			// save the updated obligation before the renter receives the
+			// signed revision. The replaced partial sector is only dropped
+			// once the obligation no longer refers to it.
+			h.mu.Lock()
+			lastRoots, lastRevisionTxn := obligation.SectorRoots, obligation.LastRevisionTxn
+			obligation.SectorRoots = newRoots
+			obligation.LastRevisionTxn = revTxn
+			err = h.saveObligation(obligation)
+			if err != nil {
+				obligation.SectorRoots, obligation.LastRevisionTxn = lastRoots, lastRevisionTxn
+				h.mu.Unlock()
+				removeAdded()
+				return errors.New("couldn't save revision: " + err.Error())
+			}
+			if len(oldRoots) < len(lastRoots) {
+				replaced := lastRoots[len(oldRoots)]
+				h.removeSector(replaced)
+				h.deleteSectorRecords(replaced)
+			}
+			h.mu.Unlock()
+
 			// send the signed transaction
 			if err := encoding.WriteObject(conn, revTxn); err != nil {
 				return errors.New("couldn't write signed revision transaction: " + err.Error())
 			}
-
-			// append piece to file
-			if _, err := file.Write(piece); err != nil {
-				return errors.New("couldn't write new data to file: " + err.Error())
-			}
-
-			// save updated obligation to disk
-			h.mu.Lock()
-			obligation.LastRevisionTxn = revTxn
-			h.spaceRemaining -= int64(len(piece))
-			h.save()
-			h.mu.Unlock()
 		}
 	}()
-	file.Close()
 
-	// if a newly-created file was not updated, remove it
+	// a newly-created contract that was not updated has nothing to submit
 	if obligation.LastRevisionTxn.FileContractRevisions[0].NewRevisionNumber == 0 {
-		os.Remove(obligation.Path)
 		return revisionErr
 	}
 
-	err = h.tpool.AcceptTransactionSet([]types.Transaction{obligation.LastRevisionTxn})
+	err := h.tpool.AcceptTransactionSet([]types.Transaction{obligation.LastRevisionTxn})
 	if err != nil {
 		h.log.Println("WARN: transaction pool rejected revision transaction: " + err.Error())
 	}
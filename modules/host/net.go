@@ -1,9 +1,12 @@
 package host
 
 import (
+	"crypto/rand"
+	"errors"
 	"net"
 	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -16,12 +19,37 @@ func (h *Host) listen() {
 		if err != nil {
 			return
 		}
-		go h.handleConn(conn)
+		// Close waits for the RPCs that were started before it was called.
+		// Connections that exceed the host's limits are dropped.
+		ip := remoteIP(conn)
+		h.mu.Lock()
+		if h.closing {
+			h.mu.Unlock()
+			conn.Close()
+			return
+		}
+		if !h.acquireConn(ip) {
+			h.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		h.rpcs.Add(1)
+		h.conns[conn] = struct{}{}
+		h.mu.Unlock()
+		go h.handleConn(conn, ip)
 	}
 }
 
-// handleConn handles an incoming connection to the host, typically an RPC.
-func (h *Host) handleConn(conn net.Conn) {
+// handleConn handles an incoming connection to the host from ip, typically an
+// RPC.
+func (h *Host) handleConn(conn net.Conn, ip string) {
+	defer h.rpcs.Done()
+	defer h.releaseConn(ip)
+	defer func() {
+		h.mu.Lock()
+		delete(h.conns, conn)
+		h.mu.Unlock()
+	}()
 	defer conn.Close()
 	// Set an initial duration that is generous, but finite. RPCs can extend
 	// this if so desired.
@@ -31,6 +59,9 @@ func (h *Host) handleConn(conn net.Conn) {
 	if err := encoding.ReadObject(conn, &id, 16); err != nil {
 		return
 	}
+	if !h.allowRPC(ip, id) {
+		return
+	}
 	var err error
 	switch id {
 	case modules.RPCSettings:
@@ -41,6 +72,10 @@ func (h *Host) handleConn(conn net.Conn) {
 		err = h.rpcRevise(conn)
 	case modules.RPCDownload:
 		err = h.rpcDownload(conn)
+	case modules.RPCLastRevision:
+		err = h.rpcLastRevision(conn)
+	case modules.RPCKeyProof:
+		err = h.rpcKeyProof(conn)
 	default:
 		h.log.Printf("WARN: incoming conn %v requested unknown RPC \"%v\"", conn.RemoteAddr(), id)
 		return
@@ -54,3 +89,73 @@ func (h *Host) handleConn(conn net.Conn) {
 func (h *Host) rpcSettings(conn net.Conn) error {
 	return encoding.WriteObject(conn, h.Settings())
 }
+
+// rpcKeyProof is an rpc that proves that the host holds the secret key of its
+// public key, by signing a challenge chosen by the caller.
+func (h *Host) rpcKeyProof(conn net.Conn) error {
+	var challenge crypto.Hash
+	if err := encoding.ReadObject(conn, &challenge, crypto.HashSize); err != nil {
+		return errors.New("couldn't read challenge: " + err.Error())
+	}
+	h.mu.RLock()
+	pk, sk := h.publicKey, h.secretKey
+	h.mu.RUnlock()
+	sig, err := modules.SignChallenge(modules.RPCKeyProof, challenge, sk)
+	if err != nil {
+		return err
+	}
+	if err := encoding.WriteObject(conn, pk); err != nil {
+		return err
+	}
+	return encoding.WriteObject(conn, sig)
+}
+
+// rpcLastRevision is an rpc that returns the most recent signed revision
+// transaction of a contract, allowing the renter to recover from a revision
+// that it failed to record. The host sends a random challenge, which must be
+// signed with the renter's key from the contract's unlock conditions, so that
+// only the renter can fetch the revision.
+func (h *Host) rpcLastRevision(conn net.Conn) error {
+	var fcid types.FileContractID
+	if err := encoding.ReadObject(conn, &fcid, crypto.HashSize); err != nil {
+		return errors.New("couldn't read contract ID: " + err.Error())
+	}
+	var challenge crypto.Hash
+	if _, err := rand.Read(challenge[:]); err != nil {
+		return err
+	}
+	if err := encoding.WriteObject(conn, challenge); err != nil {
+		return errors.New("couldn't write challenge: " + err.Error())
+	}
+	var sig crypto.Signature
+	if err := encoding.ReadObject(conn, &sig, crypto.SignatureSize); err != nil {
+		return errors.New("couldn't read challenge response: " + err.Error())
+	}
+
+	h.mu.RLock()
+	obligation, exists := h.obligationsByID[fcid]
+	var revTxn types.Transaction
+	if exists {
+		revTxn = obligation.LastRevisionTxn
+	}
+	h.mu.RUnlock()
+	if !exists {
+		return encoding.WriteObject(conn, "no record of that contract")
+	}
+
+	// The first revision of a contract is empty until the renter revises
+	// it, so it has no unlock conditions to check the response against.
+	if len(revTxn.FileContractRevisions) != 1 || len(revTxn.FileContractRevisions[0].UnlockConditions.PublicKeys) == 0 {
+		return encoding.WriteObject(conn, "no revision of that contract")
+	}
+	renterKey := revTxn.FileContractRevisions[0].UnlockConditions.PublicKeys[0]
+	if err := modules.VerifyChallenge(modules.RPCLastRevision, challenge, renterKey, sig); err != nil {
+		encoding.WriteObject(conn, err.Error())
+		return err
+	}
+
+	if err := encoding.WriteObject(conn, modules.AcceptResponse); err != nil {
+		return err
+	}
+	return encoding.WriteObject(conn, revTxn)
+}
@@ -16,62 +16,112 @@ var persistMetadata = persist.Metadata{
 	Version: "0.4",
 }
 
+// savedHost is the state of the host as stored in settings.json by versions
+// of the host that predate the host database.
 type savedHost struct {
-	SpaceRemaining int64
-	FileCounter    int
-	Profit         types.Currency
-	HostSettings   modules.HostSettings
-	Obligations    []contractObligation
-	SecretKey      crypto.SecretKey
-	PublicKey      types.SiaPublicKey
-}
-
-func (h *Host) save() error {
-	sHost := savedHost{
-		SpaceRemaining: h.spaceRemaining,
-		FileCounter:    h.fileCounter,
-		Profit:         h.profit,
-		HostSettings:   h.HostSettings,
-		Obligations:    make([]contractObligation, 0, len(h.obligationsByID)),
-		SecretKey:      h.secretKey,
-		PublicKey:      h.publicKey,
-	}
-	for _, ob := range h.obligationsByID {
-		// to avoid race conditions involving the obligation's mutex, copy it
-		// manually into a new object
-		obcopy := contractObligation{ID: ob.ID, FileContract: ob.FileContract, LastRevisionTxn: ob.LastRevisionTxn, Path: ob.Path}
-		sHost.Obligations = append(sHost.Obligations, obcopy)
-	}
+	BlockHeight      types.BlockHeight
+	RecentChange     modules.ConsensusChangeID
+	SpaceRemaining   int64
+	CollateralBudget types.Currency
+	FinancialPeriods []modules.HostFinancialPeriod
+	HostSettings     modules.HostSettings
+	Obligations      []contractObligation
+	Sectors          []sector
+	StorageFolders   []storageFolder
+	SecretKey        crypto.SecretKey
+	PublicKey        types.SiaPublicKey
 
-	return persist.SaveFile(persistMetadata, sHost, filepath.Join(h.persistDir, "settings.json"))
+	// Profit is the revenue recorded by hosts that predate financial
+	// periods.
+	Profit types.Currency
 }
 
-func (h *Host) load() error {
-	var sHost savedHost
+// loadLegacy reads the host's state from settings.json.
+func (h *Host) loadLegacy() error {
+	// Hosts saved before the collateral budget was added keep the default.
+	sHost := savedHost{CollateralBudget: h.collateralBudget}
 	err := persist.LoadFile(persistMetadata, &sHost, filepath.Join(h.persistDir, "settings.json"))
 	if err != nil {
 		return err
 	}
 
-	h.spaceRemaining = sHost.HostSettings.TotalStorage
-	h.fileCounter = sHost.FileCounter
+	h.blockHeight = sHost.BlockHeight
+	h.recentChange = sHost.RecentChange
 	h.HostSettings = sHost.HostSettings
-	h.profit = sHost.Profit
-	// recreate maps
+	h.financialPeriods = sHost.FinancialPeriods
+	// Hosts that predate financial periods recorded a single profit.
+	if len(h.financialPeriods) == 0 && !sHost.Profit.IsZero() {
+		h.financialPeriod(0).StorageRevenue = sHost.Profit
+	}
+	h.collateralBudget = sHost.CollateralBudget
 	for i := range sHost.Obligations {
-		obligation := &sHost.Obligations[i] // both maps should use same pointer
-		height := obligation.FileContract.WindowStart + StorageProofReorgDepth
-		h.obligationsByHeight[height] = append(h.obligationsByHeight[height], obligation)
+		obligation := &sHost.Obligations[i]
 		h.obligationsByID[obligation.ID] = obligation
-
-		// update spaceRemaining
-		if len(obligation.LastRevisionTxn.FileContractRevisions) > 0 { // COMPATv0.4.8
-			h.spaceRemaining -= int64(obligation.LastRevisionTxn.FileContractRevisions[0].NewFileSize)
-		}
 	}
+	for i := range sHost.Sectors {
+		h.sectors[sHost.Sectors[i].Root] = &sHost.Sectors[i]
+	}
+	h.storageFolders = sHost.StorageFolders
 	h.secretKey = sHost.SecretKey
 	h.publicKey = sHost.PublicKey
+	return nil
+}
+
+// migrateLegacy copies the state in settings.json into the host database.
+// Once the migration has succeeded, settings.json is renamed with a .bck
+// suffix so that it is not migrated a second time.
+func (h *Host) migrateLegacy() error {
+	err := h.loadLegacy()
+	if err != nil {
+		return err
+	}
+	h.log.Println("Migrating settings.json to the host database")
+	err = h.saveAll()
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(h.persistDir, "settings.json")
+	return os.Rename(filename, filename+".bck")
+}
+
+// load fetches the saved host data from the database, migrating data stored
+// in settings.json.
+func (h *Host) load() error {
+	err := h.loadDB()
+	if os.IsNotExist(err) {
+		err = h.migrateLegacy()
+	}
+	if err != nil {
+		return err
+	}
 
+	for _, ob := range h.obligationsByID {
+		for _, root := range ob.SectorRoots {
+			if s, exists := h.sectors[root]; exists {
+				s.refs++
+			}
+		}
+	}
+	// Sectors are left behind if the host stopped before the obligation
+	// that refers to them was saved.
+	var orphans []crypto.Hash
+	for root, s := range h.sectors {
+		if s.refs == 0 {
+			os.Remove(s.path())
+			delete(h.sectors, root)
+			orphans = append(orphans, root)
+		}
+	}
+	err = h.deleteSectorRecords(orphans...)
+	if err != nil {
+		return err
+	}
+	// Hosts that predate storage folders keep their data in the persist
+	// directory.
+	if len(h.storageFolders) == 0 {
+		h.storageFolders = []storageFolder{{Path: h.persistDir, Size: h.TotalStorage}}
+	}
+	h.updateTotalStorage()
 	return nil
 }
 
@@ -92,10 +142,20 @@ func (h *Host) initPersist() error {
 	h.log = log.New(logFile, "", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
 	h.log.Println("STARTUP: Host has started logging")
 
+	// Open the database.
+	err = h.openDB(filepath.Join(h.persistDir, DatabaseFilename))
+	if err != nil {
+		return err
+	}
+
 	// Load the prior persistance structures.
 	err = h.load()
-	if err != nil && !os.IsNotExist(err) {
+	if os.IsNotExist(err) {
+		// A new host saves its generated keys and default settings.
+		err = h.saveSettings()
+	}
+	if err != nil {
 		return err
 	}
-	return nil
+	return h.migrateContractFiles()
 }
@@ -0,0 +1,104 @@
+package host
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// pricingInterval is how many blocks the host waits between adjustments
+	// of its storage price.
+	pricingInterval = 6
+
+	// pricingDemandWindow is the number of recent blocks in which the host
+	// counts the contracts that it formed to measure demand.
+	pricingDemandWindow = 144
+
+	// pricingDemandTarget is the number of contracts formed within
+	// pricingDemandWindow at which demand is at its highest.
+	pricingDemandTarget = 20
+)
+
+var (
+	errPricingBounds = errors.New("minimum price cannot be higher than maximum price")
+)
+
+// storageUtilization returns the fraction of the host's storage that is in
+// use.
+func (h *Host) storageUtilization() *big.Rat {
+	var total int64
+	for _, sf := range h.storageFolders {
+		total += sf.Size
+	}
+	used := total - h.capacity()
+	switch {
+	case total <= 0 || used >= total:
+		return big.NewRat(1, 1)
+	case used <= 0:
+		return new(big.Rat)
+	}
+	return big.NewRat(used, total)
+}
+
+// recentContracts returns the number of unresolved contracts that the host
+// formed within the last pricingDemandWindow blocks.
+func (h *Host) recentContracts() int64 {
+	var n int64
+	for _, ob := range h.obligationsByID {
+		if ob.FormationHeight != 0 && ob.FormationHeight+pricingDemandWindow > h.blockHeight {
+			n++
+		}
+	}
+	return n
+}
+
+// adjustPrice sets the host's storage price according to its pricing policy.
+// The price rises linearly from MinPrice to MaxPrice with the average of the
+// host's storage utilization and the demand for new contracts.
+func (h *Host) adjustPrice() {
+	h.lastPriceAdjustment = h.blockHeight
+	policy := h.pricingPolicy
+	if !policy.Enabled {
+		return
+	}
+
+	utilization := h.storageUtilization()
+	recent := h.recentContracts()
+	demand := big.NewRat(recent, pricingDemandTarget)
+	if recent > pricingDemandTarget {
+		demand.SetInt64(1)
+	}
+	score := new(big.Rat).Add(utilization, demand)
+	score.Quo(score, big.NewRat(2, 1))
+	price := policy.MinPrice.Add(policy.MaxPrice.Sub(policy.MinPrice).MulRat(score))
+	if price.Cmp(h.Price) == 0 {
+		return
+	}
+	h.log.Printf("INFO: adjusted storage price from %v to %v hastings per byte per block (%v%% of storage used, %v contracts formed in the last %v blocks)",
+		h.Price, price, new(big.Rat).Mul(utilization, big.NewRat(100, 1)).FloatString(1), recent, pricingDemandWindow)
+	h.Price = price
+}
+
+// PricingPolicy returns the policy by which the host adjusts its storage
+// price.
+func (h *Host) PricingPolicy() modules.HostPricingPolicy {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.pricingPolicy
+}
+
+// SetPricingPolicy sets the policy by which the host adjusts its storage
+// price, and adjusts the price immediately. Renters learn the new price the
+// next time they request the host's settings.
+func (h *Host) SetPricingPolicy(policy modules.HostPricingPolicy) error {
+	if policy.Enabled && policy.MinPrice.Cmp(policy.MaxPrice) > 0 {
+		return errPricingBounds
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pricingPolicy = policy
+	h.adjustPrice()
+	return h.saveSettings()
+}
@@ -0,0 +1,179 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestAdjustPrice checks that the host sets its storage price between the
+// bounds of its pricing policy according to its utilization and demand.
+func TestAdjustPrice(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestAdjustPrice", t)
+	h := ht.host
+
+	err := h.SetPricingPolicy(modules.HostPricingPolicy{Enabled: true, MinPrice: types.NewCurrency64(500), MaxPrice: types.NewCurrency64(100)})
+	if err != errPricingBounds {
+		t.Fatal("expected errPricingBounds, got", err)
+	}
+	// an empty host with no demand charges the minimum price
+	err = h.SetPricingPolicy(modules.HostPricingPolicy{Enabled: true, MinPrice: types.NewCurrency64(100), MaxPrice: types.NewCurrency64(500)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price := h.Settings().Price; price.Cmp(types.NewCurrency64(100)) != 0 {
+		t.Fatal("expected the minimum price, got", price)
+	}
+
+	tests := []struct {
+		recent, old int
+		full        bool
+		price       uint64
+	}{
+		{pricingDemandTarget / 2, 0, false, 200},
+		{pricingDemandTarget * 2, 0, false, 300},
+		{0, pricingDemandTarget, false, 100},
+		{0, 0, true, 300},
+		{pricingDemandTarget, 0, true, 500},
+	}
+	for i, test := range tests {
+		h.mu.Lock()
+		h.obligationsByID = make(map[types.FileContractID]*contractObligation)
+		for j := 0; j < test.recent+test.old; j++ {
+			ob := &contractObligation{ID: types.FileContractID{byte(j)}, FormationHeight: h.blockHeight}
+			if j >= test.recent {
+				ob.FormationHeight = h.blockHeight - pricingDemandWindow
+			}
+			h.obligationsByID[ob.ID] = ob
+		}
+		h.storageFolders[0].Size = h.TotalStorage
+		if test.full {
+			h.storageFolders[0].Size = 0
+		}
+		h.adjustPrice()
+		price := h.Price
+		h.mu.Unlock()
+		if price.Cmp(types.NewCurrency64(test.price)) != 0 {
+			t.Errorf("test %v: expected price %v, got %v", i, test.price, price)
+		}
+	}
+
+	// the price is adjusted as blocks are mined, but not once the policy is
+	// disabled
+	h.mu.Lock()
+	h.obligationsByID = make(map[types.FileContractID]*contractObligation)
+	h.mu.Unlock()
+	for i := 0; i < pricingInterval; i++ {
+		_, err := ht.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if price := h.Settings().Price; price.Cmp(types.NewCurrency64(300)) != 0 {
+		t.Fatal("price was not adjusted after mining:", price)
+	}
+	err = h.SetPricingPolicy(modules.HostPricingPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.mu.Lock()
+	h.storageFolders[0].Size = h.TotalStorage
+	h.mu.Unlock()
+	for i := 0; i < pricingInterval; i++ {
+		_, err := ht.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if price := h.Settings().Price; price.Cmp(types.NewCurrency64(300)) != 0 {
+		t.Fatal("price was adjusted by a disabled policy:", price)
+	}
+}
+
+// TestRevisionPrice checks that revisions are priced at the rate agreed when
+// the contract was formed, even after the host adjusts its price.
+func TestRevisionPrice(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestRevisionPrice", t)
+	h := ht.host
+
+	h.mu.Lock()
+	h.Price = types.NewCurrency64(100)
+	formationPrice := h.Price
+	h.mu.Unlock()
+
+	payout := types.SiacoinPrecision
+	renterPayout := types.PostTax(h.blockHeight, payout)
+	uc := types.UnlockConditions{}
+	fc := types.FileContract{
+		WindowStart: h.blockHeight + 20,
+		WindowEnd:   h.blockHeight + 40,
+		Payout:      payout,
+		UnlockHash:  uc.UnlockHash(),
+		ValidProofOutputs: []types.SiacoinOutput{
+			{Value: renterPayout},
+			{Value: types.ZeroCurrency, UnlockHash: h.UnlockHash},
+		},
+		MissedProofOutputs: []types.SiacoinOutput{
+			{Value: renterPayout},
+			{Value: types.ZeroCurrency},
+		},
+	}
+	lastRev := types.FileContractRevision{
+		ParentID:              types.FileContractID{1},
+		UnlockConditions:      uc,
+		NewRevisionNumber:     1,
+		NewWindowStart:        fc.WindowStart,
+		NewWindowEnd:          fc.WindowEnd,
+		NewValidProofOutputs:  fc.ValidProofOutputs,
+		NewMissedProofOutputs: fc.MissedProofOutputs,
+		NewUnlockHash:         fc.UnlockHash,
+	}
+	ob := contractObligation{
+		ID:              lastRev.ParentID,
+		FileContract:    fc,
+		LastRevisionTxn: types.Transaction{FileContractRevisions: []types.FileContractRevision{lastRev}},
+		Price:           formationPrice,
+	}
+
+	// the revision pays exactly the formation price for 100 bytes
+	const size = 100
+	cost := types.NewCurrency64(size).Mul(types.NewCurrency64(uint64(fc.WindowStart - h.blockHeight))).Mul(formationPrice)
+	rev := lastRev
+	rev.NewRevisionNumber++
+	rev.NewFileSize = size
+	rev.NewValidProofOutputs = []types.SiacoinOutput{
+		{Value: renterPayout.Sub(cost)},
+		{Value: cost, UnlockHash: h.UnlockHash},
+	}
+	rev.NewMissedProofOutputs = []types.SiacoinOutput{
+		{Value: renterPayout.Sub(cost)},
+		{Value: cost},
+	}
+	txn := types.Transaction{FileContractRevisions: []types.FileContractRevision{rev}}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.considerRevision(txn, ob); err != nil {
+		t.Fatal("revision at the formation price was rejected:", err)
+	}
+
+	// raising the price does not affect the existing contract
+	h.Price = formationPrice.Mul(types.NewCurrency64(2))
+	if err := h.considerRevision(txn, ob); err != nil {
+		t.Fatal("revision was rejected after the price was raised:", err)
+	}
+
+	// contracts formed without a recorded price are revised at the current
+	// price
+	ob.Price = types.ZeroCurrency
+	if err := h.considerRevision(txn, ob); err == nil || err.Error() != "revision price is too small" {
+		t.Fatal("expected the current price to apply, got", err)
+	}
+}
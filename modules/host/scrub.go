@@ -0,0 +1,175 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// scrubInterval is how often the host checks the integrity of its
+	// contract data.
+	scrubInterval = 24 * time.Hour
+
+	errMerkleRootMismatch = errors.New("sector roots do not match the contract's Merkle root")
+	errScrubInProgress    = errors.New("a scrub is already in progress")
+)
+
+// scrubTarget is a snapshot of the data of an obligation that is checked
+// during a scrub.
+type scrubTarget struct {
+	id             types.FileContractID
+	revisionNumber uint64
+	fileSize       uint64
+	merkleRoot     crypto.Hash
+	sectorRoots    []crypto.Hash
+}
+
+// checkSector returns an error if a sector cannot be read, or if its data no
+// longer matches its Merkle root.
+func (h *Host) checkSector(root crypto.Hash) error {
+	data, err := h.readSector(root)
+	if err != nil {
+		return fmt.Errorf("sector %v is unreadable: %v", root, err)
+	}
+	if sectorRoot(data) != root {
+		return fmt.Errorf("sector %v is corrupt", root)
+	}
+	return nil
+}
+
+// checkContractData returns an error if the data of an obligation does not
+// match the Merkle root in its latest revision. The results of checking each
+// sector are cached in checked, since sectors can be shared by contracts.
+func (h *Host) checkContractData(t scrubTarget, checked map[crypto.Hash]error) error {
+	for _, root := range t.sectorRoots {
+		err, done := checked[root]
+		if !done {
+			err = h.checkSector(root)
+			checked[root] = err
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if t.fileSize == 0 && len(t.sectorRoots) == 0 {
+		return nil
+	}
+	if crypto.CachedMerkleRoot(t.sectorRoots) != t.merkleRoot {
+		return errMerkleRootMismatch
+	}
+	return nil
+}
+
+// scrub recomputes the Merkle root of each obligation's data from disk, and
+// records the obligations whose data does not match their latest revision.
+func (h *Host) scrub() {
+	h.mu.Lock()
+	var targets []scrubTarget
+	for _, ob := range h.obligationsByID {
+		t := scrubTarget{
+			id:          ob.ID,
+			fileSize:    ob.FileContract.FileSize,
+			merkleRoot:  ob.FileContract.FileMerkleRoot,
+			sectorRoots: ob.SectorRoots,
+		}
+		// The first revision of a contract is empty.
+		if len(ob.LastRevisionTxn.FileContractRevisions) == 1 {
+			if rev := ob.LastRevisionTxn.FileContractRevisions[0]; rev.NewRevisionNumber != 0 {
+				t.revisionNumber = rev.NewRevisionNumber
+				t.fileSize, t.merkleRoot = rev.NewFileSize, rev.NewFileMerkleRoot
+			}
+		}
+		targets = append(targets, t)
+	}
+	h.mu.Unlock()
+
+	// Sectors are read without holding the host's lock, so that the host
+	// can keep serving RPCs.
+	corrupt := make(map[types.FileContractID]string)
+	checked := make(map[crypto.Hash]error)
+	for _, t := range targets {
+		if err := h.checkContractData(t, checked); err != nil {
+			corrupt[t.id] = err.Error()
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, t := range targets {
+		reason, isCorrupt := corrupt[t.id]
+		if !isCorrupt {
+			continue
+		}
+		// Contracts that were revised or resolved during the scrub are
+		// checked again by the next scrub.
+		ob, exists := h.obligationsByID[t.id]
+		if !exists || (len(ob.LastRevisionTxn.FileContractRevisions) == 1 && ob.LastRevisionTxn.FileContractRevisions[0].NewRevisionNumber != t.revisionNumber) {
+			delete(corrupt, t.id)
+			continue
+		}
+		if _, known := h.corruptContracts[t.id]; !known {
+			h.log.Printf("ERROR: data of contract %v is corrupt: %v", t.id, reason)
+		}
+	}
+	h.corruptContracts = corrupt
+	h.lastScrub = time.Now()
+	h.scrubbing = false
+	h.log.Printf("INFO: scrubbed %v contracts, %v corrupt", len(targets), len(corrupt))
+}
+
+// threadedScrub periodically checks the integrity of the host's contract
+// data.
+func (h *Host) threadedScrub() {
+	for {
+		time.Sleep(scrubInterval)
+		if err := h.Scrub(); err != nil {
+			h.log.Println("WARN: skipping scheduled scrub:", err)
+		}
+	}
+}
+
+// Scrub starts checking the integrity of the host's contract data. It
+// returns an error if a scrub is already in progress.
+func (h *Host) Scrub() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.scrubbing {
+		return errScrubInProgress
+	}
+	h.scrubbing = true
+	go h.scrub()
+	return nil
+}
+
+// ScrubStatus reports the progress and results of the host's checks of the
+// integrity of its contract data.
+func (h *Host) ScrubStatus() modules.HostScrubStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	status := modules.HostScrubStatus{
+		Scrubbing:        h.scrubbing,
+		LastScrub:        h.lastScrub,
+		CorruptContracts: []modules.HostCorruptContract{},
+	}
+	for id, reason := range h.corruptContracts {
+		// resolved contracts are no longer the host's concern
+		if _, exists := h.obligationsByID[id]; exists {
+			status.CorruptContracts = append(status.CorruptContracts, modules.HostCorruptContract{ID: id, Error: reason})
+		}
+	}
+	sort.Sort(byCorruptID(status.CorruptContracts))
+	return status
+}
+
+// byCorruptID sorts corrupt contracts by ID.
+type byCorruptID []modules.HostCorruptContract
+
+func (s byCorruptID) Len() int           { return len(s) }
+func (s byCorruptID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byCorruptID) Less(i, j int) bool { return s[i].ID.String() < s[j].ID.String() }
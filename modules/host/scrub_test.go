@@ -0,0 +1,81 @@
+package host
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestScrub checks that the host detects contracts whose data no longer
+// matches the Merkle root in their latest revision.
+func TestScrub(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestScrub", t)
+	h := ht.host
+
+	h.mu.Lock()
+	roots, err := h.addSectors([][]byte{[]byte("first contract"), []byte("second contract")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, root := range roots {
+		ob := &contractObligation{ID: types.FileContractID{byte(i + 1)}, SectorRoots: []crypto.Hash{root}}
+		ob.LastRevisionTxn.FileContractRevisions = []types.FileContractRevision{{
+			NewRevisionNumber: 1,
+			NewFileSize:       uint64(len("first contract")),
+			NewFileMerkleRoot: crypto.CachedMerkleRoot(ob.SectorRoots),
+		}}
+		h.obligationsByID[ob.ID] = ob
+	}
+	corruptPath := h.sectors[roots[1]].path()
+	h.mu.Unlock()
+
+	h.scrub()
+	status := h.ScrubStatus()
+	if status.Scrubbing || status.LastScrub.IsZero() {
+		t.Fatal("scrub did not finish:", status)
+	}
+	if len(status.CorruptContracts) != 0 {
+		t.Fatal("intact contracts reported as corrupt:", status.CorruptContracts)
+	}
+
+	err = ioutil.WriteFile(corruptPath, []byte("tampered contract"), 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.scrub()
+	status = h.ScrubStatus()
+	if len(status.CorruptContracts) != 1 || status.CorruptContracts[0].ID != (types.FileContractID{2}) {
+		t.Fatal("corrupt contract was not reported:", status.CorruptContracts)
+	}
+	for _, hc := range h.ContractObligations() {
+		if hc.Corrupt != (hc.ID == types.FileContractID{2}) {
+			t.Error("wrong corruption status for contract", hc.ID)
+		}
+	}
+
+	// a contract whose sectors are intact, but do not match its revision
+	h.mu.Lock()
+	h.obligationsByID[types.FileContractID{1}].LastRevisionTxn.FileContractRevisions[0].NewFileMerkleRoot = crypto.Hash{}
+	h.mu.Unlock()
+	h.scrub()
+	if status = h.ScrubStatus(); len(status.CorruptContracts) != 2 {
+		t.Fatal("expected 2 corrupt contracts, got", status.CorruptContracts)
+	}
+
+	// corrupt contracts that have been resolved are not reported
+	h.mu.Lock()
+	h.deleteObligation(h.obligationsByID[types.FileContractID{2}])
+	h.mu.Unlock()
+	if status = h.ScrubStatus(); len(status.CorruptContracts) != 1 {
+		t.Fatal("resolved contract is still reported:", status.CorruptContracts)
+	}
+
+	if err := h.Scrub(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,260 @@
+package host
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// sectorSize is the number of bytes in a full sector. It must be a power of
+// 2 multiple of crypto.SegmentSize, so that the Merkle root of a contract can
+// be computed from the roots of its sectors.
+var sectorSize uint64
+
+var (
+	errBadSectorIndex = errors.New("requested data is beyond the end of the contract")
+	errSectorConflict = errors.New("sector has the same Merkle root as a stored sector of a different size")
+	errSectorNotFound = errors.New("host has no sector with that Merkle root")
+)
+
+func init() {
+	if build.Release == "testing" {
+		sectorSize = 1 << 12 // 4 KiB
+	} else {
+		sectorSize = 1 << 22 // 4 MiB
+	}
+}
+
+// A sector is a piece of contract data, stored in one of the host's storage
+// folders under its Merkle root. Contracts that contain identical sectors
+// share a single copy.
+type sector struct {
+	Root   crypto.Hash
+	Folder string // Path of the storage folder holding the sector.
+	Size   int64
+
+	// refs is the number of contract sector lists that contain the sector.
+	// It is recalculated from the obligations at startup.
+	refs uint64
+}
+
+// sectorRoot returns the Merkle root of a sector's data.
+func sectorRoot(data []byte) crypto.Hash {
+	tree := crypto.NewTree()
+	tree.ReadSegments(bytes.NewReader(data))
+	return tree.Root()
+}
+
+// splitSectors splits contract data into sectors. Every sector but the last
+// is full.
+func splitSectors(data []byte) [][]byte {
+	var sectors [][]byte
+	for uint64(len(data)) > sectorSize {
+		sectors = append(sectors, data[:sectorSize])
+		data = data[sectorSize:]
+	}
+	return append(sectors, data)
+}
+
+// path returns the location of a sector on disk.
+func (s *sector) path() string {
+	return filepath.Join(s.Folder, s.Root.String())
+}
+
+// storeSector writes a sector to the given storage folder, or adds a
+// reference to it if the host already stores an identical sector.
+func (h *Host) storeSector(folder string, data []byte) (crypto.Hash, error) {
+	root := sectorRoot(data)
+	if s, exists := h.sectors[root]; exists {
+		// The last segment of a sector is zero-padded when computing its
+		// Merkle root, so sectors of different sizes can share a root.
+		if s.Size != int64(len(data)) {
+			return crypto.Hash{}, errSectorConflict
+		}
+		s.refs++
+		return root, nil
+	}
+	s := &sector{Root: root, Folder: folder, Size: int64(len(data)), refs: 1}
+	// The sector is recorded before it is written, so that it is deleted at
+	// startup if the host stops before an obligation refers to it.
+	err := h.saveSector(s)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	err = ioutil.WriteFile(s.path(), data, 0660)
+	if err != nil {
+		return crypto.Hash{}, err
+	}
+	h.sectors[root] = s
+	return root, nil
+}
+
+// addSectors stores each sector in the storage folder with the most space
+// remaining, and returns their Merkle roots. If any sector cannot be stored,
+// none are added.
+func (h *Host) addSectors(sectors [][]byte) ([]crypto.Hash, error) {
+	roots := make([]crypto.Hash, 0, len(sectors))
+	for _, data := range sectors {
+		folder := h.emptiestStorageFolder()
+		var err error
+		if folder == nil || h.folderRemaining(folder.Path) < int64(len(data)) {
+			err = HostCapacityErr
+		} else {
+			var root crypto.Hash
+			root, err = h.storeSector(folder.Path, data)
+			roots = append(roots, root)
+		}
+		if err != nil {
+			for _, root := range roots {
+				h.removeSector(root)
+			}
+			return nil, err
+		}
+	}
+	return roots, nil
+}
+
+// removeSector drops a reference to a sector, deleting the sector once no
+// contracts refer to it.
+func (h *Host) removeSector(root crypto.Hash) {
+	s, exists := h.sectors[root]
+	if !exists {
+		h.log.Printf("WARN: tried to remove unknown sector %v", root)
+		return
+	}
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+	delete(h.sectors, root)
+	err := os.Remove(s.path())
+	if err != nil {
+		h.log.Printf("WARN: failed to remove sector %v: %v", s.path(), err)
+	}
+}
+
+// readSector returns the data of a sector.
+func (h *Host) readSector(root crypto.Hash) ([]byte, error) {
+	h.mu.RLock()
+	s, exists := h.sectors[root]
+	var path string
+	if exists {
+		path = s.path()
+	}
+	h.mu.RUnlock()
+	if !exists {
+		return nil, errSectorNotFound
+	}
+	return ioutil.ReadFile(path)
+}
+
+// writeContractData writes length bytes of a contract's data, starting at
+// offset, to w.
+func (h *Host) writeContractData(w io.Writer, ob *contractObligation, offset, length uint64) error {
+	for length > 0 {
+		i := offset / sectorSize
+		h.mu.RLock()
+		var path string
+		if i < uint64(len(ob.SectorRoots)) {
+			if s, exists := h.sectors[ob.SectorRoots[i]]; exists {
+				path = s.path()
+			}
+		}
+		h.mu.RUnlock()
+		if path == "" {
+			return errBadSectorIndex
+		}
+
+		n := sectorSize - offset%sectorSize
+		if n > length {
+			n = length
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, io.NewSectionReader(file, int64(offset%sectorSize), int64(n)))
+		file.Close()
+		if err != nil {
+			return err
+		}
+		offset += n
+		length -= n
+	}
+	return nil
+}
+
+// buildStorageProof builds a proof that the segment at segmentIndex is part
+// of a contract's data. Only the sector containing the segment is read; the
+// rest of the proof comes from the contract's cached sector roots.
+func (h *Host) buildStorageProof(roots []crypto.Hash, segmentIndex uint64) (base []byte, hashSet []crypto.Hash, err error) {
+	segmentsPerSector := sectorSize / crypto.SegmentSize
+	sectorIndex := segmentIndex / segmentsPerSector
+	if sectorIndex >= uint64(len(roots)) {
+		return nil, nil, errBadSectorIndex
+	}
+	data, err := h.readSector(roots[sectorIndex])
+	if err != nil {
+		return nil, nil, err
+	}
+	base, hashSet, err = crypto.BuildReaderProof(bytes.NewReader(data), segmentIndex%segmentsPerSector)
+	if err != nil {
+		return nil, nil, err
+	}
+	return base, append(hashSet, crypto.BuildCachedProof(roots, sectorIndex)...), nil
+}
+
+// migrateContractFiles converts contracts stored as a single file into
+// sectors. The sectors are written to the storage folder that held the file.
+// The contract files are only deleted once the migrated contracts have been
+// saved, so that an interrupted migration can be repeated.
+func (h *Host) migrateContractFiles() error {
+	var migrated []string
+	for _, ob := range h.obligationsByID {
+		if ob.Path == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(ob.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		folder := h.storageFolders[0].Path
+		if i := h.findStorageFolder(filepath.Dir(ob.Path)); i != -1 {
+			folder = h.storageFolders[i].Path
+		}
+		ob.SectorRoots = nil
+		if len(data) > 0 {
+			for _, sectorData := range splitSectors(data) {
+				root, err := h.storeSector(folder, sectorData)
+				if err != nil {
+					return err
+				}
+				ob.SectorRoots = append(ob.SectorRoots, root)
+			}
+		}
+		if len(ob.LastRevisionTxn.FileContractRevisions) > 0 && len(data) > 0 &&
+			crypto.CachedMerkleRoot(ob.SectorRoots) != ob.LastRevisionTxn.FileContractRevisions[0].NewFileMerkleRoot {
+			h.log.Printf("WARN: data of contract %v does not match its Merkle root", ob.ID)
+		}
+		h.log.Printf("INFO: migrated %v to %v sectors", ob.Path, len(ob.SectorRoots))
+		migrated = append(migrated, ob.Path)
+		ob.Path = ""
+	}
+	if len(migrated) == 0 {
+		return nil
+	}
+	err := h.saveAll()
+	if err != nil {
+		return err
+	}
+	for _, path := range migrated {
+		os.Remove(path)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package host
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSectors checks that contract data split into sectors can be read back,
+// proven, and released, and that identical sectors are stored once.
+func TestSectors(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestSectors", t)
+	h := ht.host
+
+	// Store two copies of a file that spans several sectors.
+	data := make([]byte, 3*sectorSize+100)
+	rand.Read(data)
+	h.mu.Lock()
+	roots1, err := h.addSectors(splitSectors(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots2, err := h.addSectors(splitSectors(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.mu.Unlock()
+	if len(roots1) != 4 || len(h.sectors) != 4 {
+		t.Fatal("expected 4 sectors, got", len(roots1), len(h.sectors))
+	}
+	for _, root := range roots1 {
+		if h.sectors[root].refs != 2 {
+			t.Fatal("identical sectors should be stored once with two references")
+		}
+	}
+	// Renters compute the Merkle root of the whole file with a zero-padded
+	// last segment, as sectorRoot does.
+	fileRoot := sectorRoot(data)
+	if crypto.CachedMerkleRoot(roots1) != fileRoot {
+		t.Fatal("sector roots do not combine to the file's Merkle root")
+	}
+
+	// Read a range that crosses sector boundaries.
+	ob := &contractObligation{SectorRoots: roots1}
+	var buf bytes.Buffer
+	offset, length := sectorSize-10, 2*sectorSize+20
+	err = h.writeContractData(&buf, ob, offset, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data[offset:offset+length]) {
+		t.Fatal("contract data was not read back correctly")
+	}
+	if err := h.writeContractData(&buf, ob, 4*sectorSize, 1); err != errBadSectorIndex {
+		t.Fatal("expected errBadSectorIndex, got", err)
+	}
+
+	// Prove a segment in the middle of the file.
+	numSegments := crypto.CalculateLeaves(uint64(len(data)))
+	index := numSegments / 2
+	base, hashSet, err := h.buildStorageProof(roots1, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !crypto.VerifySegment(base, hashSet, numSegments, index, fileRoot) {
+		t.Fatal("storage proof built from sectors did not verify")
+	}
+
+	// Sectors are deleted once both copies are released.
+	h.mu.Lock()
+	for _, root := range roots1 {
+		h.removeSector(root)
+	}
+	if len(h.sectors) != 4 {
+		t.Fatal("sectors were deleted while still referenced")
+	}
+	path := h.sectors[roots2[0]].path()
+	for _, root := range roots2 {
+		h.removeSector(root)
+	}
+	h.mu.Unlock()
+	if len(h.sectors) != 0 {
+		t.Fatal("unreferenced sectors were not deleted")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("sector file was not deleted")
+	}
+}
+
+// TestMigrateContractFiles checks that contracts stored as a single file are
+// converted to sectors.
+func TestMigrateContractFiles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestMigrateContractFiles", t)
+	h := ht.host
+
+	data := make([]byte, 2*sectorSize+1)
+	rand.Read(data)
+	root := sectorRoot(data)
+	ob := &contractObligation{
+		ID:   types.FileContractID{1},
+		Path: filepath.Join(h.persistDir, "1"),
+	}
+	ob.LastRevisionTxn.FileContractRevisions = []types.FileContractRevision{{
+		NewFileSize:       uint64(len(data)),
+		NewFileMerkleRoot: root,
+	}}
+	err := ioutil.WriteFile(ob.Path, data, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.mu.Lock()
+	h.obligationsByID[ob.ID] = ob
+	err = h.migrateContractFiles()
+	h.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ob.Path != "" || len(ob.SectorRoots) != 3 {
+		t.Fatal("contract was not migrated to sectors:", ob.Path, len(ob.SectorRoots))
+	}
+	if crypto.CachedMerkleRoot(ob.SectorRoots) != root {
+		t.Fatal("migrated sectors do not match the contract's Merkle root")
+	}
+	if _, err := os.Stat(filepath.Join(h.persistDir, "1")); !os.IsNotExist(err) {
+		t.Fatal("contract file was not removed")
+	}
+	var buf bytes.Buffer
+	err = h.writeContractData(&buf, ob, 0, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("migrated data does not match the original file")
+	}
+}
@@ -0,0 +1,287 @@
+package host
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	errBadStorageFolderSize  = errors.New("storage folder size must be positive")
+	errInsufficientCapacity  = errors.New("other storage folders do not have enough space for the folder's contents")
+	errLastStorageFolder     = errors.New("cannot remove the host's last storage folder")
+	errNotADirectory         = errors.New("storage folder path is not a directory")
+	errStorageFolderExists   = errors.New("host is already using that storage folder")
+	errStorageFolderNotFound = errors.New("host has no storage folder at that path")
+	errStorageFolderTooSmall = errors.New("storage folder cannot be smaller than the data it holds")
+)
+
+// A storageFolder is a directory in which the host keeps contract data. The
+// host will store no more than Size bytes in the folder.
+type storageFolder struct {
+	Path string
+	Size int64
+}
+
+// folderUsage returns the number of bytes and the number of sectors stored
+// in each storage folder, keyed by the folder's path.
+func (h *Host) folderUsage() (used map[string]int64, sectors map[string]uint64) {
+	used = make(map[string]int64)
+	sectors = make(map[string]uint64)
+	for _, s := range h.sectors {
+		dir := filepath.Clean(s.Folder)
+		used[dir] += s.Size
+		sectors[dir]++
+	}
+	return used, sectors
+}
+
+// findStorageFolder returns the index of the storage folder with the given
+// path, or -1 if the host has no such folder.
+func (h *Host) findStorageFolder(path string) int {
+	for i, sf := range h.storageFolders {
+		if filepath.Clean(sf.Path) == filepath.Clean(path) {
+			return i
+		}
+	}
+	return -1
+}
+
+// folderRemaining returns the number of bytes still available in the storage
+// folder at path.
+func (h *Host) folderRemaining(path string) int64 {
+	i := h.findStorageFolder(path)
+	if i == -1 {
+		return 0
+	}
+	used, _ := h.folderUsage()
+	return h.storageFolders[i].Size - used[filepath.Clean(h.storageFolders[i].Path)]
+}
+
+// capacity returns the number of bytes still available across all storage
+// folders. The amount can be negative if a folder was shrunk below the
+// amount of data it holds.
+func (h *Host) capacity() int64 {
+	used, _ := h.folderUsage()
+	var remaining int64
+	for _, sf := range h.storageFolders {
+		remaining += sf.Size - used[filepath.Clean(sf.Path)]
+	}
+	return remaining
+}
+
+// emptiestStorageFolder returns the storage folder with the most space
+// remaining. nil is returned if no folder has any space remaining.
+func (h *Host) emptiestStorageFolder() *storageFolder {
+	used, _ := h.folderUsage()
+	var best *storageFolder
+	var bestRemaining int64
+	for i := range h.storageFolders {
+		sf := &h.storageFolders[i]
+		remaining := sf.Size - used[filepath.Clean(sf.Path)]
+		if remaining > bestRemaining {
+			best, bestRemaining = sf, remaining
+		}
+	}
+	return best
+}
+
+// updateTotalStorage sets the advertised total storage to the combined size
+// of the storage folders.
+func (h *Host) updateTotalStorage() {
+	h.TotalStorage = 0
+	for _, sf := range h.storageFolders {
+		h.TotalStorage += sf.Size
+	}
+}
+
+// moveFile copies the file at src to dst and then removes src. Storage
+// folders may be on different disks, so os.Rename cannot be used.
+func moveFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// AddStorageFolder adds a directory that the host can store up to size bytes
+// of contract data in. The directory is created if it does not exist.
+func (h *Host) AddStorageFolder(path string, size int64) error {
+	if size <= 0 {
+		return errBadStorageFolderSize
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(path, 0700)
+	if err != nil {
+		return err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	} else if !stat.IsDir() {
+		return errNotADirectory
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.findStorageFolder(path) != -1 {
+		return errStorageFolderExists
+	}
+	h.storageFolders = append(h.storageFolders, storageFolder{Path: path, Size: size})
+	h.updateTotalStorage()
+	h.log.Printf("INFO: added storage folder %v (%v bytes)", path, size)
+	return h.saveSettings()
+}
+
+// ResizeStorageFolder changes the amount of contract data that the host will
+// store in a storage folder. A folder cannot be shrunk below the amount of
+// data it already holds.
+func (h *Host) ResizeStorageFolder(path string, size int64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := h.findStorageFolder(path)
+	if i == -1 {
+		return errStorageFolderNotFound
+	}
+	if err := h.checkFolderSize(i, size); err != nil {
+		return err
+	}
+	h.storageFolders[i].Size = size
+	h.updateTotalStorage()
+	h.log.Printf("INFO: resized storage folder %v to %v bytes", h.storageFolders[i].Path, size)
+	return h.saveSettings()
+}
+
+// checkFolderSize checks that the storage folder at index i can be resized to
+// size without holding more data than its size.
+func (h *Host) checkFolderSize(i int, size int64) error {
+	if size <= 0 {
+		return errBadStorageFolderSize
+	}
+	used, _ := h.folderUsage()
+	if size < used[filepath.Clean(h.storageFolders[i].Path)] {
+		return errStorageFolderTooSmall
+	}
+	return nil
+}
+
+// RemoveStorageFolder stops the host from using a storage folder. Any
+// sectors in the folder are first moved to the other storage folders.
+func (h *Host) RemoveStorageFolder(path string) error {
+	h.mu.Lock()
+	i := h.findStorageFolder(path)
+	if i == -1 {
+		h.mu.Unlock()
+		return errStorageFolderNotFound
+	}
+	if len(h.storageFolders) == 1 {
+		h.mu.Unlock()
+		return errLastStorageFolder
+	}
+	folder := h.storageFolders[i]
+	dir := filepath.Clean(folder.Path)
+	used, _ := h.folderUsage()
+	if used[dir] > h.capacity()-(folder.Size-used[dir]) {
+		h.mu.Unlock()
+		return errInsufficientCapacity
+	}
+	var roots []crypto.Hash
+	for root, s := range h.sectors {
+		if filepath.Clean(s.Folder) == dir {
+			roots = append(roots, root)
+		}
+	}
+	// Remove the folder before moving its contents so that no new sectors
+	// are placed in it.
+	h.storageFolders = append(h.storageFolders[:i], h.storageFolders[i+1:]...)
+	h.updateTotalStorage()
+	h.mu.Unlock()
+
+	// Move one sector at a time so that the host can keep serving RPCs.
+	for _, root := range roots {
+		h.mu.Lock()
+		err := h.moveSector(root)
+		if err != nil {
+			// Restore the folder so that its remaining sectors are still
+			// accounted for.
+			h.storageFolders = append(h.storageFolders, folder)
+			h.updateTotalStorage()
+			h.saveSettings()
+			h.mu.Unlock()
+			return err
+		}
+		h.mu.Unlock()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.log.Printf("INFO: removed storage folder %v", folder.Path)
+	return h.saveSettings()
+}
+
+// moveSector moves a sector to the storage folder with the most space
+// remaining.
+func (h *Host) moveSector(root crypto.Hash) error {
+	s, exists := h.sectors[root]
+	if !exists {
+		// The sector was deleted after the removal began.
+		return nil
+	}
+	dest := h.emptiestStorageFolder()
+	if dest == nil || s.Size > h.folderRemaining(dest.Path) {
+		return errInsufficientCapacity
+	}
+	oldPath := s.path()
+	moved := *s
+	moved.Folder = dest.Path
+	err := moveFile(oldPath, moved.path())
+	if err != nil {
+		h.log.Printf("WARN: could not move sector %v to %v: %v", oldPath, dest.Path, err)
+		return err
+	}
+	s.Folder = dest.Path
+	return h.saveSector(s)
+}
+
+// StorageFolders returns the capacity and usage of each of the host's
+// storage folders.
+func (h *Host) StorageFolders() []modules.StorageFolderMetadata {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	used, sectors := h.folderUsage()
+	folders := make([]modules.StorageFolderMetadata, 0, len(h.storageFolders))
+	for _, sf := range h.storageFolders {
+		dir := filepath.Clean(sf.Path)
+		folders = append(folders, modules.StorageFolderMetadata{
+			Path:              sf.Path,
+			Capacity:          sf.Size,
+			CapacityRemaining: sf.Size - used[dir],
+			Sectors:           sectors[dir],
+		})
+	}
+	return folders
+}
@@ -0,0 +1,118 @@
+package host
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// TestStorageFolders checks that storage folders can be added, resized, and
+// removed, and that removing a folder moves its sectors.
+func TestStorageFolders(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestStorageFolders", t)
+	h := ht.host
+
+	// A new host stores data in its persist directory.
+	folders := h.StorageFolders()
+	if len(folders) != 1 || folders[0].Path != h.persistDir {
+		t.Fatal("host should start with its persist directory as a storage folder:", folders)
+	}
+	if h.Capacity() != h.Settings().TotalStorage {
+		t.Fatal("new host should have all of its storage available")
+	}
+
+	// Store a sector in the default folder.
+	data := []byte("contract data")
+	h.mu.Lock()
+	roots, err := h.addSectors([][]byte{data})
+	h.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a second folder.
+	dir2 := filepath.Join(h.persistDir, "disk2")
+	err = h.AddStorageFolder(dir2, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddStorageFolder(dir2, 1000); err != errStorageFolderExists {
+		t.Fatal("expected errStorageFolderExists, got", err)
+	}
+	if err := h.AddStorageFolder(filepath.Join(h.persistDir, "disk3"), 0); err != errBadStorageFolderSize {
+		t.Fatal("expected errBadStorageFolderSize, got", err)
+	}
+	folders = h.StorageFolders()
+	if len(folders) != 2 || folders[0].Sectors != 1 || folders[0].CapacityRemaining != folders[0].Capacity-int64(len(data)) {
+		t.Fatal("folder usage is wrong:", folders)
+	}
+	if h.Settings().TotalStorage != folders[0].Capacity+1000 {
+		t.Fatal("total storage should be the combined size of the folders")
+	}
+
+	// Resize the folders.
+	if err := h.ResizeStorageFolder(h.persistDir, int64(len(data))-1); err != errStorageFolderTooSmall {
+		t.Fatal("expected errStorageFolderTooSmall, got", err)
+	}
+	if err := h.ResizeStorageFolder(dir2, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// The data does not fit in the second folder, so the first cannot be
+	// removed.
+	if err := h.RemoveStorageFolder(h.persistDir); err != errInsufficientCapacity {
+		t.Fatal("expected errInsufficientCapacity, got", err)
+	}
+	if err := h.ResizeStorageFolder(dir2, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// Remove the first folder; the data should move to the second.
+	err = h.RemoveStorageFolder(h.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	folders = h.StorageFolders()
+	if len(folders) != 1 || folders[0].Sectors != 1 || folders[0].CapacityRemaining != 1000-int64(len(data)) {
+		t.Fatal("folder usage is wrong after removal:", folders)
+	}
+	if h.sectors[roots[0]].Folder != dir2 {
+		t.Fatal("sector was not moved:", h.sectors[roots[0]].Folder)
+	}
+	moved, err := h.readSector(roots[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(moved, data) {
+		t.Fatal("sector was corrupted by the move")
+	}
+	if err := h.RemoveStorageFolder(dir2); err != errLastStorageFolder {
+		t.Fatal("expected errLastStorageFolder, got", err)
+	}
+	if h.Settings().TotalStorage != 1000 {
+		t.Fatal("total storage was not updated:", h.Settings().TotalStorage)
+	}
+	if h.Settings().RemainingStorage != 1000-int64(len(data)) {
+		t.Fatal("advertised remaining storage does not account for stored data:", h.Settings().RemainingStorage)
+	}
+
+	// Changing the total storage of a host with a single folder resizes the
+	// folder, unless the folder would be too small for its data.
+	for _, size := range []int64{int64(len(data)) - 1, 0, -5} {
+		settings := h.Settings()
+		settings.TotalStorage = size
+		h.SetSettings(settings)
+		if h.Settings().TotalStorage != 1000 || h.Capacity() != 1000-int64(len(data)) {
+			t.Fatal("total storage was changed to an invalid size:", size, h.Settings().TotalStorage, h.Capacity())
+		}
+	}
+	settings := h.Settings()
+	settings.TotalStorage = 500
+	h.SetSettings(settings)
+	if h.StorageFolders()[0].Capacity != 500 {
+		t.Fatal("storage folder was not resized:", h.StorageFolders()[0].Capacity)
+	}
+}
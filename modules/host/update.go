@@ -1,45 +1,51 @@
 package host
 
 import (
-	"os"
-
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
-// threadedDeleteObligation deletes a file obligation.
-func (h *Host) threadedDeleteObligation(obligation contractObligation) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	err := h.deallocate(obligation.Path)
-	if err != nil {
-		h.log.Printf("WARN: failed to deallocate %v: %v", obligation.Path, err)
+// proofHeight returns the height at which the host first tries to submit a
+// storage proof for an obligation. The host waits StorageProofReorgDepth
+// blocks into the proof window, unless the window is too short.
+func proofHeight(ob *contractObligation) types.BlockHeight {
+	height := ob.FileContract.WindowStart + StorageProofReorgDepth
+	if height >= ob.FileContract.WindowEnd {
+		return ob.FileContract.WindowStart
 	}
-	delete(h.obligationsByID, obligation.ID)
-	h.save()
+	return height
 }
 
-// threadedCreateStorageProof creates a storage proof for a file contract
-// obligation and submits it to the blockchain.
-func (h *Host) threadedCreateStorageProof(obligation contractObligation) {
-	defer h.threadedDeleteObligation(obligation)
+// transactionFees returns the total miner fees paid by a transaction.
+func transactionFees(txn types.Transaction) types.Currency {
+	var fees types.Currency
+	for _, fee := range txn.MinerFees {
+		fees = fees.Add(fee)
+	}
+	return fees
+}
 
-	file, err := os.Open(obligation.Path)
-	if err != nil {
-		h.log.Printf("ERROR: could not open obligation %v (%v) for storage proof: %v", obligation.ID, obligation.Path, err)
-		return
+// deleteObligation deletes a file obligation and releases its sectors.
+func (h *Host) deleteObligation(ob *contractObligation) {
+	for _, root := range ob.SectorRoots {
+		h.removeSector(root)
 	}
-	defer file.Close()
+	delete(h.obligationsByID, ob.ID)
+}
 
+// threadedCreateStorageProof creates a storage proof for a file contract
+// obligation and submits it to the blockchain. If the proof is not confirmed,
+// the host tries again after storageProofRetryInterval blocks.
+func (h *Host) threadedCreateStorageProof(obligation contractObligation) {
 	segmentIndex, err := h.cs.StorageProofSegment(obligation.ID)
 	if err != nil {
-		h.log.Printf("ERROR: could not determine storage proof index for %v (%v): %v", obligation.ID, obligation.Path, err)
+		h.log.Printf("ERROR: could not determine storage proof index for %v: %v", obligation.ID, err)
 		return
 	}
-	base, hashSet, err := crypto.BuildReaderProof(file, segmentIndex)
+	base, hashSet, err := h.buildStorageProof(obligation.SectorRoots, segmentIndex)
 	if err != nil {
-		h.log.Printf("ERROR: could not construct storage proof for %v (%v): %v", obligation.ID, obligation.Path, err)
+		h.log.Printf("ERROR: could not construct storage proof for %v: %v", obligation.ID, err)
 		return
 	}
 	sp := types.StorageProof{obligation.ID, [crypto.SegmentSize]byte{}, hashSet}
@@ -55,36 +61,99 @@ func (h *Host) threadedCreateStorageProof(obligation contractObligation) {
 	}
 	err = h.tpool.AcceptTransactionSet(txnSet)
 	if err != nil {
-		h.log.Printf("ERROR: could not submit storage proof txn for %v (%v): %v", obligation.ID, obligation.Path, err)
+		h.log.Printf("ERROR: could not submit storage proof txn for %v: %v", obligation.ID, err)
 		return
 	}
 
-	// Storage proof was successful, so increment profit tracking
 	h.mu.Lock()
-	h.profit = h.profit.Add(obligation.FileContract.Payout)
+	if ob, exists := h.obligationsByID[obligation.ID]; exists {
+		ob.proofSubmitted = true
+	}
 	h.mu.Unlock()
 }
 
+// scheduleStorageProofs submits storage proofs for obligations whose proof
+// windows are open, resubmitting proofs that have not been confirmed. Once a
+// proof is buried StorageProofReorgDepth blocks deep, or the proof window
+// closes without a proof, the obligation is deleted. The deleted obligations
+// are returned.
+func (h *Host) scheduleStorageProofs() (resolved []*contractObligation) {
+	for _, ob := range h.obligationsByID {
+		switch {
+		case ob.ProofHeight != 0 && h.blockHeight >= ob.ProofHeight+StorageProofReorgDepth:
+			h.realizeRevenue(ob)
+			h.deleteObligation(ob)
+			resolved = append(resolved, ob)
+
+		case ob.ProofHeight == 0 && h.blockHeight >= ob.FileContract.WindowEnd:
+			h.log.Printf("WARN: proof window for %v closed without a confirmed storage proof", ob.ID)
+			h.loseRevenue(ob)
+			h.deleteObligation(ob)
+			resolved = append(resolved, ob)
+
+		case ob.ProofHeight == 0 && h.blockHeight >= proofHeight(ob):
+			if ob.proofAttempt != 0 && h.blockHeight < ob.proofAttempt+storageProofRetryInterval {
+				continue
+			}
+			if ob.proofAttempt != 0 {
+				h.log.Printf("WARN: storage proof for %v was not confirmed, resubmitting", ob.ID)
+			}
+			ob.proofAttempt = h.blockHeight
+			ob.proofSubmitted = false
+			// to avoid race conditions involving the obligation's mutex, copy it
+			// manually into a new object
+			obcopy := contractObligation{ID: ob.ID, FileContract: ob.FileContract, LastRevisionTxn: ob.LastRevisionTxn, SectorRoots: ob.SectorRoots}
+			go h.threadedCreateStorageProof(obcopy)
+		}
+	}
+	return resolved
+}
+
 // ProcessConsensusChange will be called by the consensus set every time there
 // is a change to the blockchain.
 func (h *Host) ProcessConsensusChange(cc modules.ConsensusChange) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	h.blockHeight += types.BlockHeight(len(cc.AppliedBlocks))
-	h.blockHeight -= types.BlockHeight(len(cc.RevertedBlocks))
-
-	// Check the applied blocks and see if any of the contracts we have are
-	// ready for storage proofs.
-	for _ = range cc.AppliedBlocks {
-		for _, ob := range h.obligationsByHeight[h.blockHeight] {
-			// to avoid race conditions involving the obligation's mutex, copy it
-			// manually into a new object
-			obcopy := contractObligation{ID: ob.ID, FileContract: ob.FileContract, LastRevisionTxn: ob.LastRevisionTxn, Path: ob.Path}
-			go h.threadedCreateStorageProof(obcopy)
+	// Storage proofs in reverted blocks are no longer confirmed, and need to
+	// be submitted again.
+	var changed []*contractObligation
+	for _, block := range cc.RevertedBlocks {
+		for _, txn := range block.Transactions {
+			for _, sp := range txn.StorageProofs {
+				if ob, exists := h.obligationsByID[sp.ParentID]; exists && ob.ProofHeight == h.blockHeight {
+					h.log.Printf("WARN: storage proof for %v was reverted", ob.ID)
+					p := h.financialPeriod(h.blockHeight)
+					p.ProofFees = p.ProofFees.Sub(transactionFees(txn))
+					ob.ProofHeight = 0
+					ob.proofAttempt = 0
+					ob.proofSubmitted = false
+					changed = append(changed, ob)
+				}
+			}
+		}
+		h.blockHeight--
+	}
+	for _, block := range cc.AppliedBlocks {
+		h.blockHeight++
+		for _, txn := range block.Transactions {
+			for _, sp := range txn.StorageProofs {
+				if ob, exists := h.obligationsByID[sp.ParentID]; exists {
+					ob.ProofHeight = h.blockHeight
+					p := h.financialPeriod(h.blockHeight)
+					p.ProofFees = p.ProofFees.Add(transactionFees(txn))
+					changed = append(changed, ob)
+				}
+			}
 		}
-		// TODO: If something happens while the storage proofs are being
-		// created, those files will never get cleared from the host.
-		delete(h.obligationsByHeight, h.blockHeight)
+	}
+	h.recentChange = cc.ID
+
+	resolved := h.scheduleStorageProofs()
+	if h.blockHeight >= h.lastPriceAdjustment+pricingInterval || h.blockHeight < h.lastPriceAdjustment {
+		h.adjustPrice()
+	}
+	if err := h.saveConsensusChange(changed, resolved); err != nil {
+		h.log.Println("ERROR: could not save host:", err)
 	}
 }
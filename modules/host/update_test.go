@@ -3,14 +3,16 @@ package host
 import (
 	"bytes"
 	"crypto/rand"
-	"io/ioutil"
-	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// TestStorageProof checks that the host submits a storage proof for an
+// obligation, and deletes the obligation once the proof is confirmed.
 func TestStorageProof(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
@@ -46,7 +48,12 @@ func TestStorageProof(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	ioutil.WriteFile(filepath.Join(ht.host.persistDir, "foo"), data, 0777)
+	ht.host.mu.Lock()
+	sectorRoots, err := ht.host.addSectors(splitSectors(data))
+	ht.host.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// create revision
 	rev := types.FileContractRevision{
@@ -68,24 +75,89 @@ func TestStorageProof(t *testing.T) {
 	obligation := &contractObligation{
 		ID:           fcid,
 		FileContract: fc,
-		Path:         filepath.Join(ht.host.persistDir, "foo"),
+		SectorRoots:  sectorRoots,
 	}
+	ht.host.mu.Lock()
 	ht.host.obligationsByID[fcid] = obligation
-	ht.host.obligationsByHeight[fc.WindowStart+1] = []*contractObligation{obligation}
+	ht.host.mu.Unlock()
 
 	// submit both to tpool
 	err = ht.tpool.AcceptTransactionSet(append(signedTxnSet, revTxn))
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = ht.miner.AddBlock()
-	if err != nil {
-		t.Fatal(err)
+
+	// mine blocks until the storage proof is confirmed
+	for i := 0; ; i++ {
+		if i > StorageProofReorgDepth+10 {
+			t.Fatal("storage proof was not confirmed")
+		}
+		_, err = ht.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond) // wait for the proof to be submitted
+		ht.host.mu.RLock()
+		confirmed := obligation.ProofHeight != 0
+		ht.host.mu.RUnlock()
+		if confirmed {
+			break
+		}
 	}
 
-	// storage proof will be submitted after mining one more block
-	_, err = ht.miner.AddBlock()
-	if err != nil {
-		t.Fatal(err)
+	// the obligation is deleted once the proof is buried
+	for i := 0; i < StorageProofReorgDepth; i++ {
+		_, err = ht.miner.AddBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ht.host.mu.RLock()
+	_, exists := ht.host.obligationsByID[fcid]
+	periods := len(ht.host.financialPeriods)
+	ht.host.mu.RUnlock()
+	if exists {
+		t.Fatal("obligation was not deleted after its storage proof was buried")
+	}
+	if periods != 1 {
+		t.Fatal("host did not record revenue from the storage proof")
+	}
+}
+
+// TestRevertedStorageProof checks that the host notices when a block
+// containing one of its storage proofs is reverted.
+func TestRevertedStorageProof(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestRevertedStorageProof", t)
+	h := ht.host
+
+	// the proof window is far away, so no proof is submitted
+	ob := &contractObligation{
+		ID: types.FileContractID{1},
+		FileContract: types.FileContract{
+			WindowStart: h.blockHeight + 100,
+			WindowEnd:   h.blockHeight + 200,
+		},
+	}
+	h.mu.Lock()
+	h.obligationsByID[ob.ID] = ob
+	h.mu.Unlock()
+	height := h.blockHeight
+	block := types.Block{Transactions: []types.Transaction{{
+		StorageProofs: []types.StorageProof{{ParentID: ob.ID}},
+	}}}
+
+	h.ProcessConsensusChange(modules.ConsensusChange{AppliedBlocks: []types.Block{block}})
+	if ob.ProofHeight != height+1 {
+		t.Fatal("storage proof was not confirmed:", ob.ProofHeight)
+	}
+	h.ProcessConsensusChange(modules.ConsensusChange{RevertedBlocks: []types.Block{block}})
+	if ob.ProofHeight != 0 || h.blockHeight != height {
+		t.Fatal("storage proof was not reverted:", ob.ProofHeight)
+	}
+	if status := h.ContractObligations()[0].ProofStatus; status != modules.HostContractActive {
+		t.Fatal("wrong proof status after revert:", status)
 	}
 }
@@ -2,9 +2,7 @@ package host
 
 import (
 	"errors"
-	"io"
 	"net"
-	"os"
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -13,9 +11,126 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// considerDownloadRevision checks that a revision pays the host for a
+// download request without changing anything else about the contract.
+func (h *Host) considerDownloadRevision(txn types.Transaction, obligation *contractObligation, request modules.DownloadRequest) error {
+	// Check that there is only one revision.
+	if len(txn.FileContractRevisions) != 1 {
+		return errors.New("transaction should have only one revision")
+	}
+	if len(obligation.LastRevisionTxn.FileContractRevisions) != 1 {
+		return errors.New("can't revise without a previous revision")
+	}
+
+	// The first revision of a contract is empty, in which case the payment
+	// is made from the outputs of the original contract.
+	rev := txn.FileContractRevisions[0]
+	lastRev := obligation.LastRevisionTxn.FileContractRevisions[0]
+	fc := obligation.FileContract
+	fileSize, merkleRoot := fc.FileSize, fc.FileMerkleRoot
+	validOutputs, missedOutputs := fc.ValidProofOutputs, fc.MissedProofOutputs
+	if lastRev.NewRevisionNumber != 0 {
+		fileSize, merkleRoot = lastRev.NewFileSize, lastRev.NewFileMerkleRoot
+		validOutputs, missedOutputs = lastRev.NewValidProofOutputs, lastRev.NewMissedProofOutputs
+	}
+	price := h.DownloadPrice.Mul(types.NewCurrency64(request.Length))
+	expectedPayout := types.PostTax(h.blockHeight, fc.Payout)
+
+	switch {
+	case request.Offset+request.Length < request.Offset, request.Offset+request.Length > fileSize:
+		return errBadSectorIndex
+
+	// these fields should never change
+	case rev.ParentID != obligation.ID:
+		return errors.New("bad revision parent ID")
+	case rev.NewWindowStart != fc.WindowStart:
+		return errors.New("bad revision window start")
+	case rev.NewWindowEnd != fc.WindowEnd:
+		return errors.New("bad revision window end")
+	case rev.NewUnlockHash != fc.UnlockHash:
+		return errors.New("bad revision unlock hash")
+	case rev.UnlockConditions.UnlockHash() != fc.UnlockHash:
+		return errors.New("bad revision unlock conditions")
+	case rev.NewFileSize != fileSize, rev.NewFileMerkleRoot != merkleRoot:
+		return errors.New("download revision cannot change the file")
+	case len(rev.NewValidProofOutputs) != 2 || len(validOutputs) != 2:
+		return errors.New("bad revision valid proof outputs")
+	case len(rev.NewMissedProofOutputs) != 2 || len(missedOutputs) != 2:
+		return errors.New("bad revision missed proof outputs")
+	case rev.NewValidProofOutputs[0].UnlockHash != validOutputs[0].UnlockHash,
+		rev.NewValidProofOutputs[1].UnlockHash != validOutputs[1].UnlockHash,
+		rev.NewMissedProofOutputs[0].UnlockHash != missedOutputs[0].UnlockHash,
+		rev.NewMissedProofOutputs[1].UnlockHash != missedOutputs[1].UnlockHash:
+		return errors.New("bad revision proof outputs")
+
+	case rev.NewRevisionNumber <= lastRev.NewRevisionNumber:
+		return errors.New("revision must have higher revision number")
+
+	// valid and missing outputs should still sum to payout
+	case rev.NewValidProofOutputs[0].Value.Add(rev.NewValidProofOutputs[1].Value).Cmp(expectedPayout) != 0,
+		rev.NewMissedProofOutputs[0].Value.Add(rev.NewMissedProofOutputs[1].Value).Cmp(expectedPayout) != 0:
+		return errors.New("revision outputs do not sum to original payout")
+
+	// the host's output must grow by the price of the download
+	case rev.NewValidProofOutputs[1].Value.Cmp(validOutputs[1].Value.Add(price)) < 0:
+		return errors.New("download payment is too small")
+	case rev.NewMissedProofOutputs[0].Value.Cmp(rev.NewValidProofOutputs[0].Value) != 0:
+		return errors.New("revision missed renter payout does not match valid payout")
+	}
+
+	return nil
+}
+
+// acceptDownloadPayment checks and countersigns a revision paying for a
+// download request, and records it as the obligation's latest revision.
+func (h *Host) acceptDownloadPayment(obligation *contractObligation, txn types.Transaction, request modules.DownloadRequest) (types.Transaction, error) {
+	// payments are revisions, which must happen in serial
+	obligation.mu.Lock()
+	defer obligation.mu.Unlock()
+
+	h.mu.RLock()
+	err := h.considerDownloadRevision(txn, obligation, request)
+	height := h.blockHeight
+	h.mu.RUnlock()
+	if err != nil {
+		return types.Transaction{}, err
+	}
+
+	// sign the transaction and check the renter's signature
+	txn.TransactionSignatures = append(txn.TransactionSignatures, types.TransactionSignature{
+		ParentID:       crypto.Hash(obligation.ID),
+		CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+		PublicKeyIndex: 1, // host key is always second
+	})
+	sigIndex := len(txn.TransactionSignatures) - 1
+	encodedSig, err := crypto.SignHash(txn.SigHash(sigIndex), h.secretKey)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	txn.TransactionSignatures[sigIndex].Signature = encodedSig[:]
+	if err := txn.StandaloneValid(height); err != nil {
+		return types.Transaction{}, errors.New("invalid payment revision: " + err.Error())
+	}
+
+	// the revision is saved before the renter receives the host's signature
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	lastRevisionTxn, downloadRevenue := obligation.LastRevisionTxn, obligation.DownloadRevenue
+	payment := txn.FileContractRevisions[0].NewValidProofOutputs[1].Value.Sub(hostPayout(obligation))
+	obligation.DownloadRevenue = obligation.DownloadRevenue.Add(payment)
+	obligation.LastRevisionTxn = txn
+	if err := h.saveObligation(obligation); err != nil {
+		obligation.LastRevisionTxn, obligation.DownloadRevenue = lastRevisionTxn, downloadRevenue
+		return types.Transaction{}, err
+	}
+	return txn, nil
+}
+
 // rpcDownload is an RPC that uploads requested segments of a file. After the
 // RPC has been initiated, the host will read and process requests in a loop
-// until the 'stop' signal is received or the connection times out.
+// until the 'stop' signal is received or the connection times out. Each
+// request is paid for with a revision of the file contract before any data is
+// sent.
 func (h *Host) rpcDownload(conn net.Conn) error {
 	// Read the contract ID.
 	var contractID types.FileContractID
@@ -33,33 +148,54 @@ func (h *Host) rpcDownload(conn net.Conn) error {
 	}
 	h.mu.RUnlock()
 
-	// Open the file.
-	file, err := os.Open(ob.Path)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
 	// Process requests until 'stop' signal is received.
-	var request modules.DownloadRequest
+	paid := false
 	for {
+		var request modules.DownloadRequest
 		if err := encoding.ReadObject(conn, &request, 16); err != nil {
 			return err
 		}
 		// Check for termination signal.
-		// TODO: perform other sanity checks on offset/length?
 		if request.Length == 0 {
 			break
 		}
 
 		conn.SetDeadline(time.Now().Add(5 * time.Minute)) // sufficient to transfer 4 MB over 100 kbps
 
+		// Read and accept the payment for the request.
+		var revTxn types.Transaction
+		if err := encoding.ReadObject(conn, &revTxn, types.BlockSizeLimit); err != nil {
+			return errors.New("couldn't read payment revision: " + err.Error())
+		}
+		revTxn, err = h.acceptDownloadPayment(ob, revTxn, request)
+		if err != nil {
+			encoding.WriteObject(conn, err.Error())
+			return errors.New("rejected download payment: " + err.Error())
+		}
+		paid = true
+		if err := encoding.WriteObject(conn, modules.AcceptResponse); err != nil {
+			return errors.New("couldn't write acceptance: " + err.Error())
+		}
+		if err := encoding.WriteObject(conn, revTxn); err != nil {
+			return errors.New("couldn't write signed payment revision: " + err.Error())
+		}
+
 		// Write segment to conn.
-		segment := io.NewSectionReader(file, int64(request.Offset), int64(request.Length))
-		_, err := io.Copy(conn, segment)
+		err := h.writeContractData(conn, ob, request.Offset, request.Length)
 		if err != nil {
 			return err
 		}
 	}
+
+	// Submit the latest payment to the blockchain.
+	if paid {
+		h.mu.RLock()
+		revTxn := ob.LastRevisionTxn
+		h.mu.RUnlock()
+		err = h.tpool.AcceptTransactionSet([]types.Transaction{revTxn})
+		if err != nil && err != modules.ErrDuplicateTransactionSet {
+			h.log.Println("WARN: transaction pool rejected download payment:", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,101 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestConsiderDownloadRevision checks that the host only accepts download
+// payments that pay enough without changing the rest of the contract.
+func TestConsiderDownloadRevision(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht := CreateHostTester("TestConsiderDownloadRevision", t)
+	h := ht.host
+
+	payout := types.SiacoinPrecision
+	renterPayout := types.PostTax(h.blockHeight, payout)
+	uc := types.UnlockConditions{}
+	fc := types.FileContract{
+		FileSize:       0,
+		WindowStart:    h.blockHeight + 20,
+		WindowEnd:      h.blockHeight + 40,
+		Payout:         payout,
+		UnlockHash:     uc.UnlockHash(),
+		RevisionNumber: 0,
+		ValidProofOutputs: []types.SiacoinOutput{
+			{Value: renterPayout},
+			{Value: types.ZeroCurrency, UnlockHash: h.UnlockHash},
+		},
+		MissedProofOutputs: []types.SiacoinOutput{
+			{Value: renterPayout},
+			{Value: types.ZeroCurrency},
+		},
+	}
+	lastRev := types.FileContractRevision{
+		ParentID:              types.FileContractID{1},
+		UnlockConditions:      uc,
+		NewRevisionNumber:     1,
+		NewFileSize:           100,
+		NewFileMerkleRoot:     crypto.Hash{2},
+		NewWindowStart:        fc.WindowStart,
+		NewWindowEnd:          fc.WindowEnd,
+		NewValidProofOutputs:  fc.ValidProofOutputs,
+		NewMissedProofOutputs: fc.MissedProofOutputs,
+		NewUnlockHash:         fc.UnlockHash,
+	}
+	ob := &contractObligation{
+		ID:              lastRev.ParentID,
+		FileContract:    fc,
+		LastRevisionTxn: types.Transaction{FileContractRevisions: []types.FileContractRevision{lastRev}},
+	}
+
+	// payment returns a revision paying price for a download.
+	payment := func(price types.Currency) types.FileContractRevision {
+		rev := lastRev
+		rev.NewRevisionNumber++
+		rev.NewValidProofOutputs = []types.SiacoinOutput{
+			{Value: renterPayout.Sub(price)},
+			{Value: price, UnlockHash: h.UnlockHash},
+		}
+		rev.NewMissedProofOutputs = []types.SiacoinOutput{
+			{Value: renterPayout.Sub(price)},
+			{Value: price},
+		}
+		return rev
+	}
+	price := h.DownloadPrice.Mul(types.NewCurrency64(50))
+	request := modules.DownloadRequest{Offset: 25, Length: 50}
+	staleRev := payment(price)
+	staleRev.NewRevisionNumber = lastRev.NewRevisionNumber
+	changedRev := payment(price)
+	changedRev.NewFileMerkleRoot = crypto.Hash{3}
+
+	tests := []struct {
+		rev     types.FileContractRevision
+		request modules.DownloadRequest
+		valid   bool
+	}{
+		{payment(price), request, true},
+		{payment(price.Add(types.NewCurrency64(1))), request, true},
+		{payment(price.Sub(types.NewCurrency64(1))), request, false},
+		{payment(price), modules.DownloadRequest{Offset: 75, Length: 50}, false},
+		{payment(price), modules.DownloadRequest{Offset: ^uint64(0), Length: 50}, false},
+		{staleRev, request, false},
+		{changedRev, request, false},
+	}
+
+	for i, test := range tests {
+		txn := types.Transaction{FileContractRevisions: []types.FileContractRevision{test.rev}}
+		err := h.considerDownloadRevision(txn, ob, test.request)
+		if test.valid && err != nil {
+			t.Errorf("%v: expected payment to be accepted, got %v", i, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%v: expected payment to be rejected", i)
+		}
+	}
+}
@@ -57,7 +57,7 @@ func (h *Host) learnHostname() {
 	h.mu.Lock()
 	h.netAddr = modules.NetAddress(net.JoinHostPort(host, h.netAddr.Port()))
 	h.HostSettings.IPAddress = h.netAddr
-	h.save()
+	h.saveSettings()
 	h.mu.Unlock()
 }
 
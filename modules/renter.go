@@ -1,16 +1,81 @@
 package modules
 
 import (
+	"errors"
 	"io"
 	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+const (
+	// ErasureCodeReedSolomon selects a Reed-Solomon code for an upload.
+	ErasureCodeReedSolomon = "reedsolomon"
+
+	// ErasureCodeReedSolomonSubchunk selects a Reed-Solomon code that encodes
+	// each segment of a chunk separately, which allows ranges of a chunk to
+	// be recovered.
+	ErasureCodeReedSolomonSubchunk = "reedsolomon-subchunk"
+
+	// ErasureCodeReplication selects a code that stores full copies of the
+	// data.
+	ErasureCodeReplication = "replication"
+)
+
+const (
+	// HostFilterModeDisable allows any host to be selected for uploads.
+	HostFilterModeDisable HostFilterMode = iota
+
+	// HostFilterModeBlacklist prevents the filtered hosts from being
+	// selected for uploads.
+	HostFilterModeBlacklist
+
+	// HostFilterModeWhitelist allows only the filtered hosts to be selected
+	// for uploads.
+	HostFilterModeWhitelist
+)
+
 var (
 	RenterDir = "renter"
+
+	// ErrUnknownErasureCode is returned when the erasure code selected for
+	// an upload is not recognized.
+	ErrUnknownErasureCode = errors.New("unknown erasure code")
+
+	// ErrUnknownHostFilterMode is returned when a host filter mode is not
+	// recognized.
+	ErrUnknownHostFilterMode = errors.New("unknown host filter mode")
 )
 
+// A HostFilterMode determines how the renter treats the hosts in its host
+// filter when selecting hosts for uploads.
+type HostFilterMode int
+
+// String returns the name of the filter mode.
+func (m HostFilterMode) String() string {
+	switch m {
+	case HostFilterModeDisable:
+		return "disable"
+	case HostFilterModeBlacklist:
+		return "blacklist"
+	case HostFilterModeWhitelist:
+		return "whitelist"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseHostFilterMode returns the filter mode with the given name.
+func ParseHostFilterMode(s string) (HostFilterMode, error) {
+	for _, m := range []HostFilterMode{HostFilterModeDisable, HostFilterModeBlacklist, HostFilterModeWhitelist} {
+		if s == m.String() {
+			return m, nil
+		}
+	}
+	return 0, ErrUnknownHostFilterMode
+}
+
 // An ErasureCoder is an error-correcting encoder and decoder.
 type ErasureCoder interface {
 	// NumPieces is the number of pieces returned by Encode.
@@ -34,24 +99,152 @@ type ErasureCoder interface {
 }
 
 // FileUploadParams contains the information used by the Renter to upload a
-// file.
+// file. If ErasureCode is nil, the renter creates the code selected by
+// ErasureCodeType, which is one of the ErasureCode constants, with the given
+// number of data and parity pieces. Zero values select the renter's defaults.
 type FileUploadParams struct {
 	Filename    string
 	Duration    types.BlockHeight
 	Nickname    string
 	ErasureCode ErasureCoder
 	PieceSize   uint64
+	CipherType  crypto.CipherType
+
+	ErasureCodeType string
+	DataPieces      int
+	ParityPieces    int
 }
 
 // FileInfo provides information about a file.
 type FileInfo struct {
 	Nickname       string
+	Version        uint64
 	Filesize       uint64
 	Available      bool    // whether file can be downloaded
 	UploadProgress float32 // percentage of full redundancy
 	Expiration     types.BlockHeight
 }
 
+// FileVersionInfo provides information about one version of a file. Uploading
+// a file using the nickname of an existing file creates a new version of that
+// file.
+type FileVersionInfo struct {
+	Nickname       string
+	Version        uint64
+	Filesize       uint64
+	Available      bool
+	UploadProgress float32
+	Expiration     types.BlockHeight
+	Current        bool              // whether this is the newest version
+	ReplacedHeight types.BlockHeight // height at which a newer version was uploaded
+}
+
+// A RetentionPolicy determines how long the renter keeps prior versions of a
+// file. A value of 0 means that versions are not pruned by that criterion.
+type RetentionPolicy struct {
+	Versions uint64            // number of prior versions to keep
+	Blocks   types.BlockHeight // number of blocks to keep a replaced version
+}
+
+// A HostScoreComponent is one of the multipliers that make up a host's score.
+type HostScoreComponent struct {
+	Name       string  `json:"name"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// A HostScoreBreakdown explains the score of a host. The score is the weight
+// used when selecting hosts at random, and is the product of the components.
+type HostScoreBreakdown struct {
+	Score      types.Currency       `json:"score"`
+	Components []HostScoreComponent `json:"components"`
+}
+
+// HostDiversity determines how the renter spreads the pieces of a chunk across
+// networks. No two hosts holding pieces of the same chunk may be in the same
+// subnet, where subnets are given by their prefix length. A prefix length of
+// 0 disables the restriction for that address family.
+type HostDiversity struct {
+	IPv4SubnetBits int `json:"ipv4subnetbits"`
+	IPv6SubnetBits int `json:"ipv6subnetbits"`
+}
+
+// HostMarketPercentiles summarizes the distribution of a value across the
+// active hosts.
+type HostMarketPercentiles struct {
+	P10 types.Currency `json:"p10"`
+	P25 types.Currency `json:"p25"`
+	P50 types.Currency `json:"p50"`
+	P75 types.Currency `json:"p75"`
+	P90 types.Currency `json:"p90"`
+}
+
+// HostMarketStats summarizes the settings advertised by the active hosts at a
+// given block height. Prices and collateral are per byte per block.
+type HostMarketStats struct {
+	Height       types.BlockHeight     `json:"height"`
+	Hosts        int                   `json:"hosts"`
+	Price        HostMarketPercentiles `json:"price"`
+	Collateral   HostMarketPercentiles `json:"collateral"`
+	TotalStorage int64                 `json:"totalstorage"`
+	Versions     map[string]int        `json:"versions"`
+}
+
+// HostMarket contains the current state of the host market along with
+// samples of its past states, oldest first.
+type HostMarket struct {
+	Current HostMarketStats   `json:"current"`
+	History []HostMarketStats `json:"history"`
+}
+
+// HostScanPolicy determines how the hostdb scans hosts for their settings and
+// availability. Hosts that repeatedly fail to respond are scanned less often,
+// backing off exponentially up to MaxScanBackoff.
+type HostScanPolicy struct {
+	MinScanInterval      time.Duration  `json:"minscaninterval"`
+	MaxScanInterval      time.Duration  `json:"maxscaninterval"`
+	ScanThreads          int            `json:"scanthreads"`
+	RequestTimeout       time.Duration  `json:"requesttimeout"`
+	MaxActiveHosts       int            `json:"maxactivehosts"`
+	InactiveHostCheckups int            `json:"inactivehostcheckups"`
+	MaxScanBackoff       time.Duration  `json:"maxscanbackoff"`
+	MaxReliability       types.Currency `json:"maxreliability"`
+	UnreachablePenalty   types.Currency `json:"unreachablepenalty"`
+}
+
+// A HostInteraction is a record of a single interaction between the renter
+// and a host.
+type HostInteraction struct {
+	Type      string    `json:"type"` // "scan", "upload", "download", or "proof"
+	Success   bool      `json:"success"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// A HostDBContract describes a contract that the renter has formed with a
+// host.
+type HostDBContract struct {
+	ID          types.FileContractID `json:"id"`
+	FileSize    uint64               `json:"filesize"`
+	WindowStart types.BlockHeight    `json:"windowstart"`
+	WindowEnd   types.BlockHeight    `json:"windowend"`
+	ProofStatus string               `json:"proofstatus"` // "", "valid", or "missed"
+	Flag        string               `json:"flag,omitempty"`
+}
+
+// A HostDBEntry describes a host known to the renter's host database. The
+// history and contracts are only filled in when a single host is requested.
+type HostDBEntry struct {
+	HostSettings
+	Active      bool               `json:"active"`
+	Score       HostScoreBreakdown `json:"score"`
+	Reliability types.Currency     `json:"reliability"`
+	FirstSeen   types.BlockHeight  `json:"firstseen"`
+	Uptime      float64            `json:"uptime"`
+	FailureRate float64            `json:"failurerate"`
+	PublicKey   types.SiaPublicKey `json:"publickey"`
+	History     []HostInteraction  `json:"history,omitempty"`
+	Contracts   []HostDBContract   `json:"contracts,omitempty"`
+}
+
 // DownloadInfo provides information about a file that has been requested for
 // download.
 type DownloadInfo struct {
@@ -79,6 +272,9 @@ type Renter interface {
 	// AllHosts returns the full list of hosts known to the renter.
 	AllHosts() []HostSettings
 
+	// Close closes the renter database.
+	Close() error
+
 	// DeleteFile deletes a file entry from the renter.
 	DeleteFile(nickname string) error
 
@@ -88,9 +284,41 @@ type Renter interface {
 	// DownloadQueue lists all the files that have been scheduled for download.
 	DownloadQueue() []DownloadInfo
 
+	// DownloadVersion downloads a specific version of a file to the given
+	// filepath.
+	DownloadVersion(nickname string, version uint64, filepath string) error
+
 	// FileList returns information on all of the files stored by the renter.
 	FileList() []FileInfo
 
+	// FileVersions returns information on every version of a file, ordered
+	// from oldest to newest.
+	FileVersions(nickname string) ([]FileVersionInfo, error)
+
+	// Host returns detailed information about a known host, including its
+	// interaction history and contracts.
+	Host(NetAddress) (HostDBEntry, error)
+
+	// HostDiversity returns the subnet sizes used to keep the hosts of a
+	// chunk on different networks.
+	HostDiversity() HostDiversity
+
+	// HostFilter returns the host filter mode and the hosts in the filter.
+	HostFilter() (HostFilterMode, []NetAddress)
+
+	// HostMarket returns statistics about the settings of the active hosts,
+	// both current and historical.
+	HostMarket() HostMarket
+
+	// HostScanPolicy returns the policy used to scan hosts.
+	HostScanPolicy() HostScanPolicy
+
+	// HostScore returns a breakdown of the score of a known host.
+	HostScore(NetAddress) (HostScoreBreakdown, error)
+
+	// Hosts returns summary information about every known host.
+	Hosts() []HostDBEntry
+
 	// Info returns the list of all files by nickname. (deprecated)
 	Info() RentInfo
 
@@ -105,12 +333,34 @@ type Renter interface {
 	// Rename changes the nickname of a file.
 	RenameFile(currentName, newName string) error
 
+	// RescanHost schedules an immediate scan of a known host.
+	RescanHost(NetAddress) error
+
+	// RetentionPolicy returns the policy used to prune prior file versions.
+	RetentionPolicy() RetentionPolicy
+
+	// SetHostDiversity changes the subnet sizes used to keep the hosts of a
+	// chunk on different networks.
+	SetHostDiversity(HostDiversity) error
+
+	// SetHostFilter changes the host filter mode and the hosts in the
+	// filter.
+	SetHostFilter(mode HostFilterMode, hosts []NetAddress) error
+
+	// SetHostScanPolicy changes the policy used to scan hosts.
+	SetHostScanPolicy(HostScanPolicy) error
+
+	// SetRetentionPolicy changes the policy used to prune prior file
+	// versions.
+	SetRetentionPolicy(RetentionPolicy) error
+
 	// ShareFiles creates a '.sia' file that can be shared with others.
 	ShareFiles(nicknames []string, shareDest string) error
 
 	// ShareFilesAscii creates an ASCII-encoded '.sia' file.
 	ShareFilesAscii(nicknames []string) (asciiSia string, err error)
 
-	// Upload uploads a file using the input parameters.
+	// Upload uploads a file using the input parameters. If a file with the
+	// same nickname already exists, the upload becomes its newest version.
 	Upload(FileUploadParams) error
 }
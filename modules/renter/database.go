@@ -0,0 +1,404 @@
+package renter
+
+// database.go contains the functions that store renter metadata in a bolt
+// database. Each file gets its own bucket, holding the file metadata and a
+// nested bucket of the contracts that cover the file's pieces. Contracts are
+// written individually, so that repairing a file only rewrites the contracts
+// that received new pieces. Prior versions of a file are stored using the same
+// layout, nested under the file's nickname and version number.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+
+	"github.com/NebulousLabs/bolt"
+)
+
+const (
+	// DatabaseFilename is the name of the database that stores the renter's
+	// files, contracts, and tracking information.
+	DatabaseFilename = "renter.db"
+)
+
+var (
+	errNilFileBucket = errors.New("file does not exist in the renter database")
+
+	dbMetadata = persist.Metadata{
+		Header:  "Renter Database",
+		Version: "0.5.0",
+	}
+
+	// bucketFiles is a database bucket containing one nested bucket per file,
+	// keyed by the file's nickname.
+	bucketFiles = []byte("Files")
+
+	// bucketTracking is a database bucket mapping the nickname of each
+	// tracked file to its trackedFile metadata.
+	bucketTracking = []byte("Tracking")
+
+	// bucketVersions is a database bucket containing one nested bucket per
+	// nickname, which in turn contains one file bucket for each prior version
+	// of the file, keyed by version number.
+	bucketVersions = []byte("Versions")
+
+	// bucketSettings is a database bucket holding renter-wide settings.
+	bucketSettings = []byte("Settings")
+
+	// keyRetentionPolicy is the key within the settings bucket that holds the
+	// retention policy for prior file versions.
+	keyRetentionPolicy = []byte("RetentionPolicy")
+
+	// keyReplacedHeight is the key within the bucket of a prior version that
+	// holds the height at which the version was replaced.
+	keyReplacedHeight = []byte("ReplacedHeight")
+
+	// keyMetadata is the key within a file bucket that holds the encoded file
+	// metadata.
+	keyMetadata = []byte("Metadata")
+
+	// bucketContracts is the name of the bucket nested within each file
+	// bucket that maps contract IDs to encoded fileContracts.
+	bucketContracts = []byte("Contracts")
+)
+
+// marshalMetadata encodes all of the file's fields except for its contracts.
+func (f *file) marshalMetadata() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := encoding.NewEncoder(buf)
+	err := enc.EncodeAll(
+		f.name,
+		f.size,
+		f.masterKey,
+		f.cipherType,
+		f.pieceSize,
+		f.mode,
+		f.version,
+		f.chunkHashes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = encodeErasureCode(enc, f.erasureCode)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalMetadata decodes metadata created by marshalMetadata into f.
+func (f *file) unmarshalMetadata(b []byte) error {
+	dec := encoding.NewDecoder(bytes.NewReader(b))
+	err := dec.DecodeAll(
+		&f.name,
+		&f.size,
+		&f.masterKey,
+		&f.cipherType,
+		&f.pieceSize,
+		&f.mode,
+		&f.version,
+		&f.chunkHashes,
+	)
+	if err != nil {
+		return err
+	}
+	f.erasureCode, err = decodeErasureCode(dec)
+	return err
+}
+
+// openDB opens the renter database, creating the top-level buckets if they do
+// not yet exist.
+func (r *Renter) openDB(filename string) (err error) {
+	r.db, err = persist.OpenDatabase(dbMetadata, filename)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{bucketFiles, bucketTracking, bucketVersions, bucketSettings} {
+			_, err := tx.CreateBucketIfNotExists(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// versionKey returns the database key of a prior version of a file. Keys are
+// big-endian so that bolt iterates over the versions from oldest to newest.
+func versionKey(version uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, version)
+	return b
+}
+
+// dbPutFile writes the metadata and every contract of f to a bucket nested
+// in parent under key, replacing any existing entry for the file. The new file
+// bucket is returned.
+func dbPutFile(parent *bolt.Bucket, key []byte, f *file) (*bolt.Bucket, error) {
+	if parent.Bucket(key) != nil {
+		err := parent.DeleteBucket(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fb, err := parent.CreateBucket(key)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := f.marshalMetadata()
+	if err != nil {
+		return nil, err
+	}
+	err = fb.Put(keyMetadata, metadata)
+	if err != nil {
+		return nil, err
+	}
+	cb, err := fb.CreateBucket(bucketContracts)
+	if err != nil {
+		return nil, err
+	}
+	for id, fc := range f.contracts {
+		err = cb.Put(id[:], encoding.Marshal(fc))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fb, nil
+}
+
+// dbGetFile reads the file stored in the bucket fb.
+func dbGetFile(fb *bolt.Bucket) (*file, error) {
+	f := &file{
+		contracts: make(map[types.FileContractID]fileContract),
+	}
+	err := f.unmarshalMetadata(fb.Get(keyMetadata))
+	if err != nil {
+		return nil, err
+	}
+	err = fb.Bucket(bucketContracts).ForEach(func(_, v []byte) error {
+		var fc fileContract
+		if err := encoding.Unmarshal(v, &fc); err != nil {
+			return err
+		}
+		f.contracts[fc.ID] = fc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// saveFile writes a file, including all of its contracts, to the renter
+// database.
+func (r *Renter) saveFile(f *file) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return r.db.Update(func(tx *bolt.Tx) error {
+		_, err := dbPutFile(tx.Bucket(bucketFiles), []byte(f.name), f)
+		return err
+	})
+}
+
+// dbPutContracts writes the specified contracts of f to the file bucket fb.
+func dbPutContracts(fb *bolt.Bucket, f *file, ids []types.FileContractID) error {
+	cb := fb.Bucket(bucketContracts)
+	for _, id := range ids {
+		fc, exists := f.contracts[id]
+		if !exists {
+			continue
+		}
+		err := cb.Put(id[:], encoding.Marshal(fc))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveContracts writes the specified contracts of f to the renter database.
+// The rest of the file's entry is left untouched.
+func (r *Renter) saveContracts(f *file, ids []types.FileContractID) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return r.db.Update(func(tx *bolt.Tx) error {
+		fb := tx.Bucket(bucketFiles).Bucket([]byte(f.name))
+		if fb == nil {
+			return errNilFileBucket
+		}
+		return dbPutContracts(fb, f, ids)
+	})
+}
+
+// saveVersionContracts writes the specified contracts of f, a prior version of
+// its file, to the renter database.
+func (r *Renter) saveVersionContracts(f *file, ids []types.FileContractID) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return r.db.Update(func(tx *bolt.Tx) error {
+		vb := tx.Bucket(bucketVersions).Bucket([]byte(f.name))
+		if vb == nil {
+			return errNilFileBucket
+		}
+		fb := vb.Bucket(versionKey(f.version))
+		if fb == nil {
+			return errNilFileBucket
+		}
+		return dbPutContracts(fb, f, ids)
+	})
+}
+
+// deleteFile removes a file, its prior versions, and its tracking information
+// from the renter database.
+func (r *Renter) deleteFile(nickname string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(bucketTracking).Delete([]byte(nickname))
+		if err != nil {
+			return err
+		}
+		for _, bucket := range [][]byte{bucketFiles, bucketVersions} {
+			b := tx.Bucket(bucket)
+			if b.Bucket([]byte(nickname)) == nil {
+				continue
+			}
+			err = b.DeleteBucket([]byte(nickname))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// replaceFile moves the current version of a file into the file's prior
+// versions and stores f as the new current version, in a single database
+// transaction.
+func (r *Renter) replaceFile(pv priorVersion, f *file) error {
+	pv.file.mu.RLock()
+	defer pv.file.mu.RUnlock()
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return r.db.Update(func(tx *bolt.Tx) error {
+		vb, err := tx.Bucket(bucketVersions).CreateBucketIfNotExists([]byte(f.name))
+		if err != nil {
+			return err
+		}
+		fb, err := dbPutFile(vb, versionKey(pv.file.version), pv.file)
+		if err != nil {
+			return err
+		}
+		err = fb.Put(keyReplacedHeight, encoding.Marshal(pv.replacedHeight))
+		if err != nil {
+			return err
+		}
+		_, err = dbPutFile(tx.Bucket(bucketFiles), []byte(f.name), f)
+		return err
+	})
+}
+
+// deleteVersions removes prior versions of a file from the renter database.
+func (r *Renter) deleteVersions(nickname string, versions []uint64) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		vb := tx.Bucket(bucketVersions).Bucket([]byte(nickname))
+		if vb == nil {
+			return nil
+		}
+		for _, version := range versions {
+			if vb.Bucket(versionKey(version)) == nil {
+				continue
+			}
+			err := vb.DeleteBucket(versionKey(version))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// saveRetentionPolicy writes the retention policy to the renter database.
+func (r *Renter) saveRetentionPolicy(rp modules.RetentionPolicy) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketSettings).Put(keyRetentionPolicy, encoding.Marshal(rp))
+	})
+}
+
+// saveTracking writes the tracking metadata of a file to the renter
+// database.
+func (r *Renter) saveTracking(nickname string, tf trackedFile) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTracking).Put([]byte(nickname), encoding.Marshal(tf))
+	})
+}
+
+// deleteTracking removes the tracking metadata of a file from the renter
+// database.
+func (r *Renter) deleteTracking(nickname string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTracking).Delete([]byte(nickname))
+	})
+}
+
+// loadDB reads all files, prior versions, tracking information, and settings
+// from the renter database into memory.
+func (r *Renter) loadDB() error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(bucketFiles).ForEach(func(name, _ []byte) error {
+			f, err := dbGetFile(tx.Bucket(bucketFiles).Bucket(name))
+			if err != nil {
+				return err
+			}
+			r.files[f.name] = f
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(bucketVersions).ForEach(func(name, _ []byte) error {
+			vb := tx.Bucket(bucketVersions).Bucket(name)
+			var versions []priorVersion
+			err := vb.ForEach(func(version, _ []byte) error {
+				fb := vb.Bucket(version)
+				f, err := dbGetFile(fb)
+				if err != nil {
+					return err
+				}
+				pv := priorVersion{file: f}
+				err = encoding.Unmarshal(fb.Get(keyReplacedHeight), &pv.replacedHeight)
+				if err != nil {
+					return err
+				}
+				versions = append(versions, pv)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			r.versions[string(name)] = versions
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if b := tx.Bucket(bucketSettings).Get(keyRetentionPolicy); b != nil {
+			err = encoding.Unmarshal(b, &r.retention)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(bucketTracking).ForEach(func(name, v []byte) error {
+			var tf trackedFile
+			if err := encoding.Unmarshal(v, &tf); err != nil {
+				return err
+			}
+			r.tracking[string(name)] = tf
+			return nil
+		})
+	})
+}
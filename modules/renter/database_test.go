@@ -0,0 +1,136 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSaveContracts checks that saveContracts updates individual contracts of
+// a file without disturbing the rest of the file's database entry.
+func TestSaveContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestSaveContracts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	f := newTestingFile()
+	f.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1234"},
+		{2}: {ID: types.FileContractID{2}, IP: "bar:1234"},
+	}
+	err = rt.renter.saveFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a piece to one contract and create a new contract, but only save
+	// the new contract.
+	fc := f.contracts[types.FileContractID{1}]
+	fc.Pieces = append(fc.Pieces, pieceData{Chunk: 0, Piece: 0, Offset: 0})
+	f.contracts[fc.ID] = fc
+	f.contracts[types.FileContractID{3}] = fileContract{ID: types.FileContractID{3}, IP: modules.NetAddress("baz:1234")}
+	err = rt.renter.saveContracts(f, []types.FileContractID{{3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt.renter.files = make(map[string]*file)
+	err = rt.renter.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := rt.renter.files[f.name]
+	if err := equalFiles(f, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.contracts) != 3 {
+		t.Fatal("expected 3 contracts, got", len(loaded.contracts))
+	}
+	if len(loaded.contracts[types.FileContractID{1}].Pieces) != 0 {
+		t.Fatal("unsaved contract change was written to the database")
+	}
+
+	// Deleting the file should remove it from the database.
+	err = rt.renter.deleteFile(f.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.files = make(map[string]*file)
+	err = rt.renter.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := rt.renter.files[f.name]; exists {
+		t.Fatal("file still in database after deletion")
+	}
+}
+
+// TestSaveVersionContracts checks that saveVersionContracts updates the
+// contracts of a prior version without touching the current version.
+func TestSaveVersionContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestSaveVersionContracts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	prev := newTestingFile()
+	prev.contracts = map[types.FileContractID]fileContract{
+		{1}: {ID: types.FileContractID{1}, IP: "foo:1234"},
+	}
+	cur := newTestingFile()
+	cur.name = prev.name
+	cur.version = prev.version + 1
+	cur.contracts = make(map[types.FileContractID]fileContract)
+	err = rt.renter.replaceFile(priorVersion{file: prev}, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Repair the prior version by adding a new contract.
+	prev.contracts[types.FileContractID{2}] = fileContract{
+		ID:     types.FileContractID{2},
+		IP:     "bar:1234",
+		Pieces: []pieceData{{Chunk: 0, Piece: 0, Offset: 0}},
+	}
+	err = rt.renter.saveVersionContracts(prev, []types.FileContractID{{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt.renter.files = make(map[string]*file)
+	rt.renter.versions = make(map[string][]priorVersion)
+	err = rt.renter.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.renter.versions[prev.name]) != 1 {
+		t.Fatal("expected 1 prior version, got", len(rt.renter.versions[prev.name]))
+	}
+	loaded := rt.renter.versions[prev.name][0].file
+	if len(loaded.contracts) != 2 || len(loaded.contracts[types.FileContractID{2}].Pieces) != 1 {
+		t.Fatal("repaired contract of the prior version was not saved")
+	}
+	if len(rt.renter.files[cur.name].contracts) != 0 {
+		t.Fatal("current version was modified")
+	}
+
+	// Versions that are no longer stored cannot be saved.
+	err = rt.renter.deleteVersions(prev.name, []uint64{prev.version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.renter.saveVersionContracts(prev, []types.FileContractID{{2}})
+	if err != errNilFileBucket {
+		t.Fatal("expected errNilFileBucket, got", err)
+	}
+}
@@ -3,14 +3,13 @@ package renter
 import (
 	"errors"
 	"io"
-	"net"
 	"os"
 	"sync/atomic"
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
-	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
 )
 
 var (
@@ -31,10 +30,15 @@ type fetcher interface {
 // A hostFetcher fetches pieces from a host. It implements the fetcher
 // interface.
 type hostFetcher struct {
-	conn      net.Conn
-	pieceMap  map[uint64][]pieceData
-	pieceSize uint64
-	masterKey crypto.TwofishKey
+	downloader hostdb.Downloader
+	pieceMap   map[uint64][]pieceData
+	pieceSize  uint64
+	masterKey  crypto.TwofishKey
+	cipherType crypto.CipherType
+
+	// the number of successful and failed fetches
+	fetched int
+	failed  int
 }
 
 // pieces returns the pieces stored on this host that are part of a given
@@ -43,72 +47,54 @@ func (hf *hostFetcher) pieces(chunk uint64) []pieceData {
 	return hf.pieceMap[chunk]
 }
 
-// fetch downloads the piece specified by p.
-func (hf *hostFetcher) fetch(p pieceData) ([]byte, error) {
-	hf.conn.SetDeadline(time.Now().Add(2 * time.Minute)) // sufficient to transfer 4 MB over 250 kbps
-	defer hf.conn.SetDeadline(time.Time{})
-	// request piece
-	err := encoding.WriteObject(hf.conn, modules.DownloadRequest{p.Offset, hf.pieceSize})
+// fetch downloads the piece specified by p, paying the host for it.
+func (hf *hostFetcher) fetch(p pieceData) (_ []byte, err error) {
+	defer func() {
+		if err != nil {
+			hf.failed++
+		} else {
+			hf.fetched++
+		}
+	}()
+	// download piece
+	data, err := hf.downloader.Download(p.Offset, hf.pieceSize)
 	if err != nil {
 		return nil, err
 	}
 
-	// download piece
-	data := make([]byte, hf.pieceSize)
-	_, err = io.ReadFull(hf.conn, data)
+	// generate decryption key
+	key, err := deriveKey(hf.cipherType, hf.masterKey, p.Chunk, p.Piece)
 	if err != nil {
 		return nil, err
 	}
 
-	// generate decryption key
-	key := deriveKey(hf.masterKey, p.Chunk, p.Piece)
-
 	// decrypt and return
 	return key.DecryptBytes(data)
 }
 
 func (hf *hostFetcher) Close() error {
-	// ignore error; we'll need to close conn anyway
-	encoding.WriteObject(hf.conn, modules.DownloadRequest{0, 0})
-	return hf.conn.Close()
+	return hf.downloader.Close()
 }
 
-// newHostFetcher creates a new hostFetcher by connecting to a host.
+// newHostFetcher creates a new hostFetcher from a Downloader connected to
+// the host that stores fc.
 // TODO: We may not wind up requesting data from this, which means we will
 // connect and then disconnect without making any actual requests (but holding
 // the connection open the entire time). This is wasteful of host resources.
 // Consider only opening the connection after the first request has been made.
-func newHostFetcher(fc fileContract, pieceSize uint64, masterKey crypto.TwofishKey) (*hostFetcher, error) {
-	conn, err := net.DialTimeout("tcp", string(fc.IP), 15*time.Second)
-	if err != nil {
-		return nil, err
-	}
-	conn.SetDeadline(time.Now().Add(15 * time.Second))
-	defer conn.SetDeadline(time.Time{})
-
-	// send RPC
-	err = encoding.WriteObject(conn, modules.RPCDownload)
-	if err != nil {
-		return nil, err
-	}
-
-	// send contract ID
-	err = encoding.WriteObject(conn, fc.ID)
-	if err != nil {
-		return nil, err
-	}
-
+func newHostFetcher(d hostdb.Downloader, fc fileContract, pieceSize uint64, masterKey crypto.TwofishKey, cipherType crypto.CipherType) *hostFetcher {
 	// make piece map
 	pieceMap := make(map[uint64][]pieceData)
 	for _, p := range fc.Pieces {
 		pieceMap[p.Chunk] = append(pieceMap[p.Chunk], p)
 	}
 	return &hostFetcher{
-		conn:      conn,
-		pieceMap:  pieceMap,
-		pieceSize: pieceSize + crypto.TwofishOverhead,
-		masterKey: masterKey,
-	}, nil
+		downloader: d,
+		pieceMap:   pieceMap,
+		pieceSize:  pieceSize + cipherType.Overhead(),
+		masterKey:  masterKey,
+		cipherType: cipherType,
+	}
 }
 
 // checkHosts checks that a set of hosts is sufficient to download a file.
@@ -186,7 +172,7 @@ func (d *download) run(w io.Writer) error {
 		if n > d.fileSize-received {
 			n = d.fileSize - received
 		}
-		err := d.erasureCode.Recover(chunk, uint64(n), w)
+		err := d.erasureCode.Recover(chunk, n, w)
 		if err != nil {
 			return err
 		}
@@ -222,19 +208,54 @@ func (r *Renter) Download(nickname, destination string) error {
 	if !exists {
 		return errors.New("no file of that nickname")
 	}
+	return r.download(file, destination)
+}
+
+// DownloadVersion downloads a specific version of a file, which may be either
+// the current version or a prior version, to the given destination.
+func (r *Renter) DownloadVersion(nickname string, version uint64, destination string) error {
+	lockID := r.mu.RLock()
+	file, err := r.findVersion(nickname, version)
+	r.mu.RUnlock(lockID)
+	if err != nil {
+		return err
+	}
+	return r.download(file, destination)
+}
 
+// download downloads file to the given destination.
+func (r *Renter) download(file *file, destination string) error {
 	// Initiate connections to each host.
 	var hosts []fetcher
+	var fetchers []*hostFetcher
 	for _, fc := range file.contracts {
+		// Follow the host if it has announced a new address.
+		if addr, ok := r.hostDB.ContractAddress(fc.ID); ok {
+			fc.IP = addr
+		}
+
 		// TODO: connect in parallel
-		hf, err := newHostFetcher(fc, file.pieceSize, file.masterKey)
+		d, err := r.hostDB.NewDownloader(fc.ID)
 		if err != nil {
+			r.hostDB.RecordDownload(fc.IP, false)
 			continue
 		}
+		hf := newHostFetcher(d, fc, file.pieceSize, file.masterKey, file.cipherType)
 		defer hf.Close()
 		hosts = append(hosts, hf)
+		fetchers = append(fetchers, hf)
 	}
 
+	// Record the outcome of the download for each host that was asked for
+	// data.
+	defer func() {
+		for _, hf := range fetchers {
+			if hf.fetched+hf.failed > 0 {
+				r.hostDB.RecordDownload(hf.downloader.Address(), hf.failed == 0)
+			}
+		}
+	}()
+
 	// Check that this host set is sufficient to download the file.
 	err := checkHosts(hosts, file.erasureCode.MinPieces(), file.numChunks())
 	if err != nil {
@@ -257,7 +278,7 @@ func (r *Renter) Download(nickname, destination string) error {
 	d := file.newDownload(hosts, destination)
 
 	// Add the download to the download queue.
-	lockID = r.mu.Lock()
+	lockID := r.mu.Lock()
 	r.downloadQueue = append(r.downloadQueue, d)
 	r.mu.Unlock(lockID)
 
@@ -1,13 +1,105 @@
 package renter
 
 import (
+	"bytes"
+	"errors"
 	"io"
 
 	"github.com/klauspost/reedsolomon"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 )
 
+const (
+	// The names under which the erasure coders are stored in .sia files.
+	rsCodeName          = "Reed-Solomon"
+	rsSubCodeName       = "Reed-Solomon Subchunk"
+	replicationCodeName = "Replication"
+
+	// maxErasurePieces is the largest number of pieces that an erasure code
+	// may produce. It bounds the memory used by codes that are loaded from
+	// untrusted .sia files.
+	maxErasurePieces = 256
+
+	// defaultReplicationCopies is the number of copies stored by uploads
+	// that select replication without specifying the number of pieces.
+	defaultReplicationCopies = 3
+)
+
+var (
+	errBadPieces       = errors.New("pieces have inconsistent or invalid lengths")
+	errNoCopies        = errors.New("replication requires at least one copy")
+	errNotEnoughPieces = errors.New("not enough pieces to recover data")
+	errTooManyPieces   = errors.New("erasure code has too many pieces")
+
+	errReplicationDataPieces = errors.New("replication requires exactly one data piece")
+
+	// erasureCoders is the registry of erasure coders that can be stored in
+	// .sia files and in the renter database. A coder is identified by its
+	// name, which is followed by a fixed number of uint64 parameters that are
+	// passed to the coder's constructor.
+	erasureCoders = map[string]erasureCoderType{
+		rsCodeName: {
+			numParams: 2,
+			new: func(p []uint64) (modules.ErasureCoder, error) {
+				return NewRSCode(int(p[0]), int(p[1]))
+			},
+		},
+		rsSubCodeName: {
+			numParams: 2,
+			new: func(p []uint64) (modules.ErasureCoder, error) {
+				return NewRSSubCode(int(p[0]), int(p[1]))
+			},
+		},
+		replicationCodeName: {
+			numParams: 1,
+			new: func(p []uint64) (modules.ErasureCoder, error) {
+				return NewReplicationCode(int(p[0]))
+			},
+		},
+	}
+)
+
+type (
+	// An erasureCoderType describes how to construct a registered erasure
+	// coder from its persisted parameters.
+	erasureCoderType struct {
+		numParams int
+		new       func(params []uint64) (modules.ErasureCoder, error)
+	}
+
+	// A persistableCoder is an erasure coder that appears in the erasureCoders
+	// registry, and can therefore be saved alongside a file.
+	persistableCoder interface {
+		modules.ErasureCoder
+
+		// codeName returns the name under which the coder is registered.
+		codeName() string
+
+		// codeParams returns the parameters that were used to construct the
+		// coder.
+		codeParams() []uint64
+	}
+
+	// A partialRecoverer is an erasure coder whose pieces are built from
+	// independently encoded segments, which allows a range of a chunk to be
+	// recovered from the corresponding ranges of its pieces.
+	partialRecoverer interface {
+		modules.ErasureCoder
+
+		// pieceRange returns the range of each piece that is needed to
+		// recover length bytes of the chunk, starting at offset, given the
+		// length of the pieces.
+		pieceRange(offset, length, pieceLen uint64) (pieceOffset, pieceLength uint64)
+
+		// recoverRange recovers length bytes of the chunk, starting at
+		// offset, and writes them to w. The pieces must have been trimmed to
+		// the range returned by pieceRange, with missing pieces set to nil.
+		recoverRange(pieces [][]byte, offset, length uint64, w io.Writer) error
+	}
+)
+
 // rsCode is a Reed-Solomon encoder/decoder. It implements the
 // modules.ErasureCoder interface.
 type rsCode struct {
@@ -51,6 +143,14 @@ func (rs *rsCode) Recover(pieces [][]byte, n uint64, w io.Writer) error {
 	return rs.enc.Join(w, pieces, int(n))
 }
 
+// codeName implements the persistableCoder interface.
+func (rs *rsCode) codeName() string { return rsCodeName }
+
+// codeParams implements the persistableCoder interface.
+func (rs *rsCode) codeParams() []uint64 {
+	return []uint64{uint64(rs.dataPieces), uint64(rs.numPieces - rs.dataPieces)}
+}
+
 // NewRSCode creates a new Reed-Solomon encoder/decoder using the supplied
 // parameters.
 func NewRSCode(nData, nParity int) (modules.ErasureCoder, error) {
@@ -64,3 +164,255 @@ func NewRSCode(nData, nParity int) (modules.ErasureCoder, error) {
 		dataPieces: nData,
 	}, nil
 }
+
+// rsSubCode is a Reed-Solomon encoder/decoder that encodes each segment of a
+// chunk separately. Segment i of every piece is derived from the same stripe
+// of the chunk, so any byte range of the chunk can be recovered from only the
+// matching segments of MinPieces pieces. Downloads do not yet take advantage
+// of this: pieces are encrypted and authenticated as a whole, so they must be
+// fetched in full before they can be decoded. Pieces have the same length
+// as those of rsCode; if the length is not a multiple of the segment size, the
+// last stripe is shorter. It implements the modules.ErasureCoder and
+// partialRecoverer interfaces.
+type rsSubCode struct {
+	rsCode
+	segmentSize uint64
+}
+
+// stripeSize returns the number of chunk bytes that are encoded into a single
+// segment of each piece.
+func (rs *rsSubCode) stripeSize() uint64 {
+	return rs.segmentSize * uint64(rs.dataPieces)
+}
+
+// stripeSegment returns the range of each piece that holds a stripe, given
+// the length of the pieces.
+func (rs *rsSubCode) stripeSegment(stripe, pieceLen uint64) (segStart, segEnd uint64) {
+	segStart, segEnd = stripe*rs.segmentSize, (stripe+1)*rs.segmentSize
+	if segEnd > pieceLen {
+		segEnd = pieceLen
+	}
+	return segStart, segEnd
+}
+
+// Encode splits data into stripes of MinPieces segments, and encodes each
+// stripe into one segment of every piece.
+func (rs *rsSubCode) Encode(data []byte) ([][]byte, error) {
+	// Pad the data to a whole number of bytes per piece.
+	pieceLen := (uint64(len(data)) + uint64(rs.dataPieces) - 1) / uint64(rs.dataPieces)
+	if pieceLen == 0 {
+		pieceLen = 1
+	}
+	padded := make([]byte, pieceLen*uint64(rs.dataPieces))
+	copy(padded, data)
+
+	pieces := make([][]byte, rs.numPieces)
+	for i := range pieces {
+		pieces[i] = make([]byte, pieceLen)
+	}
+	shards := make([][]byte, rs.numPieces)
+	for stripe := uint64(0); stripe*rs.segmentSize < pieceLen; stripe++ {
+		segStart, segEnd := rs.stripeSegment(stripe, pieceLen)
+		for i := range shards {
+			shards[i] = pieces[i][segStart:segEnd]
+		}
+		for i := 0; i < rs.dataPieces; i++ {
+			dataStart := stripe*rs.stripeSize() + uint64(i)*(segEnd-segStart)
+			copy(shards[i], padded[dataStart:])
+		}
+		// Encode writes the parity segments directly into the pieces.
+		err := rs.enc.Encode(shards)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pieces, nil
+}
+
+// Recover recovers the original data from pieces (including parity) and
+// writes it to w. The pieces may be complete, or may all be trimmed to the
+// same range returned by pieceRange, in which case the corresponding stripes
+// of the chunk are recovered.
+func (rs *rsSubCode) Recover(pieces [][]byte, n uint64, w io.Writer) error {
+	// Determine the number of stripes covered by the pieces.
+	var pieceLen uint64
+	available := 0
+	for _, p := range pieces {
+		if p == nil {
+			continue
+		}
+		if available > 0 && uint64(len(p)) != pieceLen {
+			return errBadPieces
+		}
+		pieceLen = uint64(len(p))
+		available++
+	}
+	if available < rs.dataPieces {
+		return errNotEnoughPieces
+	}
+
+	shards := make([][]byte, len(pieces))
+	for stripe := uint64(0); stripe*rs.segmentSize < pieceLen && n > 0; stripe++ {
+		segStart, segEnd := rs.stripeSegment(stripe, pieceLen)
+		for i := range shards {
+			shards[i] = nil
+			if pieces[i] != nil {
+				shards[i] = pieces[i][segStart:segEnd]
+			}
+		}
+		err := rs.enc.Reconstruct(shards)
+		if err != nil {
+			return err
+		}
+		for _, segment := range shards[:rs.dataPieces] {
+			if n < uint64(len(segment)) {
+				segment = segment[:n]
+			}
+			_, err = w.Write(segment)
+			if err != nil {
+				return err
+			}
+			n -= uint64(len(segment))
+			if n == 0 {
+				break
+			}
+		}
+	}
+	if n != 0 {
+		return errNotEnoughPieces
+	}
+	return nil
+}
+
+// pieceRange implements the partialRecoverer interface.
+func (rs *rsSubCode) pieceRange(offset, length, pieceLen uint64) (pieceOffset, pieceLength uint64) {
+	firstStripe := offset / rs.stripeSize()
+	endStripe := (offset + length) / rs.stripeSize()
+	if (offset+length)%rs.stripeSize() != 0 {
+		endStripe++
+	}
+	pieceOffset, _ = rs.stripeSegment(firstStripe, pieceLen)
+	_, pieceEnd := rs.stripeSegment(endStripe-1, pieceLen)
+	return pieceOffset, pieceEnd - pieceOffset
+}
+
+// recoverRange implements the partialRecoverer interface.
+func (rs *rsSubCode) recoverRange(pieces [][]byte, offset, length uint64, w io.Writer) error {
+	// The trimmed pieces start at the stripe containing offset; recover from
+	// the start of that stripe and discard the leading bytes.
+	skip := offset % rs.stripeSize()
+	buf := new(bytes.Buffer)
+	err := rs.Recover(pieces, skip+length, buf)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes()[skip:])
+	return err
+}
+
+// codeName implements the persistableCoder interface.
+func (rs *rsSubCode) codeName() string { return rsSubCodeName }
+
+// NewRSSubCode creates a new Reed-Solomon encoder/decoder that encodes the
+// chunk in stripes of crypto.SegmentSize bytes per piece, so that a range of
+// the chunk can be recovered from the matching ranges of its pieces.
+func NewRSSubCode(nData, nParity int) (modules.ErasureCoder, error) {
+	enc, err := reedsolomon.New(nData, nParity)
+	if err != nil {
+		return nil, err
+	}
+	return &rsSubCode{
+		rsCode: rsCode{
+			enc:        enc,
+			numPieces:  nData + nParity,
+			dataPieces: nData,
+		},
+		segmentSize: crypto.SegmentSize,
+	}, nil
+}
+
+// replicationCode is an erasure coder that stores a full copy of the data in
+// every piece. It implements the modules.ErasureCoder interface.
+type replicationCode struct {
+	copies int
+}
+
+// NumPieces returns the number of pieces returned by Encode.
+func (rc *replicationCode) NumPieces() int { return rc.copies }
+
+// MinPieces returns the minimum number of pieces that must be present to
+// recover the original data, which for replication is always 1.
+func (rc *replicationCode) MinPieces() int { return 1 }
+
+// Encode returns one copy of data per piece.
+func (rc *replicationCode) Encode(data []byte) ([][]byte, error) {
+	pieces := make([][]byte, rc.copies)
+	for i := range pieces {
+		pieces[i] = append([]byte(nil), data...)
+	}
+	return pieces, nil
+}
+
+// Recover writes the first n bytes of any available piece to w.
+func (rc *replicationCode) Recover(pieces [][]byte, n uint64, w io.Writer) error {
+	for _, p := range pieces {
+		if p == nil {
+			continue
+		}
+		if uint64(len(p)) < n {
+			return errBadPieces
+		}
+		_, err := w.Write(p[:n])
+		return err
+	}
+	return errNotEnoughPieces
+}
+
+// codeName implements the persistableCoder interface.
+func (rc *replicationCode) codeName() string { return replicationCodeName }
+
+// codeParams implements the persistableCoder interface.
+func (rc *replicationCode) codeParams() []uint64 { return []uint64{uint64(rc.copies)} }
+
+// NewReplicationCode creates a new erasure coder that stores the supplied
+// number of full copies of the data.
+func NewReplicationCode(copies int) (modules.ErasureCoder, error) {
+	if copies < 1 {
+		return nil, errNoCopies
+	} else if copies > maxErasurePieces {
+		return nil, errTooManyPieces
+	}
+	return &replicationCode{copies: copies}, nil
+}
+
+// newErasureCoder creates the erasure code selected by an upload. Reed-Solomon
+// codes that do not specify the number of pieces use defaultDataPieces and
+// defaultParityPieces. Replication stores one data piece and parityPieces
+// copies of it.
+func newErasureCoder(codeType string, dataPieces, parityPieces int) (modules.ErasureCoder, error) {
+	if dataPieces < 0 || parityPieces < 0 {
+		return nil, errBadPieces
+	} else if dataPieces+parityPieces > maxErasurePieces {
+		return nil, errTooManyPieces
+	}
+	switch codeType {
+	case "", modules.ErasureCodeReedSolomon, modules.ErasureCodeReedSolomonSubchunk:
+		if dataPieces == 0 && parityPieces == 0 {
+			dataPieces, parityPieces = defaultDataPieces, defaultParityPieces
+		}
+		if codeType == modules.ErasureCodeReedSolomonSubchunk {
+			return NewRSSubCode(dataPieces, parityPieces)
+		}
+		return NewRSCode(dataPieces, parityPieces)
+	case modules.ErasureCodeReplication:
+		if dataPieces == 0 && parityPieces == 0 {
+			dataPieces, parityPieces = 1, defaultReplicationCopies-1
+		}
+		if dataPieces != 1 {
+			return nil, errReplicationDataPieces
+		}
+		return NewReplicationCode(dataPieces + parityPieces)
+	default:
+		return nil, modules.ErrUnknownErasureCode
+	}
+}
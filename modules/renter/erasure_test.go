@@ -5,6 +5,8 @@ import (
 	"crypto/rand"
 	"io/ioutil"
 	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
 )
 
 func TestRSEncode(t *testing.T) {
@@ -32,6 +34,175 @@ func TestRSEncode(t *testing.T) {
 	}
 }
 
+// TestRSSubCodeRecover tests that the sub-chunk Reed-Solomon coder can
+// recover both complete chunks and arbitrary ranges of a chunk.
+func TestRSSubCodeRecover(t *testing.T) {
+	rsc, err := NewRSSubCode(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 777)
+	rand.Read(data)
+	pieces, err := rsc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recover the full chunk with two pieces missing.
+	pieces[0], pieces[3] = nil, nil
+	buf := new(bytes.Buffer)
+	err = rsc.Recover(pieces, 777, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Fatal("recovered data does not match original")
+	}
+
+	// Recover a range of the chunk from trimmed pieces.
+	pr := rsc.(partialRecoverer)
+	tests := []struct{ offset, length uint64 }{
+		{0, 1},
+		{100, 300},
+		{255, 2},
+		{500, 277},
+	}
+	for _, test := range tests {
+		pieceOffset, pieceLength := pr.pieceRange(test.offset, test.length, uint64(len(pieces[1])))
+		trimmed := make([][]byte, len(pieces))
+		for i, p := range pieces {
+			if p != nil {
+				trimmed[i] = p[pieceOffset : pieceOffset+pieceLength]
+			}
+		}
+		buf.Reset()
+		err = pr.recoverRange(trimmed, test.offset, test.length, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data[test.offset:test.offset+test.length], buf.Bytes()) {
+			t.Fatalf("recovered range %v+%v does not match original", test.offset, test.length)
+		}
+	}
+
+	// Recovery should fail with too many pieces missing.
+	pieces[1] = nil
+	err = rsc.Recover(pieces, 777, buf)
+	if err != errNotEnoughPieces {
+		t.Fatal("expected errNotEnoughPieces, got", err)
+	}
+}
+
+// TestRSSubCodePieceSize tests that the sub-chunk Reed-Solomon coder produces
+// pieces of the same length as the plain Reed-Solomon coder, even if the length
+// is not a multiple of the segment size.
+func TestRSSubCodePieceSize(t *testing.T) {
+	rsc, err := NewRSSubCode(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const pieceSize = 100
+	data := make([]byte, pieceSize*3)
+	rand.Read(data)
+	pieces, err := rsc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pieces {
+		if len(p) != pieceSize {
+			t.Fatal("wrong piece length:", len(p))
+		}
+	}
+
+	// Recover a range that includes the short last stripe.
+	pieces[1] = nil
+	pr := rsc.(partialRecoverer)
+	pieceOffset, pieceLength := pr.pieceRange(200, 90, pieceSize)
+	trimmed := make([][]byte, len(pieces))
+	for i, p := range pieces {
+		if p != nil {
+			trimmed[i] = p[pieceOffset : pieceOffset+pieceLength]
+		}
+	}
+	buf := new(bytes.Buffer)
+	err = pr.recoverRange(trimmed, 200, 90, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[200:290], buf.Bytes()) {
+		t.Fatal("recovered range does not match original")
+	}
+}
+
+// TestNewErasureCoder tests the selection of erasure codes for uploads.
+func TestNewErasureCoder(t *testing.T) {
+	tests := []struct {
+		codeType     string
+		data, parity int
+		name         string
+		numPieces    int
+		err          error
+	}{
+		{"", 0, 0, rsCodeName, defaultDataPieces + defaultParityPieces, nil},
+		{modules.ErasureCodeReedSolomon, 4, 2, rsCodeName, 6, nil},
+		{modules.ErasureCodeReedSolomonSubchunk, 0, 0, rsSubCodeName, defaultDataPieces + defaultParityPieces, nil},
+		{modules.ErasureCodeReplication, 0, 0, replicationCodeName, defaultReplicationCopies, nil},
+		{modules.ErasureCodeReplication, 1, 4, replicationCodeName, 5, nil},
+		{modules.ErasureCodeReplication, 2, 4, "", 0, errReplicationDataPieces},
+		{modules.ErasureCodeReedSolomon, 200, 100, "", 0, errTooManyPieces},
+		{modules.ErasureCodeReedSolomon, -1, 2, "", 0, errBadPieces},
+		{"fountain", 0, 0, "", 0, modules.ErrUnknownErasureCode},
+	}
+	for _, test := range tests {
+		code, err := newErasureCoder(test.codeType, test.data, test.parity)
+		if err != test.err {
+			t.Errorf("%q %v+%v: expected %v, got %v", test.codeType, test.data, test.parity, test.err, err)
+			continue
+		} else if err != nil {
+			continue
+		}
+		if name := code.(persistableCoder).codeName(); name != test.name || code.NumPieces() != test.numPieces {
+			t.Errorf("%q %v+%v: got %v with %v pieces", test.codeType, test.data, test.parity, name, code.NumPieces())
+		}
+	}
+}
+
+// TestReplicationCode tests the replication erasure coder.
+func TestReplicationCode(t *testing.T) {
+	if _, err := NewReplicationCode(0); err != errNoCopies {
+		t.Fatal("expected errNoCopies, got", err)
+	}
+	rc, err := NewReplicationCode(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 777)
+	rand.Read(data)
+	pieces, err := rc.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pieces) != rc.NumPieces() {
+		t.Fatal("wrong number of pieces:", len(pieces))
+	}
+
+	pieces[0], pieces[1] = nil, nil
+	buf := new(bytes.Buffer)
+	err = rc.Recover(pieces, 700, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[:700], buf.Bytes()) {
+		t.Fatal("recovered data does not match original")
+	}
+
+	pieces[2] = nil
+	err = rc.Recover(pieces, 700, buf)
+	if err != errNotEnoughPieces {
+		t.Fatal("expected errNotEnoughPieces, got", err)
+	}
+}
+
 func BenchmarkRSEncode(b *testing.B) {
 	rsc, err := NewRSCode(80, 20)
 	if err != nil {
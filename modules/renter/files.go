@@ -2,8 +2,6 @@ package renter
 
 import (
 	"errors"
-	"os"
-	"path/filepath"
 	"sync"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -19,16 +17,19 @@ var (
 // A file is a single file that has been uploaded to the network. Files are
 // split into equal-length chunks, which are then erasure-coded into pieces.
 // Each piece is separately encrypted, using a key derived from the file's
-// master key. The pieces are uploaded to hosts in groups, such that one file
-// contract covers many pieces.
+// master key and the file's cipher type. The pieces are uploaded to hosts in
+// groups, such that one file contract covers many pieces.
 type file struct {
 	name        string
 	size        uint64
 	contracts   map[types.FileContractID]fileContract
 	masterKey   crypto.TwofishKey
+	cipherType  crypto.CipherType
 	erasureCode modules.ErasureCoder
 	pieceSize   uint64
 	mode        uint32 // actually an os.FileMode
+	version     uint64
+	chunkHashes []crypto.Hash // used to detect unchanged chunks between versions
 	mu          sync.RWMutex
 }
 
@@ -51,8 +52,10 @@ type pieceData struct {
 }
 
 // deriveKey derives the key used to encrypt and decrypt a specific file piece.
-func deriveKey(masterKey crypto.TwofishKey, chunkIndex, pieceIndex uint64) crypto.TwofishKey {
-	return crypto.TwofishKey(crypto.HashAll(masterKey, chunkIndex, pieceIndex))
+// The derived entropy does not depend on the cipher type, so files encrypted
+// with Twofish before cipher types were introduced use the same keys.
+func deriveKey(ct crypto.CipherType, masterKey crypto.TwofishKey, chunkIndex, pieceIndex uint64) (crypto.CipherKey, error) {
+	return ct.NewKey(crypto.HashAll(masterKey, chunkIndex, pieceIndex))
 }
 
 // chunkSize returns the size of one chunk.
@@ -127,6 +130,7 @@ func newFile(name string, code modules.ErasureCoder, pieceSize, fileSize uint64)
 		size:        fileSize,
 		contracts:   make(map[types.FileContractID]fileContract),
 		masterKey:   key,
+		cipherType:  crypto.TypeTwofish,
 		erasureCode: code,
 		pieceSize:   pieceSize,
 	}
@@ -142,11 +146,10 @@ func (r *Renter) DeleteFile(nickname string) error {
 		return ErrUnknownNickname
 	}
 	delete(r.files, nickname)
+	delete(r.versions, nickname)
+	delete(r.tracking, nickname)
 
-	os.Remove(filepath.Join(r.persistDir, f.name+ShareExtension))
-
-	r.save()
-	return nil
+	return r.deleteFile(f.name)
 }
 
 // FileList returns all of the files that the renter has.
@@ -158,6 +161,7 @@ func (r *Renter) FileList() []modules.FileInfo {
 	for _, f := range r.files {
 		files = append(files, modules.FileInfo{
 			Nickname:       f.name,
+			Version:        f.version,
 			Filesize:       f.size,
 			Available:      f.available(),
 			UploadProgress: f.uploadProgress(),
@@ -188,13 +192,12 @@ func (r *Renter) RenameFile(currentName, newName string) error {
 		}
 
 		// Do the renaming.
+		r.deleteFile(currentName)
 		file.name = newName
-		r.saveFile(file)
 		delete(r.files, currentName)
 		r.files[newName] = file
 
-		r.save()
-		return nil
+		return r.saveFile(file)
 
 	*/
 }
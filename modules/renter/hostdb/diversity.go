@@ -0,0 +1,78 @@
+package hostdb
+
+// diversity.go contains the functions that keep the hosts of a chunk on
+// different networks. Hosts that share a subnet are likely to share a
+// datacenter or an operator, so a single outage could take all of them
+// offline at once.
+
+import (
+	"errors"
+	"net"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// defaultIPv4SubnetBits is the default prefix length of the IPv4 subnets
+	// that may contain at most one host of a chunk.
+	defaultIPv4SubnetBits = 24
+
+	// defaultIPv6SubnetBits is the default prefix length of the IPv6 subnets
+	// that may contain at most one host of a chunk.
+	defaultIPv6SubnetBits = 48
+)
+
+var (
+	errBadSubnetBits = errors.New("subnet prefix length is out of range")
+)
+
+// hostIP returns the IP address of a host, or nil if it is not known. The IP
+// of a host is learned when the host is scanned; addresses that are IP
+// literals are used as-is. hostIP must be called under lock.
+func (hdb *HostDB) hostIP(addr modules.NetAddress) net.IP {
+	if entry, exists := hdb.allHosts[addr]; exists && entry.ip != nil {
+		return entry.ip
+	}
+	return net.ParseIP(addr.Host())
+}
+
+// hostSubnet returns the subnet containing a host, or the empty string if the
+// host's IP is not known or diversity is disabled for its address family.
+// Loopback hosts are exempt, as they only appear when testing on a single
+// machine. hostSubnet must be called under lock.
+func (hdb *HostDB) hostSubnet(addr modules.NetAddress) string {
+	ip := hdb.hostIP(addr)
+	if ip == nil || ip.IsLoopback() {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		if hdb.diversity.IPv4SubnetBits == 0 {
+			return ""
+		}
+		return ip4.Mask(net.CIDRMask(hdb.diversity.IPv4SubnetBits, 32)).String()
+	}
+	if hdb.diversity.IPv6SubnetBits == 0 {
+		return ""
+	}
+	return ip.Mask(net.CIDRMask(hdb.diversity.IPv6SubnetBits, 128)).String()
+}
+
+// HostDiversity returns the subnet sizes used to enforce host diversity.
+func (hdb *HostDB) HostDiversity() modules.HostDiversity {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return hdb.diversity
+}
+
+// SetHostDiversity changes the subnet sizes used to enforce host diversity. A
+// prefix length of 0 disables diversity for that address family.
+func (hdb *HostDB) SetHostDiversity(hd modules.HostDiversity) error {
+	if hd.IPv4SubnetBits < 0 || hd.IPv4SubnetBits > 32 || hd.IPv6SubnetBits < 0 || hd.IPv6SubnetBits > 128 {
+		return errBadSubnetBits
+	}
+
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.diversity = hd
+	return hdb.save()
+}
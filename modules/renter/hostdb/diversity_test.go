@@ -0,0 +1,100 @@
+package hostdb
+
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestDiverseRandomHosts checks that randomHosts never returns two hosts from
+// the same subnet.
+func TestDiverseRandomHosts(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+		diversity: modules.HostDiversity{
+			IPv4SubnetBits: defaultIPv4SubnetBits,
+			IPv6SubnetBits: defaultIPv6SubnetBits,
+		},
+	}
+	// Hosts 0-9 are spread across 5 subnets, two hosts per subnet.
+	for i := 0; i < 10; i++ {
+		entry := hostEntry{
+			HostSettings: modules.HostSettings{IPAddress: fakeAddr(uint8(i))},
+			weight:       types.NewCurrency64(10),
+			ip:           net.IPv4(10, 0, byte(i/2), byte(i)),
+		}
+		hdb.allHosts[entry.IPAddress] = &entry
+		hdb.insertNode(&entry)
+	}
+
+	for i := 0; i < 20; i++ {
+		hosts := hdb.randomHosts(10, nil)
+		if len(hosts) != 5 {
+			t.Fatal("expected one host per subnet, got", len(hosts))
+		}
+		subnets := make(map[string]struct{})
+		for _, host := range hosts {
+			subnet := hdb.hostSubnet(host.IPAddress)
+			if _, exists := subnets[subnet]; exists {
+				t.Fatal("two hosts selected from subnet", subnet)
+			}
+			subnets[subnet] = struct{}{}
+		}
+	}
+
+	// Ignoring a host also excludes the other host in its subnet.
+	hosts := hdb.randomHosts(10, []modules.NetAddress{fakeAddr(0)})
+	if len(hosts) != 4 {
+		t.Fatal("expected 4 hosts, got", len(hosts))
+	}
+	for _, host := range hosts {
+		if host.IPAddress == fakeAddr(1) {
+			t.Fatal("host in the subnet of an ignored host was selected")
+		}
+	}
+
+	// Hosts skipped for sharing a subnet must be restored to the tree.
+	if len(hdb.activeHosts) != 10 {
+		t.Fatal("skipped hosts were not restored:", len(hdb.activeHosts))
+	}
+
+	// With diversity disabled, every host can be selected.
+	hdb.diversity = modules.HostDiversity{}
+	if hosts := hdb.randomHosts(10, nil); len(hosts) != 10 {
+		t.Fatal("expected 10 hosts, got", len(hosts))
+	}
+}
+
+// TestHostSubnet probes the subnet calculation for IPv4, IPv6, and loopback
+// addresses.
+func TestHostSubnet(t *testing.T) {
+	hdb := &HostDB{
+		allHosts: make(map[modules.NetAddress]*hostEntry),
+		diversity: modules.HostDiversity{
+			IPv4SubnetBits: 16,
+			IPv6SubnetBits: 32,
+		},
+	}
+	tests := []struct {
+		addr   modules.NetAddress
+		subnet string
+	}{
+		{"1.2.3.4:9982", "1.2.0.0"},
+		{"[2001:db8:1::1]:9982", "2001:db8::"},
+		{"127.0.0.1:9982", ""},
+		{"example.com:9982", ""},
+	}
+	for _, test := range tests {
+		if subnet := hdb.hostSubnet(test.addr); subnet != test.subnet {
+			t.Errorf("subnet of %v: expected %q, got %q", test.addr, test.subnet, subnet)
+		}
+	}
+
+	if err := hdb.SetHostDiversity(modules.HostDiversity{IPv4SubnetBits: 33}); err != errBadSubnetBits {
+		t.Fatal("expected errBadSubnetBits, got", err)
+	}
+}
@@ -0,0 +1,187 @@
+package hostdb
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errInsufficientFunds = errors.New("contract has insufficient funds to pay for download")
+	errUnknownContract   = errors.New("no record of that contract")
+)
+
+// A Downloader retrieves data from a host, paying for each request with a
+// revision of the contract that stores the data. Hosts that predate paid
+// downloads are not paid.
+type Downloader interface {
+	// Download requests length bytes of the contract's data, starting at
+	// offset.
+	Download(offset, length uint64) ([]byte, error)
+
+	// Address returns the address of the host.
+	Address() modules.NetAddress
+
+	// Close terminates the connection to the host.
+	Close() error
+}
+
+// A hostDownloader downloads data from a host. It implements the Downloader
+// interface. hostDownloaders are NOT thread-safe; calls to Download must
+// happen in serial.
+type hostDownloader struct {
+	// constants
+	addr       modules.NetAddress
+	contractID types.FileContractID
+	price      types.Currency // per byte
+	free       bool           // host predates paid downloads
+
+	// resources
+	conn net.Conn
+	hdb  *HostDB
+}
+
+// Address returns the NetAddress of the host.
+func (hd *hostDownloader) Address() modules.NetAddress { return hd.addr }
+
+// Close cleanly ends the download with the host and closes the connection.
+// The host submits the last payment revision to the transaction pool.
+func (hd *hostDownloader) Close() error {
+	// ignore error; we'll need to close conn anyway
+	encoding.WriteObject(hd.conn, modules.DownloadRequest{Offset: 0, Length: 0})
+	return hd.conn.Close()
+}
+
+// downloadFree downloads length bytes starting at offset from a host that
+// predates paid downloads, which serves data without payment.
+func (hd *hostDownloader) downloadFree(offset, length uint64) ([]byte, error) {
+	hd.conn.SetDeadline(time.Now().Add(2 * time.Minute)) // sufficient to transfer 4 MB over 250 kbps
+	defer hd.conn.SetDeadline(time.Time{})
+	if err := encoding.WriteObject(hd.conn, modules.DownloadRequest{Offset: offset, Length: length}); err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(hd.conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Download pays the host for length bytes and then downloads them, starting
+// at offset. Hosts that predate paid downloads are not paid.
+func (hd *hostDownloader) Download(offset, length uint64) ([]byte, error) {
+	if hd.free {
+		return hd.downloadFree(offset, length)
+	}
+
+	// The contract may have been revised by an uploader since the last
+	// download, so the latest revision is fetched each time.
+	hd.hdb.mu.RLock()
+	contract, exists := hd.hdb.contracts[hd.contractID]
+	hd.hdb.mu.RUnlock()
+	if !exists {
+		return nil, errUnknownContract
+	}
+	price := hd.price.Mul(types.NewCurrency64(length))
+	if price.Cmp(contract.LastRevision.NewValidProofOutputs[0].Value) > 0 {
+		return nil, errInsufficientFunds
+	}
+	rev := newRevision(contract.LastRevision, 0, contract.LastRevision.NewFileMerkleRoot, price)
+	signedTxn := signRevision(rev, contract.SecretKey)
+
+	hd.conn.SetDeadline(time.Now().Add(2 * time.Minute)) // sufficient to transfer 4 MB over 250 kbps
+	defer hd.conn.SetDeadline(time.Time{})
+
+	// send request and payment
+	if err := encoding.WriteObject(hd.conn, modules.DownloadRequest{Offset: offset, Length: length}); err != nil {
+		return nil, err
+	}
+	if err := encoding.WriteObject(hd.conn, signedTxn); err != nil {
+		return nil, errors.New("couldn't send payment revision: " + err.Error())
+	}
+
+	// host sends acceptance
+	var response string
+	if err := encoding.ReadObject(hd.conn, &response, 128); err != nil {
+		return nil, errors.New("couldn't read host acceptance: " + err.Error())
+	}
+	if response != modules.AcceptResponse {
+		return nil, errors.New("host rejected payment: " + response)
+	}
+
+	// read txn signed by host
+	var signedHostTxn types.Transaction
+	if err := encoding.ReadObject(hd.conn, &signedHostTxn, types.BlockSizeLimit); err != nil {
+		return nil, errors.New("couldn't read signed payment revision: " + err.Error())
+	}
+	if signedHostTxn.ID() != signedTxn.ID() {
+		return nil, errors.New("host sent bad signed transaction")
+	}
+
+	// the payment is final once the host has signed it, so the contract is
+	// updated before the data is read
+	contract.LastRevision = rev
+	contract.LastRevisionTxn = signedHostTxn
+	hd.hdb.mu.Lock()
+	hd.hdb.contracts[contract.ID] = contract
+	hd.hdb.save()
+	hd.hdb.mu.Unlock()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(hd.conn, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// NewDownloader initiates the download process with the host that stores
+// the data of a contract, and returns a Downloader.
+func (hdb *HostDB) NewDownloader(id types.FileContractID) (Downloader, error) {
+	hdb.mu.RLock()
+	hc, exists := hdb.contracts[id]
+	var price types.Currency
+	var free bool
+	entry, known := hdb.allHosts[hc.IP]
+	if known {
+		price, free = entry.DownloadPrice, entry.freeDownloads
+	}
+	hdb.mu.RUnlock()
+	if !exists {
+		return nil, errUnknownContract
+	} else if !known {
+		return nil, errors.New("no record of that host")
+	}
+	if price.Cmp(maxDownloadPrice) > 0 {
+		return nil, errTooExpensive
+	}
+
+	conn, err := net.DialTimeout("tcp", string(hc.IP), 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(15 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+	if err := encoding.WriteObject(conn, modules.RPCDownload); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := encoding.WriteObject(conn, id); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &hostDownloader{
+		addr:       hc.IP,
+		contractID: id,
+		price:      price,
+		free:       free,
+
+		conn: conn,
+		hdb:  hdb,
+	}, nil
+}
@@ -0,0 +1,183 @@
+package hostdb
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestPaidDownload checks that each download from a host is paid for with a
+// revision of the contract.
+func TestPaidDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostDBTester("TestPaidDownload")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create a host and add it to the hostdb
+	h, settings, err := ht.addTestHost("TestPaidDownload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// form a contract and upload some data
+	data, err := crypto.RandBytes(777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, err := ht.hostdb.newContract(settings, uint64(len(data)), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hu, err := ht.hostdb.newHostUploader(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hu.Upload(data); err != nil {
+		t.Fatal(err)
+	}
+	hu.Close()
+
+	// download part of the data
+	d, err := ht.hostdb.NewDownloader(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	before := ht.hostdb.contracts[contract.ID].LastRevision
+	downloaded, err := d.Download(100, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data[100:600]) {
+		t.Fatal("downloaded data does not match uploaded data")
+	}
+
+	// the host should have been paid for 500 bytes
+	after := ht.hostdb.contracts[contract.ID].LastRevision
+	payment := settings.DownloadPrice.Mul(types.NewCurrency64(500))
+	if after.NewRevisionNumber != before.NewRevisionNumber+1 {
+		t.Fatal("download did not revise the contract")
+	}
+	if after.NewValidProofOutputs[1].Value.Cmp(before.NewValidProofOutputs[1].Value.Add(payment)) != 0 {
+		t.Fatal("host was not paid for the download")
+	}
+	if after.NewFileMerkleRoot != before.NewFileMerkleRoot || after.NewFileSize != before.NewFileSize {
+		t.Fatal("download changed the contract's file")
+	}
+
+	// requests beyond the end of the file should be rejected without payment
+	if _, err := d.Download(700, 100); err == nil {
+		t.Fatal("expected download beyond the end of the file to fail")
+	}
+	if ht.hostdb.contracts[contract.ID].LastRevision.NewRevisionNumber != after.NewRevisionNumber {
+		t.Fatal("rejected download revised the contract")
+	}
+}
+
+// serveLegacyHost serves the settings and downloads of a host that predates
+// paid downloads on l, until l is closed.
+func serveLegacyHost(l net.Listener, data []byte) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var id types.Specifier
+			if err := encoding.ReadObject(conn, &id, 16); err != nil {
+				return
+			}
+			switch id {
+			case modules.RPCSettings:
+				encoding.WriteObject(conn, unpricedHostSettings{
+					Legacy:  legacyHostSettings{IPAddress: modules.NetAddress(l.Addr().String())},
+					Version: "0.4.7",
+				})
+			case modules.RPCDownload:
+				var fcid types.FileContractID
+				if err := encoding.ReadObject(conn, &fcid, crypto.HashSize); err != nil {
+					return
+				}
+				for {
+					var req modules.DownloadRequest
+					if err := encoding.ReadObject(conn, &req, 16); err != nil || req.Length == 0 {
+						return
+					}
+					conn.Write(data[req.Offset : req.Offset+req.Length])
+				}
+			}
+		}()
+	}
+}
+
+// TestFreeDownload checks that hosts that predate paid downloads are
+// downloaded from without payment.
+func TestFreeDownload(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostDBTester("TestFreeDownload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	data, err := crypto.RandBytes(777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serveLegacyHost(l, data)
+
+	// scan the host, which should be recognized as predating paid downloads
+	addr := modules.NetAddress(l.Addr().String())
+	entry := &hostEntry{
+		HostSettings: modules.HostSettings{IPAddress: addr},
+		reliability:  DefaultReliability,
+	}
+	contract := hostContract{IP: addr, ID: types.FileContractID{1}}
+	ht.hostdb.mu.Lock()
+	ht.hostdb.allHosts[addr] = entry
+	ht.hostdb.contracts[contract.ID] = contract
+	ht.hostdb.mu.Unlock()
+	ht.hostdb.probeHost(entry)
+	ht.hostdb.mu.RLock()
+	free := entry.freeDownloads
+	ht.hostdb.mu.RUnlock()
+	if !free {
+		t.Fatal("host in the unpriced format was not recognized as serving free downloads")
+	}
+
+	d, err := ht.hostdb.NewDownloader(contract.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	downloaded, err := d.Download(100, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data[100:600]) {
+		t.Fatal("downloaded data does not match the host's data")
+	}
+	ht.hostdb.mu.RLock()
+	defer ht.hostdb.mu.RUnlock()
+	if ht.hostdb.contracts[contract.ID].LastRevision.NewRevisionNumber != 0 {
+		t.Fatal("free download revised the contract")
+	}
+}
@@ -0,0 +1,52 @@
+package hostdb
+
+// filter.go contains the functions that manage the host filter, which lets the
+// user blacklist hosts or restrict uploads to a whitelist of hosts.
+
+import (
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// filtered returns true if the host filter prevents the host at addr from
+// being selected.
+func (hdb *HostDB) filtered(addr modules.NetAddress) bool {
+	_, listed := hdb.filteredHosts[addr]
+	switch hdb.filterMode {
+	case modules.HostFilterModeBlacklist:
+		return listed
+	case modules.HostFilterModeWhitelist:
+		return !listed
+	default:
+		return false
+	}
+}
+
+// HostFilter returns the host filter mode and the hosts in the filter.
+func (hdb *HostDB) HostFilter() (modules.HostFilterMode, []modules.NetAddress) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	hosts := make([]modules.NetAddress, 0, len(hdb.filteredHosts))
+	for addr := range hdb.filteredHosts {
+		hosts = append(hosts, addr)
+	}
+	return hdb.filterMode, hosts
+}
+
+// SetHostFilter changes the host filter mode and the hosts in the filter.
+// The filter applies to all future host selections.
+func (hdb *HostDB) SetHostFilter(mode modules.HostFilterMode, hosts []modules.NetAddress) error {
+	if mode < modules.HostFilterModeDisable || mode > modules.HostFilterModeWhitelist {
+		return modules.ErrUnknownHostFilterMode
+	}
+
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.filterMode = mode
+	hdb.filteredHosts = make(map[modules.NetAddress]struct{})
+	for _, addr := range hosts {
+		hdb.filteredHosts[addr] = struct{}{}
+	}
+	hdb.log.Printf("host filter set to %v with %v hosts", mode, len(hosts))
+	return hdb.save()
+}
@@ -0,0 +1,92 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestFilteredRandomHosts checks that randomHosts respects the blacklist and
+// whitelist modes of the host filter.
+func TestFilteredRandomHosts(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+	}
+	for i := 0; i < 10; i++ {
+		entry := hostEntry{
+			HostSettings: modules.HostSettings{IPAddress: fakeAddr(uint8(i))},
+			weight:       types.NewCurrency64(10),
+		}
+		hdb.insertNode(&entry)
+	}
+	hdb.filteredHosts = map[modules.NetAddress]struct{}{
+		fakeAddr(2): {},
+		fakeAddr(5): {},
+	}
+
+	// With the filter disabled, every host can be selected.
+	if hosts := hdb.randomHosts(10, nil); len(hosts) != 10 {
+		t.Fatal("expected 10 hosts, got", len(hosts))
+	}
+
+	// Blacklisted hosts are never selected.
+	hdb.filterMode = modules.HostFilterModeBlacklist
+	hosts := hdb.randomHosts(10, nil)
+	if len(hosts) != 8 {
+		t.Fatal("expected 8 hosts, got", len(hosts))
+	}
+	for _, host := range hosts {
+		if host.IPAddress == fakeAddr(2) || host.IPAddress == fakeAddr(5) {
+			t.Fatal("blacklisted host was selected:", host.IPAddress)
+		}
+	}
+
+	// Only whitelisted hosts are selected.
+	hdb.filterMode = modules.HostFilterModeWhitelist
+	hosts = hdb.randomHosts(10, []modules.NetAddress{fakeAddr(5)})
+	if len(hosts) != 1 || hosts[0].IPAddress != fakeAddr(2) {
+		t.Fatal("expected only the non-ignored whitelisted host, got", hosts)
+	}
+
+	// Filtered hosts must be restored to the tree after selection.
+	if len(hdb.activeHosts) != 10 {
+		t.Fatal("filtered hosts were not restored:", len(hdb.activeHosts))
+	}
+}
+
+// TestHostFilterPersist checks that the host filter survives a restart of
+// the hostdb.
+func TestHostFilterPersist(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdbt, err := newHostDBTester("TestHostFilterPersist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hdbt.Close()
+
+	err = hdbt.hostdb.SetHostFilter(modules.HostFilterMode(7), nil)
+	if err != modules.ErrUnknownHostFilterMode {
+		t.Fatal("expected ErrUnknownHostFilterMode, got", err)
+	}
+	err = hdbt.hostdb.SetHostFilter(modules.HostFilterModeWhitelist, []modules.NetAddress{"foo:1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdb, err := New(hdbt.cs, hdbt.wallet, hdbt.tpool, hdbt.hostdb.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mode, hosts := hdb.HostFilter()
+	if mode != modules.HostFilterModeWhitelist {
+		t.Fatal("wrong filter mode after reload:", mode)
+	}
+	if len(hosts) != 1 || hosts[0] != "foo:1234" {
+		t.Fatal("wrong filtered hosts after reload:", hosts)
+	}
+}
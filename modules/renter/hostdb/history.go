@@ -0,0 +1,151 @@
+package hostdb
+
+// history.go contains the functions that record the interactions between the
+// renter and each host. The history is used to derive the uptime and recent
+// failure rate of a host, which both factor into the host's score.
+
+import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// maxHostHistory is the number of interactions that are remembered for
+	// each host. Older interactions are discarded.
+	maxHostHistory = 250
+
+	// recentFailureWindow is the period over which the recent failure rate
+	// of a host is calculated.
+	recentFailureWindow = 7 * 24 * time.Hour
+)
+
+// The types of interaction that are recorded in the history of a host.
+const (
+	interactionScan     = "scan"
+	interactionUpload   = "upload"
+	interactionDownload = "download"
+	interactionProof    = "proof"
+)
+
+// The outcomes of the storage proof of a contract. A contract's proof status
+// is set exactly once, so that replaying the blockchain does not record the
+// same proof twice.
+const (
+	proofStatusValid  = "valid"
+	proofStatusMissed = "missed"
+)
+
+// A hostHistory is the list of interactions with a host, oldest first.
+type hostHistory []modules.HostInteraction
+
+// downtime returns the fraction of scans that the host failed to respond to.
+// A host that has never been scanned has no downtime.
+func (h hostHistory) downtime() float64 {
+	var scans, failures int
+	for _, hi := range h {
+		if hi.Type != interactionScan {
+			continue
+		}
+		scans++
+		if !hi.Success {
+			failures++
+		}
+	}
+	if scans == 0 {
+		return 0
+	}
+	return float64(failures) / float64(scans)
+}
+
+// failureRate returns the fraction of uploads, downloads, and storage proofs
+// since the given time that failed. Scans are not included, as they are
+// covered by the downtime.
+func (h hostHistory) failureRate(since time.Time) float64 {
+	var total, failures int
+	for _, hi := range h {
+		if hi.Type == interactionScan || hi.Timestamp.Before(since) {
+			continue
+		}
+		total++
+		if !hi.Success {
+			failures++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(failures) / float64(total)
+}
+
+// recordInteraction adds an interaction to the history of a host. The history
+// is saved to disk with the rest of the hostdb. recordInteraction must be
+// called under lock.
+func (hdb *HostDB) recordInteraction(addr modules.NetAddress, interaction string, success bool) {
+	h := append(hdb.history[addr], modules.HostInteraction{
+		Type:      interaction,
+		Success:   success,
+		Timestamp: time.Now(),
+	})
+	if len(h) > maxHostHistory {
+		h = append(hostHistory(nil), h[len(h)-maxHostHistory:]...)
+	}
+	hdb.history[addr] = h
+}
+
+// updateHistoryStats refreshes the uptime and failure rate of a host entry
+// from the host's history. updateHistoryStats must be called under lock.
+func (hdb *HostDB) updateHistoryStats(entry *hostEntry) {
+	h := hdb.history[entry.IPAddress]
+	entry.downtime = h.downtime()
+	entry.failureRate = h.failureRate(time.Now().Add(-recentFailureWindow))
+}
+
+// RecordDownload records the outcome of a download from a host.
+func (hdb *HostDB) RecordDownload(addr modules.NetAddress, success bool) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.recordInteraction(addr, interactionDownload, success)
+}
+
+// contractWindowEnd returns the end of the proof window of a contract, taking
+// the most recent revision into account.
+func contractWindowEnd(hc hostContract) types.BlockHeight {
+	if hc.LastRevision.ParentID == hc.ID {
+		return hc.LastRevision.NewWindowEnd
+	}
+	return hc.FileContract.WindowEnd
+}
+
+// processStorageProofs records the outcome of the storage proofs of the
+// renter's contracts in an applied block. It reports whether any contract
+// changed. processStorageProofs must be called under lock, after the block
+// height has been updated.
+func (hdb *HostDB) processStorageProofs(b types.Block) (changed bool) {
+	for _, txn := range b.Transactions {
+		for _, sp := range txn.StorageProofs {
+			hc, exists := hdb.contracts[sp.ParentID]
+			if !exists || hc.ProofStatus != "" {
+				continue
+			}
+			hc.ProofStatus = proofStatusValid
+			hdb.contracts[hc.ID] = hc
+			hdb.recordInteraction(hc.IP, interactionProof, true)
+			changed = true
+		}
+	}
+
+	// Any contract whose proof window has closed without a proof has been
+	// missed.
+	for id, hc := range hdb.contracts {
+		if hc.ProofStatus != "" || contractWindowEnd(hc) > hdb.blockHeight {
+			continue
+		}
+		hc.ProofStatus = proofStatusMissed
+		hdb.contracts[id] = hc
+		hdb.recordInteraction(hc.IP, interactionProof, false)
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,106 @@
+package hostdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestHostHistoryStats checks the downtime and failure rate derived from a
+// host's history.
+func TestHostHistoryStats(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * recentFailureWindow)
+	h := hostHistory{
+		{Type: interactionScan, Success: true, Timestamp: now},
+		{Type: interactionScan, Success: false, Timestamp: now},
+		{Type: interactionScan, Success: true, Timestamp: now},
+		{Type: interactionScan, Success: true, Timestamp: now},
+		{Type: interactionUpload, Success: false, Timestamp: old},
+		{Type: interactionUpload, Success: true, Timestamp: now},
+		{Type: interactionDownload, Success: false, Timestamp: now},
+	}
+	if d := h.downtime(); d != 0.25 {
+		t.Error("expected downtime of 0.25, got", d)
+	}
+	if f := h.failureRate(now.Add(-recentFailureWindow)); f != 0.5 {
+		t.Error("expected failure rate of 0.5, got", f)
+	}
+	if d, f := hostHistory(nil).downtime(), hostHistory(nil).failureRate(old); d != 0 || f != 0 {
+		t.Error("empty history should have no downtime or failures")
+	}
+
+	// Downtime and failures should lower the weight of a host.
+	var entry hostEntry
+	entry.Price = types.NewCurrency64(10)
+	weight := calculateHostWeight(entry, 0)
+	entry.downtime = h.downtime()
+	if calculateHostWeight(entry, 0).Cmp(weight) >= 0 {
+		t.Error("downtime did not lower the weight of the host")
+	}
+	entry.downtime = 0
+	entry.failureRate = 0.5
+	if calculateHostWeight(entry, 0).Cmp(weight) >= 0 {
+		t.Error("failures did not lower the weight of the host")
+	}
+}
+
+// TestRecordInteraction checks that the history of a host is capped.
+func TestRecordInteraction(t *testing.T) {
+	hdb := &HostDB{
+		history: make(map[modules.NetAddress]hostHistory),
+	}
+	for i := 0; i < maxHostHistory+10; i++ {
+		hdb.recordInteraction("foo:1234", interactionScan, i%2 == 0)
+	}
+	if len(hdb.history["foo:1234"]) != maxHostHistory {
+		t.Fatal("history was not capped:", len(hdb.history["foo:1234"]))
+	}
+}
+
+// TestProcessStorageProofs checks that valid and missed storage proofs are
+// recorded exactly once.
+func TestProcessStorageProofs(t *testing.T) {
+	hdb := &HostDB{
+		contracts: map[types.FileContractID]hostContract{
+			{1}: {IP: "foo:1234", ID: types.FileContractID{1}, FileContract: types.FileContract{WindowEnd: 10}},
+			{2}: {IP: "bar:1234", ID: types.FileContractID{2}, FileContract: types.FileContract{WindowEnd: 10}},
+		},
+		history: make(map[modules.NetAddress]hostHistory),
+	}
+
+	// A proof for the first contract appears before the window closes.
+	hdb.blockHeight = 5
+	b := types.Block{Transactions: []types.Transaction{{
+		StorageProofs: []types.StorageProof{{ParentID: types.FileContractID{1}}},
+	}}}
+	if !hdb.processStorageProofs(b) {
+		t.Fatal("storage proof was not processed")
+	}
+	if hdb.contracts[types.FileContractID{1}].ProofStatus != proofStatusValid {
+		t.Fatal("contract not marked as proven")
+	}
+
+	// The second contract is missed once the window closes.
+	hdb.blockHeight = 10
+	if !hdb.processStorageProofs(types.Block{}) {
+		t.Fatal("missed proof was not processed")
+	}
+	if hdb.contracts[types.FileContractID{2}].ProofStatus != proofStatusMissed {
+		t.Fatal("contract not marked as missed")
+	}
+
+	// Replaying the blocks should not record anything new.
+	if hdb.processStorageProofs(b) || hdb.processStorageProofs(types.Block{}) {
+		t.Fatal("proofs were recorded twice")
+	}
+	foo, bar := hdb.history["foo:1234"], hdb.history["bar:1234"]
+	if len(foo) != 1 || !foo[0].Success || foo[0].Type != interactionProof {
+		t.Error("wrong history for proven contract:", foo)
+	}
+	if len(bar) != 1 || bar[0].Success || bar[0].Type != interactionProof {
+		t.Error("wrong history for missed contract:", bar)
+	}
+}
@@ -25,6 +25,8 @@ var (
 	errNilCS     = errors.New("cannot create renter with nil consensus set")
 	errNilWallet = errors.New("cannot create renter with nil wallet")
 	errNilTpool  = errors.New("cannot create renter with nil transaction pool")
+
+	errUnknownHost = errors.New("host is not in the hostdb")
 )
 
 // The HostDB is a database of potential hosts. It assigns a weight to each
@@ -48,13 +50,57 @@ type HostDB struct {
 	// including hosts that are currently offline.
 	allHosts map[modules.NetAddress]*hostEntry
 
+	// hostsByKey maps the hash of the public key of each host that has
+	// proven that it holds its key to the host's current address. moves
+	// records the hosts that proved their key at a new address, so that the
+	// moves can be undone if the announcement of the new address is
+	// reverted.
+	hostsByKey map[crypto.Hash]modules.NetAddress
+	moves      []hostMove
+
 	// the scanPool is a set of hosts that need to be scanned. There are a
 	// handful of goroutines constantly waiting on the channel for hosts to
 	// scan.
 	scanPool chan *hostEntry
 
-	blockHeight   types.BlockHeight
-	contracts     map[types.FileContractID]hostContract
+	// scanPolicy determines how often and how aggressively hosts are
+	// scanned. scanThreads is the number of threadedProbeHosts goroutines
+	// currently running, which is brought in line with the policy whenever
+	// the policy changes. Changing the policy also wakes threadedScan
+	// through scanWake.
+	scanPolicy  modules.HostScanPolicy
+	scanThreads int
+	scanWake    chan struct{}
+
+	// The host filter restricts which hosts can be selected by randomHosts.
+	// Depending on the filter mode, filteredHosts is either a blacklist or a
+	// whitelist.
+	filterMode    modules.HostFilterMode
+	filteredHosts map[modules.NetAddress]struct{}
+
+	// diversity determines the subnets within which at most one host may be
+	// selected for a chunk.
+	diversity modules.HostDiversity
+
+	// marketHistory holds periodic samples of the host market, oldest first.
+	marketHistory []modules.HostMarketStats
+
+	// history records the interactions with each host, including hosts that
+	// are no longer in allHosts.
+	history map[modules.NetAddress]hostHistory
+
+	blockHeight types.BlockHeight
+	contracts   map[types.FileContractID]hostContract
+
+	// replayHeight is the height that the hostdb reaches once it has caught
+	// up with the blocks that the consensus set replays at startup.
+	replayHeight types.BlockHeight
+
+	// consensusContracts holds the state of the renter's contracts as seen
+	// by the consensus set, including the most recent confirmed revision.
+	// It is rebuilt from the blockchain at startup.
+	consensusContracts map[types.FileContractID]types.FileContract
+
 	cachedAddress types.UnlockHash // to prevent excessive address creation
 
 	persistDir string
@@ -72,6 +118,8 @@ type hostContract struct {
 	LastRevision    types.FileContractRevision
 	LastRevisionTxn types.Transaction
 	SecretKey       crypto.SecretKey
+	ProofStatus     string // empty until the proof window has closed
+	Flag            string // set when the contract could not be reconciled with the host
 }
 
 // New creates and starts up a hostdb. The hostdb that gets returned will not
@@ -91,10 +139,23 @@ func New(cs modules.ConsensusSet, wallet modules.Wallet, tpool modules.Transacti
 		wallet: wallet,
 		tpool:  tpool,
 
-		contracts:   make(map[types.FileContractID]hostContract),
-		activeHosts: make(map[modules.NetAddress]*hostNode),
-		allHosts:    make(map[modules.NetAddress]*hostEntry),
-		scanPool:    make(chan *hostEntry, scanPoolSize),
+		contracts:          make(map[types.FileContractID]hostContract),
+		consensusContracts: make(map[types.FileContractID]types.FileContract),
+		activeHosts:        make(map[modules.NetAddress]*hostNode),
+		allHosts:           make(map[modules.NetAddress]*hostEntry),
+		hostsByKey:         make(map[crypto.Hash]modules.NetAddress),
+		filteredHosts:      make(map[modules.NetAddress]struct{}),
+		history:            make(map[modules.NetAddress]hostHistory),
+		diversity: modules.HostDiversity{
+			IPv4SubnetBits: defaultIPv4SubnetBits,
+			IPv6SubnetBits: defaultIPv6SubnetBits,
+		},
+		scanPolicy: defaultScanPolicy,
+		scanPool:   make(chan *hostEntry, scanPoolSize),
+		scanWake:   make(chan struct{}, 1),
+
+		// the hostdb counts the genesis block
+		replayHeight: cs.Height() + 1,
 
 		persistDir: persistDir,
 	}
@@ -104,12 +165,16 @@ func New(cs modules.ConsensusSet, wallet modules.Wallet, tpool modules.Transacti
 	}
 
 	// Begin listening to consensus and looking for hosts.
-	for i := 0; i < scanningThreads; i++ {
-		go hdb.threadedProbeHosts()
-	}
+	hdb.mu.Lock()
+	hdb.adjustScanThreads()
+	hdb.mu.Unlock()
 	go hdb.threadedScan()
 
 	cs.ConsensusSetSubscribe(hdb)
 
+	// Now that the hostdb has caught up with the blockchain, make sure that
+	// the contracts loaded from disk agree with the hosts.
+	go hdb.threadedReconcileContracts()
+
 	return hdb, nil
 }
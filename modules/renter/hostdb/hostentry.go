@@ -1,42 +1,204 @@
 package hostdb
 
 import (
+	"net"
+
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// maxMoveDepth is the number of blocks after which a host move is no longer
+// expected to be reverted, and is forgotten.
+const maxMoveDepth = 1000
+
 // A hostEntry represents a host on the network.
 type hostEntry struct {
 	modules.HostSettings
 	weight      types.Currency
 	reliability types.Currency
+	firstSeen   types.BlockHeight // height of the host's first announcement
+	ip          net.IP            // learned when the host is scanned
+
+	// freeDownloads is set if the host predates paid downloads, and serves
+	// downloads without payment.
+	freeDownloads bool
+
+	// signed is set if a signed announcement was made for the host's
+	// address. Announcements are self-signed, so they do not prove that the
+	// host at the address holds the announced key; publicKey is only set
+	// once the host has proven that it holds the key when scanned.
+	signed    bool
+	publicKey types.SiaPublicKey
+
+	// derived from the host's history
+	downtime    float64
+	failureRate float64
+}
+
+// A hostMove records that a host, along with the contracts formed with it,
+// was moved to a new address after the host proved its key there. Height is the height of
+// the announcement of the new address; the move is undone if that
+// announcement is reverted.
+type hostMove struct {
+	From      modules.NetAddress
+	To        modules.NetAddress
+	KeyID     crypto.Hash
+	Height    types.BlockHeight
+	Contracts []types.FileContractID
+}
+
+// A provenKey records the address at which a host last proved that it holds
+// its key. Only the hash of the key is stored.
+type provenKey struct {
+	KeyID   crypto.Hash
+	Address modules.NetAddress
 }
 
 // insert adds a host entry to the state. The host will be inserted into the
 // set of all hosts, and if it is online and responding to requests it will be
-// put into the list of active hosts.
+// put into the list of active hosts. Hosts that made signed announcements are
+// asked to prove their key when they are scanned.
 //
 // TODO: Function should return an error.
-func (hdb *HostDB) insertHost(host modules.HostSettings) {
+func (hdb *HostDB) insertHost(ann hostAnnouncement) {
 	// Remove garbage hosts and local hosts.
-	if !host.IPAddress.IsValid() {
+	if !ann.IPAddress.IsValid() {
 		return
 	}
-	if host.IPAddress.IsLoopback() && build.Release != "testing" {
+	if ann.IPAddress.IsLoopback() && build.Release != "testing" {
 		return
 	}
 
 	// Add the host to allHosts.
-	entry := &hostEntry{
-		HostSettings: host,
-		reliability:  DefaultReliability,
-	}
-	_, exists := hdb.allHosts[entry.IPAddress]
+	signed := len(ann.PublicKey.Key) != 0
+	entry, exists := hdb.allHosts[ann.IPAddress]
 	if !exists {
+		reliability := DefaultReliability
+		if reliability.Cmp(hdb.scanPolicy.MaxReliability) > 0 {
+			reliability = hdb.scanPolicy.MaxReliability
+		}
+		entry = &hostEntry{
+			HostSettings: modules.HostSettings{IPAddress: ann.IPAddress},
+			reliability:  reliability,
+			firstSeen:    hdb.blockHeight,
+			signed:       signed,
+		}
 		hdb.allHosts[entry.IPAddress] = entry
 		hdb.scanHostEntry(entry)
+	} else if signed && !entry.signed {
+		entry.signed = true
+		hdb.scanHostEntry(entry)
+	}
+}
+
+// contractHostKey returns the public key that the host used when forming a
+// contract.
+func contractHostKey(hc hostContract) (types.SiaPublicKey, bool) {
+	pks := hc.LastRevision.UnlockConditions.PublicKeys
+	if len(pks) != 2 {
+		return types.SiaPublicKey{}, false
 	}
+	return pks[1], true
+}
+
+// bindHostKey records that the host at an entry's address has proven that it
+// holds pk. If the key was proven at a different address before, the host has
+// moved: its history and the contracts formed with pk at the old address are
+// moved to the new address. Contracts are never moved away from an address at
+// which the key was not proven. bindHostKey returns true if any contracts
+// were moved. bindHostKey must be called under lock.
+func (hdb *HostDB) bindHostKey(entry *hostEntry, pk types.SiaPublicKey) bool {
+	entry.publicKey = pk
+	keyID := crypto.HashObject(pk)
+	oldAddr, known := hdb.hostsByKey[keyID]
+	hdb.hostsByKey[keyID] = entry.IPAddress
+	if !known || oldAddr == entry.IPAddress {
+		return false
+	}
+	hdb.moveHost(oldAddr, entry.IPAddress, keyID)
+
+	m := hostMove{From: oldAddr, To: entry.IPAddress, KeyID: keyID, Height: entry.firstSeen}
+	for id, hc := range hdb.contracts {
+		key, ok := contractHostKey(hc)
+		if !ok || hc.IP != oldAddr || crypto.HashObject(key) != keyID {
+			continue
+		}
+		m.Contracts = append(m.Contracts, id)
+		hc.IP = entry.IPAddress
+		hdb.contracts[id] = hc
+	}
+
+	// Moves that are too deep to be reverted are forgotten.
+	var moves []hostMove
+	for _, old := range hdb.moves {
+		if old.Height+maxMoveDepth > hdb.blockHeight {
+			moves = append(moves, old)
+		}
+	}
+	hdb.moves = append(moves, m)
+	hdb.log.Printf("INFO: host moved from %v to %v with %v contracts", m.From, m.To, len(m.Contracts))
+	return true
+}
+
+// moveHost removes the entry of a host that has proven its key at a new
+// address, and carries its history over to the new address. The entry at the
+// old address is kept if a different key has been proven there since.
+// moveHost must be called under lock.
+func (hdb *HostDB) moveHost(from, to modules.NetAddress, keyID crypto.Hash) {
+	if entry, exists := hdb.allHosts[from]; exists && (len(entry.publicKey.Key) == 0 || crypto.HashObject(entry.publicKey) == keyID) {
+		hdb.removeHost(from)
+	}
+
+	// The history at the old address predates the history at the new
+	// address, if there is any.
+	if h, exists := hdb.history[from]; exists {
+		h = append(h, hdb.history[to]...)
+		if len(h) > maxHostHistory {
+			h = h[len(h)-maxHostHistory:]
+		}
+		hdb.history[to] = h
+		delete(hdb.history, from)
+	}
+}
+
+// revertHostMoves undoes the moves of hosts to addr that were caused by an
+// announcement at height that was reverted. The hosts are moved back along
+// with their contracts. revertHostMoves must be called under lock.
+func (hdb *HostDB) revertHostMoves(addr modules.NetAddress, height types.BlockHeight) {
+	for i := len(hdb.moves) - 1; i >= 0; i-- {
+		m := hdb.moves[i]
+		if m.To != addr || m.Height != height {
+			continue
+		}
+		for _, id := range m.Contracts {
+			if hc, exists := hdb.contracts[id]; exists && hc.IP == addr {
+				hc.IP = m.From
+				hdb.contracts[id] = hc
+			}
+		}
+		if hdb.hostsByKey[m.KeyID] == addr {
+			hdb.hostsByKey[m.KeyID] = m.From
+		}
+		hdb.moves = append(hdb.moves[:i], hdb.moves[i+1:]...)
+		hdb.log.Printf("INFO: announcement of %v was reverted, host moved back to %v with %v contracts", addr, m.From, len(m.Contracts))
+	}
+}
+
+// revertAnnouncement removes a host that was first announced in a block at
+// height that was reverted. revertAnnouncement must be called under lock.
+func (hdb *HostDB) revertAnnouncement(addr modules.NetAddress, height types.BlockHeight) {
+	entry, exists := hdb.allHosts[addr]
+	if !exists || entry.firstSeen != height {
+		return
+	}
+	for keyID, keyAddr := range hdb.hostsByKey {
+		if keyAddr == addr {
+			delete(hdb.hostsByKey, keyID)
+		}
+	}
+	hdb.removeHost(addr)
 }
 
 // Remove deletes an entry from the hostdb.
@@ -91,3 +253,89 @@ func (hdb *HostDB) AveragePrice() types.Currency {
 	}
 	return totalPrice.Div(types.NewCurrency64(uint64(len(hosts))))
 }
+
+// hostDBEntry returns the public description of a host entry, without the
+// host's history or contracts. hostDBEntry must be called under lock.
+func (hdb *HostDB) hostDBEntry(entry *hostEntry) modules.HostDBEntry {
+	e := *entry
+	hdb.updateHistoryStats(&e)
+	_, active := hdb.activeHosts[e.IPAddress]
+	return modules.HostDBEntry{
+		HostSettings: e.HostSettings,
+		Active:       active,
+		Score:        hostScore(e, hdb.blockHeight),
+		Reliability:  e.reliability,
+		FirstSeen:    e.firstSeen,
+		Uptime:       1 - e.downtime,
+		FailureRate:  e.failureRate,
+		PublicKey:    e.publicKey,
+	}
+}
+
+// Host returns detailed information about a known host, including its
+// interaction history and the renter's contracts with the host.
+func (hdb *HostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, error) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	entry, exists := hdb.allHosts[addr]
+	if !exists {
+		return modules.HostDBEntry{}, errUnknownHost
+	}
+	hde := hdb.hostDBEntry(entry)
+	hde.History = append(hde.History, hdb.history[addr]...)
+	for _, hc := range hdb.contracts {
+		if hc.IP != addr {
+			continue
+		}
+		fileSize := hc.FileContract.FileSize
+		if hc.LastRevision.ParentID == hc.ID {
+			fileSize = hc.LastRevision.NewFileSize
+		}
+		hde.Contracts = append(hde.Contracts, modules.HostDBContract{
+			ID:          hc.ID,
+			FileSize:    fileSize,
+			WindowStart: hc.FileContract.WindowStart,
+			WindowEnd:   contractWindowEnd(hc),
+			ProofStatus: hc.ProofStatus,
+			Flag:        hc.Flag,
+		})
+	}
+	return hde, nil
+}
+
+// Hosts returns summary information about every known host, including the
+// inactive ones.
+func (hdb *HostDB) Hosts() []modules.HostDBEntry {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	hosts := make([]modules.HostDBEntry, 0, len(hdb.allHosts))
+	for _, entry := range hdb.allHosts {
+		hosts = append(hosts, hdb.hostDBEntry(entry))
+	}
+	return hosts
+}
+
+// ContractAddress returns the current address of the host that formed a
+// contract.
+func (hdb *HostDB) ContractAddress(id types.FileContractID) (modules.NetAddress, bool) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	hc, exists := hdb.contracts[id]
+	return hc.IP, exists
+}
+
+// RescanHost schedules an immediate scan of a known host. The scan happens in
+// the background; its result is reflected in the host's history.
+func (hdb *HostDB) RescanHost(addr modules.NetAddress) error {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	entry, exists := hdb.allHosts[addr]
+	if !exists {
+		return errUnknownHost
+	}
+	hdb.scanHostEntry(entry)
+	return nil
+}
@@ -1,27 +1,166 @@
 package hostdb
 
+// hostweight.go contains the functions that score hosts. The score of a host
+// is its weight in the hostTree. The score starts from a price-based weight,
+// which is then multiplied by a number of factors that each judge a different
+// quality of the host.
+
 import (
+	"math"
 	"math/big"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+const (
+	// minScoreMultiplier is the smallest multiplier that a score factor can
+	// produce. Using a small positive minimum instead of zero keeps a single
+	// bad factor from removing a host from consideration entirely.
+	minScoreMultiplier = 0.001
+
+	// targetStorage is the amount of remaining storage at which a host is no
+	// longer penalized for lack of space.
+	targetStorage = 10e9 // 10 GB
+
+	// targetDuration is the maximum contract duration at which a host is no
+	// longer penalized for short contracts. It matches the duration of the
+	// contracts formed by the renter.
+	targetDuration = 6000
+
+	// targetAge is the number of blocks after which a host is no longer
+	// penalized for being new to the network.
+	targetAge = 4032 // about four weeks
+)
+
 var (
 	// Because most weights would otherwise be fractional, we set the base
 	// weight to 10^80 to give ourselves lots of precision when determing the
 	// weight of a host
 	baseWeight = types.NewCurrency(new(big.Int).Exp(big.NewInt(10), big.NewInt(150), nil))
+
+	// scoreFactors is the list of factors that are multiplied into the
+	// price-based weight of a host.
+	scoreFactors = []scoreFactor{
+		{"collateral", collateralMultiplier},
+		{"storage", storageMultiplier},
+		{"duration", durationMultiplier},
+		{"uptime", uptimeMultiplier},
+		{"failures", failureMultiplier},
+		{"age", ageMultiplier},
+	}
 )
 
-// calculateHostWeight returns the weight of a host according to the settings of
-// the host database entry. Currently, only the price is considered.
-func calculateHostWeight(entry hostEntry) (weight types.Currency) {
+// A scoreFactor judges a single quality of a host, producing a multiplier
+// between minScoreMultiplier and 1.
+type scoreFactor struct {
+	name       string
+	multiplier func(entry hostEntry, height types.BlockHeight) float64
+}
+
+// clampMultiplier limits a multiplier to the range [minScoreMultiplier, 1].
+func clampMultiplier(m float64) float64 {
+	return math.Max(minScoreMultiplier, math.Min(1, m))
+}
+
+// priceWeight returns the price-based weight of a host, which is the base
+// weight divided by the price to the fifth power.
+func priceWeight(price types.Currency) types.Currency {
 	// If the price is 0, just return the base weight to avoid divide by zero.
-	price := entry.Price
 	if price.IsZero() {
 		return baseWeight
 	}
-
-	// Divide the base weight by the price to the fifth power.
 	return baseWeight.Div(price).Div(price).Div(price).Div(price).Div(price)
 }
+
+// collateralMultiplier rewards hosts that put collateral at risk. The renter
+// asks each host for its advertised collateral, up to the price of storage,
+// and the host loses the collateral if it misses a storage proof. A host that
+// offers at least as much collateral as it charges is not penalized, and a
+// host offering no collateral has its score halved.
+func collateralMultiplier(entry hostEntry, _ types.BlockHeight) float64 {
+	if entry.Price.IsZero() {
+		return 1
+	}
+	ratio, _ := new(big.Rat).SetFrac(entry.Collateral.Big(), entry.Price.Big()).Float64()
+	return clampMultiplier(0.5 + ratio/2)
+}
+
+// storageMultiplier penalizes hosts that have little storage remaining.
+func storageMultiplier(entry hostEntry, _ types.BlockHeight) float64 {
+	return clampMultiplier(float64(entry.RemainingStorage) / targetStorage)
+}
+
+// durationMultiplier penalizes hosts whose maximum contract duration is
+// shorter than the duration of the renter's contracts.
+func durationMultiplier(entry hostEntry, _ types.BlockHeight) float64 {
+	ratio := float64(entry.MaxDuration) / targetDuration
+	return clampMultiplier(ratio * ratio)
+}
+
+// uptimeMultiplier penalizes hosts that have frequently been offline when
+// scanned.
+func uptimeMultiplier(entry hostEntry, _ types.BlockHeight) float64 {
+	return clampMultiplier(1 - entry.downtime)
+}
+
+// failureMultiplier penalizes hosts that have recently failed uploads,
+// downloads, or storage proofs. Failures are penalized more steeply than
+// downtime, as they directly affect the renter's data.
+func failureMultiplier(entry hostEntry, _ types.BlockHeight) float64 {
+	m := 1 - entry.failureRate
+	return clampMultiplier(m * m)
+}
+
+// ageMultiplier penalizes hosts that were announced recently, as new hosts
+// have not yet had a chance to prove themselves.
+func ageMultiplier(entry hostEntry, height types.BlockHeight) float64 {
+	if height < entry.firstSeen {
+		return 0.5
+	}
+	age := float64(height - entry.firstSeen)
+	return clampMultiplier(0.5 + math.Min(1, age/targetAge)/2)
+}
+
+// hostScore returns the weight of a host along with a breakdown of the
+// components that make up the weight.
+func hostScore(entry hostEntry, height types.BlockHeight) modules.HostScoreBreakdown {
+	weight := priceWeight(entry.Price)
+	priceMultiplier, _ := new(big.Rat).SetFrac(weight.Big(), baseWeight.Big()).Float64()
+	sb := modules.HostScoreBreakdown{
+		Components: []modules.HostScoreComponent{{
+			Name:       "price",
+			Multiplier: priceMultiplier,
+		}},
+	}
+	for _, factor := range scoreFactors {
+		m := factor.multiplier(entry, height)
+		weight = weight.MulRat(new(big.Rat).SetFloat64(m))
+		sb.Components = append(sb.Components, modules.HostScoreComponent{
+			Name:       factor.name,
+			Multiplier: m,
+		})
+	}
+	sb.Score = weight
+	return sb
+}
+
+// calculateHostWeight returns the weight of a host according to the settings of
+// the host database entry and the current block height.
+func calculateHostWeight(entry hostEntry, height types.BlockHeight) types.Currency {
+	return hostScore(entry, height).Score
+}
+
+// HostScore returns a breakdown of the score of a known host.
+func (hdb *HostDB) HostScore(addr modules.NetAddress) (modules.HostScoreBreakdown, error) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	entry, exists := hdb.allHosts[addr]
+	if !exists {
+		return modules.HostScoreBreakdown{}, errUnknownHost
+	}
+	e := *entry
+	hdb.updateHistoryStats(&e)
+	return hostScore(e, hdb.blockHeight), nil
+}
@@ -6,10 +6,16 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// calculateWeightFromUInt64Price returns the weight of a host that is
+// perfect in every respect except for its price.
 func calculateWeightFromUInt64Price(price uint64) (weight types.Currency) {
 	var entry hostEntry
 	entry.Price = types.NewCurrency64(price)
-	return calculateHostWeight(entry)
+	entry.Collateral = entry.Price
+	entry.RemainingStorage = targetStorage
+	entry.MaxDuration = targetDuration
+	entry.reliability = MaxReliability
+	return calculateHostWeight(entry, targetAge)
 }
 
 func TestHostWeightDistinctPrices(t *testing.T) {
@@ -47,3 +53,51 @@ func TestHostWeightWithBothPricesZero(t *testing.T) {
 		t.Error("Weight of two zero-priced hosts should be equal.")
 	}
 }
+
+// TestHostScoreFactors checks that each score factor lowers the weight of a
+// host that is deficient in that respect.
+func TestHostScoreFactors(t *testing.T) {
+	perfect := hostEntry{
+		reliability: MaxReliability,
+	}
+	perfect.Price = types.NewCurrency64(10)
+	perfect.Collateral = perfect.Price
+	perfect.RemainingStorage = targetStorage
+	perfect.MaxDuration = targetDuration
+	perfectWeight := calculateHostWeight(perfect, targetAge)
+
+	deficient := []hostEntry{perfect, perfect, perfect, perfect, perfect}
+	deficient[0].Collateral = types.ZeroCurrency
+	deficient[1].RemainingStorage = targetStorage / 2
+	deficient[2].MaxDuration = targetDuration / 2
+	deficient[3].downtime = 0.5
+	deficient[4].firstSeen = targetAge
+	for i, entry := range deficient {
+		if calculateHostWeight(entry, targetAge).Cmp(perfectWeight) >= 0 {
+			t.Errorf("deficient host %v was not penalized", i)
+		}
+	}
+
+	// A host with no storage should be heavily penalized, but still have a
+	// nonzero weight.
+	empty := perfect
+	empty.RemainingStorage = 0
+	weight := calculateHostWeight(empty, targetAge)
+	if weight.IsZero() || weight.Cmp(perfectWeight.Div(types.NewCurrency64(100))) > 0 {
+		t.Error("empty host has wrong weight:", weight)
+	}
+
+	// The breakdown should contain one component per factor, plus price.
+	sb := hostScore(perfect, targetAge)
+	if len(sb.Components) != len(scoreFactors)+1 {
+		t.Fatal("wrong number of score components:", len(sb.Components))
+	}
+	if sb.Score.Cmp(perfectWeight) != 0 {
+		t.Error("breakdown score does not match host weight")
+	}
+	for _, c := range sb.Components[1:] {
+		if c.Multiplier != 1 {
+			t.Errorf("perfect host has %v multiplier of %v", c.Name, c.Multiplier)
+		}
+	}
+}
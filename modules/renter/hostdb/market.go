@@ -0,0 +1,135 @@
+package hostdb
+
+// market.go contains the functions that summarize the settings of the active
+// hosts, giving renters an overview of the prices and capacity available on
+// the network and how they change over time.
+
+import (
+	"sort"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// maxMarketSamples is the number of market samples that are kept. Older
+	// samples are discarded.
+	maxMarketSamples = 1000
+
+	// unknownHostVersion is the version reported for hosts that do not
+	// advertise their version.
+	unknownHostVersion = "unknown"
+)
+
+var (
+	// marketSampleInterval is the number of blocks between samples of the
+	// host market.
+	marketSampleInterval types.BlockHeight
+)
+
+func init() {
+	if build.Release == "testing" {
+		marketSampleInterval = 5
+	} else {
+		marketSampleInterval = 144 // about one day
+	}
+}
+
+// currencies sorts a slice of currencies in ascending order.
+type currencies []types.Currency
+
+func (cs currencies) Len() int           { return len(cs) }
+func (cs currencies) Less(i, j int) bool { return cs[i].Cmp(cs[j]) < 0 }
+func (cs currencies) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
+
+// percentiles returns the percentiles of a set of values using the
+// nearest-rank method. The values are sorted in place.
+func percentiles(values []types.Currency) modules.HostMarketPercentiles {
+	if len(values) == 0 {
+		return modules.HostMarketPercentiles{}
+	}
+	sort.Sort(currencies(values))
+	rank := func(p int) types.Currency {
+		return values[(p*len(values)+99)/100-1]
+	}
+	return modules.HostMarketPercentiles{
+		P10: rank(10),
+		P25: rank(25),
+		P50: rank(50),
+		P75: rank(75),
+		P90: rank(90),
+	}
+}
+
+// marketStats summarizes the settings of the active hosts. marketStats must
+// be called under lock.
+func (hdb *HostDB) marketStats() modules.HostMarketStats {
+	stats := modules.HostMarketStats{
+		Height:   hdb.blockHeight,
+		Hosts:    len(hdb.activeHosts),
+		Versions: make(map[string]int),
+	}
+	var prices, collaterals []types.Currency
+	for _, node := range hdb.activeHosts {
+		settings := node.hostEntry.HostSettings
+		prices = append(prices, settings.Price)
+		collaterals = append(collaterals, settings.Collateral)
+		if settings.TotalStorage > 0 {
+			stats.TotalStorage += settings.TotalStorage
+		}
+		version := settings.Version
+		if version == "" {
+			version = unknownHostVersion
+		}
+		stats.Versions[version]++
+	}
+	stats.Price = percentiles(prices)
+	stats.Collateral = percentiles(collaterals)
+	return stats
+}
+
+// sampleMarket adds a sample of the current market to the market history.
+// sampleMarket must be called under lock.
+func (hdb *HostDB) sampleMarket() {
+	hdb.marketHistory = append(hdb.marketHistory, hdb.marketStats())
+	if len(hdb.marketHistory) > maxMarketSamples {
+		hdb.marketHistory = append([]modules.HostMarketStats(nil), hdb.marketHistory[len(hdb.marketHistory)-maxMarketSamples:]...)
+	}
+}
+
+// lastMarketSample returns the height of the most recent market sample.
+// lastMarketSample must be called under lock.
+func (hdb *HostDB) lastMarketSample() types.BlockHeight {
+	if len(hdb.marketHistory) == 0 {
+		return 0
+	}
+	return hdb.marketHistory[len(hdb.marketHistory)-1].Height
+}
+
+// revertMarketSamples removes the market samples taken at heights that are no
+// longer part of the blockchain, reporting whether any were removed.
+// revertMarketSamples must be called under lock, after the block height has
+// been updated.
+func (hdb *HostDB) revertMarketSamples() bool {
+	n := len(hdb.marketHistory)
+	for n > 0 && hdb.marketHistory[n-1].Height > hdb.blockHeight {
+		n--
+	}
+	if n == len(hdb.marketHistory) {
+		return false
+	}
+	hdb.marketHistory = hdb.marketHistory[:n]
+	return true
+}
+
+// HostMarket returns statistics about the settings of the active hosts, both
+// current and historical.
+func (hdb *HostDB) HostMarket() modules.HostMarket {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return modules.HostMarket{
+		Current: hdb.marketStats(),
+		History: append([]modules.HostMarketStats(nil), hdb.marketHistory...),
+	}
+}
@@ -0,0 +1,183 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestPercentiles probes the nearest-rank percentile calculation.
+func TestPercentiles(t *testing.T) {
+	if p := percentiles(nil); !p.P50.IsZero() {
+		t.Fatal("percentiles of no values should be zero:", p)
+	}
+
+	// Values 10, 20, ..., 100, inserted out of order.
+	var values []types.Currency
+	for _, v := range []uint64{50, 100, 10, 80, 30, 60, 20, 90, 40, 70} {
+		values = append(values, types.NewCurrency64(v))
+	}
+	p := percentiles(values)
+	expected := []struct {
+		got types.Currency
+		exp uint64
+	}{
+		{p.P10, 10},
+		{p.P25, 30},
+		{p.P50, 50},
+		{p.P75, 80},
+		{p.P90, 90},
+	}
+	for i, e := range expected {
+		if e.got.Cmp(types.NewCurrency64(e.exp)) != 0 {
+			t.Errorf("percentile %v: expected %v, got %v", i, e.exp, e.got)
+		}
+	}
+}
+
+// TestHostMarket checks the market statistics and the handling of market
+// samples during reorgs.
+func TestHostMarket(t *testing.T) {
+	hdb := &HostDB{
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+	}
+	for i := 0; i < 4; i++ {
+		entry := hostEntry{
+			HostSettings: modules.HostSettings{
+				IPAddress:    fakeAddr(uint8(i)),
+				TotalStorage: 1e9,
+				Price:        types.NewCurrency64(uint64(i + 1)),
+				Collateral:   types.NewCurrency64(uint64(2 * (i + 1))),
+			},
+			weight: types.NewCurrency64(10),
+		}
+		if i < 3 {
+			entry.Version = "0.4.8"
+		}
+		hdb.insertNode(&entry)
+	}
+
+	stats := hdb.HostMarket().Current
+	if stats.Hosts != 4 || stats.TotalStorage != 4e9 {
+		t.Fatal("wrong host count or total storage:", stats)
+	}
+	if stats.Price.P50.Cmp(types.NewCurrency64(2)) != 0 || stats.Collateral.P50.Cmp(types.NewCurrency64(4)) != 0 {
+		t.Fatal("wrong median price or collateral:", stats.Price.P50, stats.Collateral.P50)
+	}
+	if stats.Versions["0.4.8"] != 3 || stats.Versions[unknownHostVersion] != 1 {
+		t.Fatal("wrong version counts:", stats.Versions)
+	}
+
+	// Take samples at heights 5, 10, and 15, then revert to height 11.
+	for _, height := range []types.BlockHeight{5, 10, 15} {
+		hdb.blockHeight = height
+		hdb.sampleMarket()
+	}
+	hdb.blockHeight = 11
+	if !hdb.revertMarketSamples() {
+		t.Fatal("reverting past a sample should remove it")
+	}
+	history := hdb.HostMarket().History
+	if len(history) != 2 || history[1].Height != 10 {
+		t.Fatal("wrong market history after revert:", history)
+	}
+	if hdb.revertMarketSamples() {
+		t.Fatal("no samples should be removed")
+	}
+}
+
+// TestDecodeLegacyHostSettings checks that settings from hosts that do not
+// report their version, download price, or remaining storage can still be
+// decoded.
+func TestDecodeLegacyHostSettings(t *testing.T) {
+	legacy := legacyHostSettings{
+		IPAddress: "foo.com:1234",
+		Price:     types.NewCurrency64(7),
+	}
+	var settings modules.HostSettings
+	oldFormat, err := decodeHostSettings(encoding.Marshal(legacy), &settings)
+	if err != nil || !oldFormat {
+		t.Fatal("legacy settings were not decoded in the legacy format:", err)
+	}
+	if settings.IPAddress != legacy.IPAddress || settings.Price.Cmp(legacy.Price) != 0 || settings.Version != "" {
+		t.Fatal("legacy settings decoded incorrectly:", settings)
+	}
+
+	current := modules.HostSettings{IPAddress: "bar.com:1234", Version: "0.4.8", RemainingStorage: 2e9}
+	oldFormat, err = decodeHostSettings(encoding.Marshal(current), &settings)
+	if err != nil || oldFormat {
+		t.Fatal("current settings were not decoded in the current format:", err)
+	}
+	if settings.Version != "0.4.8" {
+		t.Fatal("version was not decoded:", settings.Version)
+	}
+	if settings.RemainingStorage != current.RemainingStorage {
+		t.Fatal("remaining storage was not decoded:", settings.RemainingStorage)
+	}
+
+	legacy.TotalStorage = 5e9
+	unsized := unsizedHostSettings{
+		Unpriced:      unpricedHostSettings{Legacy: legacy, Version: "0.5.1"},
+		DownloadPrice: types.NewCurrency64(3),
+	}
+	oldFormat, err = decodeHostSettings(encoding.Marshal(unsized), &settings)
+	if err != nil || oldFormat {
+		t.Fatal("unsized settings were not decoded as priced settings:", err)
+	}
+	if settings.Version != "0.5.1" || settings.DownloadPrice.Cmp(unsized.DownloadPrice) != 0 || settings.RemainingStorage != legacy.TotalStorage {
+		t.Fatal("unsized settings decoded incorrectly:", settings)
+	}
+
+	unpriced := unpricedHostSettings{Legacy: legacy, Version: "0.5"}
+	oldFormat, err = decodeHostSettings(encoding.Marshal(unpriced), &settings)
+	if err != nil || !oldFormat {
+		t.Fatal("unpriced settings were not decoded in the unpriced format:", err)
+	}
+	if settings.Version != "0.5" || settings.Price.Cmp(legacy.Price) != 0 || !settings.DownloadPrice.IsZero() {
+		t.Fatal("unpriced settings decoded incorrectly:", settings)
+	}
+}
+
+// TestHostMarketPersist checks that the market history survives a restart of
+// the hostdb, and that the blocks replayed at startup are not sampled.
+func TestHostMarketPersist(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdbt, err := newHostDBTester("TestHostMarketPersist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hdbt.Close()
+
+	// Mine enough blocks for a sample to be taken.
+	samples := len(hdbt.hostdb.HostMarket().History)
+	for i := types.BlockHeight(0); i < marketSampleInterval; i++ {
+		if _, err := hdbt.miner.AddBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := hdbt.hostdb.HostMarket().History
+	if len(history) != samples+1 {
+		t.Fatal("expected a new market sample, got", len(history)-samples)
+	}
+	hdbt.hostdb.mu.Lock()
+	err = hdbt.hostdb.save()
+	hdbt.hostdb.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdb, err := New(hdbt.cs, hdbt.wallet, hdbt.tpool, hdbt.hostdb.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := hdb.HostMarket().History
+	if len(reloaded) != len(history) || reloaded[len(reloaded)-1].Height != history[len(history)-1].Height {
+		t.Fatal("market history was not preserved across the replay:", reloaded)
+	}
+}
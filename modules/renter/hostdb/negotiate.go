@@ -15,6 +15,9 @@ var (
 	// the hostdb will not form contracts above this price
 	maxPrice = types.SiacoinPrecision.Div(types.NewCurrency64(4320e9)).Mul(types.NewCurrency64(500)) // 500 SC / GB / Month
 
+	// the hostdb will not download from hosts above this price
+	maxDownloadPrice = types.SiacoinPrecision.Div(types.NewCurrency64(1e9)).Mul(types.NewCurrency64(100)) // 100 SC / GB
+
 	errTooExpensive = errors.New("host price was too high")
 )
 
@@ -63,8 +66,9 @@ func negotiateContract(addr modules.NetAddress, fc types.FileContract, txnBuilde
 	// add UnlockHash to file contract
 	fc.UnlockHash = uc.UnlockHash()
 
-	// build transaction containing fc
-	err = txnBuilder.FundSiacoins(fc.Payout)
+	// build transaction containing fc. The host funds its own collateral.
+	collateral := fc.ValidProofOutputs[1].Value
+	err = txnBuilder.FundSiacoins(fc.Payout.Sub(collateral))
 	if err != nil {
 		return hostContract{}, err
 	}
@@ -72,9 +76,6 @@ func negotiateContract(addr modules.NetAddress, fc types.FileContract, txnBuilde
 	txn, parents := txnBuilder.View()
 	txnSet := append(parents, txn)
 
-	// calculate contract ID
-	fcid := txn.FileContractID(0) // TODO: is it actually 0?
-
 	// send txn
 	if err := encoding.WriteObject(conn, txnSet); err != nil {
 		txnBuilder.Drop()
@@ -99,28 +100,51 @@ func negotiateContract(addr modules.NetAddress, fc types.FileContract, txnBuilde
 		return hostContract{}, errors.New("couldn't read the host's updated contract: " + err.Error())
 	}
 
-	// check that txn is okay. For now, no collateral will be added, so the
-	// transaction sets should be identical.
-	if len(hostTxnSet) != len(txnSet) {
+	// check that txn is okay. The host may only add the inputs and outputs
+	// that fund its collateral, along with their parents.
+	if len(hostTxnSet) < len(txnSet) {
 		txnBuilder.Drop()
 		return hostContract{}, errors.New("host sent bad collateral transaction")
 	}
-	for i := range hostTxnSet {
-		if hostTxnSet[i].ID() != txnSet[i].ID() {
+	for i := range parents {
+		if hostTxnSet[i].ID() != parents[i].ID() {
 			txnBuilder.Drop()
 			return hostContract{}, errors.New("host sent bad collateral transaction")
 		}
 	}
+	hostTxn := hostTxnSet[len(hostTxnSet)-1]
+	hostParents := hostTxnSet[len(parents) : len(hostTxnSet)-1]
+	if len(hostTxn.SiacoinInputs) < len(txn.SiacoinInputs) || len(hostTxn.SiacoinOutputs) < len(txn.SiacoinOutputs) {
+		txnBuilder.Drop()
+		return hostContract{}, errors.New("host sent bad collateral transaction")
+	}
+	newInputs := hostTxn.SiacoinInputs[len(txn.SiacoinInputs):]
+	newOutputs := hostTxn.SiacoinOutputs[len(txn.SiacoinOutputs):]
+	expectedTxn := txn
+	expectedTxn.SiacoinInputs = append(append([]types.SiacoinInput(nil), txn.SiacoinInputs...), newInputs...)
+	expectedTxn.SiacoinOutputs = append(append([]types.SiacoinOutput(nil), txn.SiacoinOutputs...), newOutputs...)
+	if hostTxn.ID() != expectedTxn.ID() {
+		txnBuilder.Drop()
+		return hostContract{}, errors.New("host sent bad collateral transaction")
+	}
+	for _, input := range newInputs {
+		txnBuilder.AddSiacoinInput(input)
+	}
+	for _, output := range newOutputs {
+		txnBuilder.AddSiacoinOutput(output)
+	}
 
-	// sign the txn and resend
-	// NOTE: for now, we are assuming that the transaction has not changed
-	// since we sent it. Otherwise, the txnBuilder would have to be updated
-	// with whatever fields were added by the host.
+	// sign the txn and resend, with the host's parents placed before the
+	// contract transaction
 	signedTxnSet, err := txnBuilder.Sign(true)
 	if err != nil {
 		txnBuilder.Drop()
 		return hostContract{}, err
 	}
+	signedTxn := signedTxnSet[len(signedTxnSet)-1]
+	// calculate contract ID, which depends on the inputs added by the host
+	fcid := signedTxn.FileContractID(0) // TODO: is it actually 0?
+	signedTxnSet = append(append(signedTxnSet[:len(signedTxnSet)-1:len(signedTxnSet)-1], hostParents...), signedTxn)
 	if err := encoding.WriteObject(conn, signedTxnSet); err != nil {
 		txnBuilder.Drop()
 		return hostContract{}, errors.New("couldn't send the contract signed by us: " + err.Error())
@@ -132,6 +156,10 @@ func negotiateContract(addr modules.NetAddress, fc types.FileContract, txnBuilde
 		txnBuilder.Drop()
 		return hostContract{}, errors.New("couldn't read the contract signed by the host: " + err.Error())
 	}
+	if len(signedHostTxnSet) == 0 || signedHostTxnSet[len(signedHostTxnSet)-1].ID() != signedTxn.ID() {
+		txnBuilder.Drop()
+		return hostContract{}, errors.New("host sent bad signed contract")
+	}
 
 	// submit to blockchain
 	err = tpool.AcceptTransactionSet(signedHostTxnSet)
@@ -172,7 +200,7 @@ func negotiateContract(addr modules.NetAddress, fc types.FileContract, txnBuilde
 // and returns a hostContract. The contract is also saved by the HostDB.
 func (hdb *HostDB) newContract(host modules.HostSettings, filesize uint64, duration types.BlockHeight) (hostContract, error) {
 	// reject hosts that are too expensive
-	if host.Price.Cmp(maxPrice) > 0 {
+	if host.Price.Cmp(maxPrice) > 0 || host.DownloadPrice.Cmp(maxDownloadPrice) > 0 {
 		return hostContract{}, errTooExpensive
 	}
 
@@ -192,7 +220,16 @@ func (hdb *HostDB) newContract(host modules.HostSettings, filesize uint64, durat
 	// create file contract
 	renterCost := host.Price.Mul(types.NewCurrency64(filesize)).Mul(types.NewCurrency64(uint64(duration)))
 	renterCost = renterCost.MulFloat(1.05) // extra buffer to guarantee we won't run out of money during revision
-	payout := renterCost                   // no collateral
+	// include enough to download the file once
+	renterCost = renterCost.Add(host.DownloadPrice.Mul(types.NewCurrency64(filesize)))
+	// ask for the host's collateral, but no more than the cost of storage;
+	// the renter pays tax on the collateral too
+	collateralRate := host.Collateral
+	if collateralRate.Cmp(host.Price) > 0 {
+		collateralRate = host.Price
+	}
+	collateral := collateralRate.Mul(types.NewCurrency64(filesize)).Mul(types.NewCurrency64(uint64(duration)))
+	payout := renterCost.Add(collateral)
 
 	hdb.mu.RLock()
 	height := hdb.blockHeight
@@ -210,13 +247,14 @@ func (hdb *HostDB) newContract(host modules.HostSettings, filesize uint64, durat
 	// outputs need account for tax
 	fc.ValidProofOutputs = []types.SiacoinOutput{
 		{Value: renterCost.Sub(types.Tax(height, fc.Payout)), UnlockHash: ourAddress},
-		{Value: types.ZeroCurrency, UnlockHash: host.UnlockHash}, // no collateral
+		// collateral is returned to the host
+		{Value: collateral, UnlockHash: host.UnlockHash},
 	}
 	fc.MissedProofOutputs = []types.SiacoinOutput{
 		// same as above
 		fc.ValidProofOutputs[0],
-		// goes to the void, not the renter
-		{Value: types.ZeroCurrency, UnlockHash: types.UnlockHash{}},
+		// collateral goes to the void, not the renter
+		{Value: collateral, UnlockHash: types.UnlockHash{}},
 	}
 
 	// create transaction builder
@@ -243,18 +281,8 @@ func negotiateRevision(conn net.Conn, rev types.FileContractRevision, piece []by
 	conn.SetDeadline(time.Now().Add(5 * time.Minute)) // sufficient to transfer 4 MB over 100 kbps
 	defer conn.SetDeadline(time.Time{})               // reset timeout after each revision
 
-	// create transaction containing the revision
-	signedTxn := types.Transaction{
-		FileContractRevisions: []types.FileContractRevision{rev},
-		TransactionSignatures: []types.TransactionSignature{{
-			ParentID:       crypto.Hash(rev.ParentID),
-			CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
-			PublicKeyIndex: 0, // renter key is always first -- see negotiateContract
-		}},
-	}
-	// sign the transaction
-	encodedSig, _ := crypto.SignHash(signedTxn.SigHash(0), secretKey) // no error possible
-	signedTxn.TransactionSignatures[0].Signature = encodedSig[:]
+	// create and sign transaction containing the revision
+	signedTxn := signRevision(rev, secretKey)
 
 	// send the transaction
 	if err := encoding.WriteObject(conn, signedTxn); err != nil {
@@ -288,6 +316,22 @@ func negotiateRevision(conn net.Conn, rev types.FileContractRevision, piece []by
 	return signedHostTxn, nil
 }
 
+// signRevision returns a transaction containing rev, signed with the
+// renter's key.
+func signRevision(rev types.FileContractRevision, secretKey crypto.SecretKey) types.Transaction {
+	txn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{rev},
+		TransactionSignatures: []types.TransactionSignature{{
+			ParentID:       crypto.Hash(rev.ParentID),
+			CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+			PublicKeyIndex: 0, // renter key is always first -- see negotiateContract
+		}},
+	}
+	encodedSig, _ := crypto.SignHash(txn.SigHash(0), secretKey) // no error possible
+	txn.TransactionSignatures[0].Signature = encodedSig[:]
+	return txn
+}
+
 // newRevision revises the current revision to incorporate new data.
 func newRevision(rev types.FileContractRevision, pieceLen uint64, merkleRoot crypto.Hash, piecePrice types.Currency) types.FileContractRevision {
 	// prevent a negative currency panic
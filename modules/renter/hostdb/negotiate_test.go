@@ -9,6 +9,7 @@ import (
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
 	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/modules/host"
 	"github.com/NebulousLabs/Sia/modules/miner"
 	"github.com/NebulousLabs/Sia/modules/transactionpool"
 	"github.com/NebulousLabs/Sia/modules/wallet"
@@ -98,6 +99,28 @@ func newHostDBTester(name string) (*hostdbTester, error) {
 	return ht, nil
 }
 
+// addTestHost creates a host that uses the tester's modules, and adds it to
+// the hostdb.
+func (ht *hostdbTester) addTestHost(name string) (*host.Host, modules.HostSettings, error) {
+	h, err := host.New(ht.cs, ht.tpool, ht.wallet, ":0", filepath.Join(build.SiaTestingDir, "hostdb", name, modules.HostDir))
+	if err != nil {
+		return nil, modules.HostSettings{}, err
+	}
+	addr := modules.NetAddress("127.0.0.1:" + h.NetAddress().Port())
+	if err := h.AnnounceAddress(addr); err != nil {
+		return nil, modules.HostSettings{}, err
+	}
+	if _, err := ht.miner.AddBlock(); err != nil {
+		return nil, modules.HostSettings{}, err
+	}
+	settings := h.Settings()
+	settings.IPAddress = addr
+	ht.hostdb.mu.Lock()
+	ht.hostdb.allHosts[settings.IPAddress] = &hostEntry{HostSettings: settings}
+	ht.hostdb.mu.Unlock()
+	return h, settings, nil
+}
+
 func TestNegotiateContract(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
@@ -147,6 +170,67 @@ func TestNegotiateContract(t *testing.T) {
 
 }
 
+// TestNegotiateCollateral checks that hosts fund the collateral of new
+// contracts and stay within their collateral budget.
+func TestNegotiateCollateral(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostDBTester("TestNegotiateCollateral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, settings, err := ht.addTestHost("TestNegotiateCollateral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// offer as much collateral as the price of storage
+	hostSettings := h.Settings()
+	hostSettings.Collateral = hostSettings.Price
+	h.SetSettings(hostSettings)
+	settings.Collateral = hostSettings.Collateral
+
+	// the host should lock collateral proportional to the contract
+	const filesize, duration = 1000, 20
+	contract, err := ht.hostdb.newContract(settings, filesize, duration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collateral := settings.Collateral.Mul(types.NewCurrency64(filesize * duration))
+	fc := contract.FileContract
+	if fc.ValidProofOutputs[1].Value.Cmp(collateral) != 0 || fc.MissedProofOutputs[1].Value.Cmp(collateral) != 0 {
+		t.Fatal("contract does not contain the host's collateral")
+	}
+	if fc.MissedProofOutputs[1].UnlockHash != (types.UnlockHash{}) {
+		t.Fatal("collateral is not lost when the storage proof is missed")
+	}
+	locked, _ := h.LockedCollateral()
+	if locked.Cmp(collateral) != 0 {
+		t.Fatalf("expected %v collateral to be locked, got %v", collateral, locked)
+	}
+
+	// uploads must pay for storage on top of the collateral
+	hu, err := ht.hostdb.newHostUploader(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hu.Upload(make([]byte, 500)); err != nil {
+		t.Fatal(err)
+	}
+	hu.Close()
+
+	// the host should reject contracts that exceed its budget
+	h.SetCollateralBudget(collateral.Add(collateral.Div(types.NewCurrency64(2))))
+	if _, err := ht.hostdb.newContract(settings, filesize, duration); err == nil {
+		t.Fatal("expected host to reject a contract beyond its collateral budget")
+	}
+	if locked, _ := h.LockedCollateral(); locked.Cmp(collateral) != 0 {
+		t.Fatal("rejected contract changed the locked collateral")
+	}
+}
+
 func TestReviseContract(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
@@ -269,7 +353,10 @@ func TestUniqueHosts(t *testing.T) {
 	h2.contract.IP = fakeAddr(2)
 	h3.contract.IP = fakeAddr(3)
 
-	p := &pool{hosts: []*hostUploader{h1, h2, h3}}
+	p := &pool{
+		hosts: []*hostUploader{h1, h2, h3},
+		hdb:   &HostDB{allHosts: make(map[modules.NetAddress]*hostEntry)},
+	}
 
 	tests := []struct {
 		n      int
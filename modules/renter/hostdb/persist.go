@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
 )
 
@@ -18,18 +19,46 @@ var saveMetadata = persist.Metadata{
 // save saves the hostdb persistence data to disk.
 func (hdb *HostDB) save() error {
 	var data struct {
-		Contracts []hostContract
+		Contracts     []hostContract
+		FilterMode    modules.HostFilterMode
+		FilteredHosts []modules.NetAddress
+		History       map[modules.NetAddress]hostHistory
+		Diversity     *modules.HostDiversity
+		ScanPolicy    *modules.HostScanPolicy
+		MarketHistory []modules.HostMarketStats
+		Moves         []hostMove
+		ProvenKeys    []provenKey
 	}
+	data.History = hdb.history
+	data.MarketHistory = hdb.marketHistory
+	data.Moves = hdb.moves
+	for keyID, addr := range hdb.hostsByKey {
+		data.ProvenKeys = append(data.ProvenKeys, provenKey{KeyID: keyID, Address: addr})
+	}
+	data.Diversity = &hdb.diversity
+	data.ScanPolicy = &hdb.scanPolicy
 	for _, hc := range hdb.contracts {
 		data.Contracts = append(data.Contracts, hc)
 	}
+	data.FilterMode = hdb.filterMode
+	for addr := range hdb.filteredHosts {
+		data.FilteredHosts = append(data.FilteredHosts, addr)
+	}
 	return persist.SaveFile(saveMetadata, data, filepath.Join(hdb.persistDir, persistFilename))
 }
 
 // load loads the hostdb persistence data from disk.
 func (hdb *HostDB) load() error {
 	var data struct {
-		Contracts []hostContract
+		Contracts     []hostContract
+		FilterMode    modules.HostFilterMode
+		FilteredHosts []modules.NetAddress
+		History       map[modules.NetAddress]hostHistory
+		Diversity     *modules.HostDiversity
+		ScanPolicy    *modules.HostScanPolicy
+		MarketHistory []modules.HostMarketStats
+		Moves         []hostMove
+		ProvenKeys    []provenKey
 	}
 	err := persist.LoadFile(saveMetadata, &data, filepath.Join(hdb.persistDir, persistFilename))
 	if err != nil {
@@ -38,6 +67,35 @@ func (hdb *HostDB) load() error {
 	for _, hc := range data.Contracts {
 		hdb.contracts[hc.ID] = hc
 	}
+	hdb.filterMode = data.FilterMode
+	for _, addr := range data.FilteredHosts {
+		hdb.filteredHosts[addr] = struct{}{}
+	}
+	for addr, h := range data.History {
+		hdb.history[addr] = h
+	}
+	if data.Diversity != nil {
+		hdb.diversity = *data.Diversity
+	}
+	hdb.marketHistory = data.MarketHistory
+	hdb.moves = data.Moves
+	for _, pk := range data.ProvenKeys {
+		hdb.hostsByKey[pk.KeyID] = pk.Address
+	}
+	if data.ScanPolicy != nil {
+		sp := *data.ScanPolicy
+		// Policies saved before the reliability settings were added use the
+		// default reliability settings.
+		if sp.MaxReliability.IsZero() && sp.UnreachablePenalty.IsZero() {
+			sp.MaxReliability = defaultScanPolicy.MaxReliability
+			sp.UnreachablePenalty = defaultScanPolicy.UnreachablePenalty
+		}
+		if err := validateScanPolicy(sp); err != nil {
+			hdb.log.Printf("WARN: saved scan policy is invalid, using the default policy: %v", err)
+		} else {
+			hdb.scanPolicy = sp
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,162 @@
+package hostdb
+
+// reconcile.go contains the functions that reconcile the renter's contracts
+// with the hosts at startup. If the renter crashed in the middle of a
+// revision, the host may hold a newer signed revision than the one the
+// renter saved to disk. Likewise, a host that lost its own record of a
+// revision is a host that is unlikely to submit a valid storage proof.
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// The reasons for which a contract can be flagged during reconciliation.
+const (
+	flagInvalidRevision = "host sent an invalid revision"
+	flagHostBehind      = "host is missing recent revisions"
+	flagBehindConsensus = "revision is older than the revision in the blockchain"
+)
+
+var (
+	errRevisionMismatch = errors.New("revision does not match the contract")
+)
+
+// fetchLastRevision requests the most recent signed revision transaction of a
+// contract from the host, signing the host's challenge with the renter's
+// secret key for the contract.
+func fetchLastRevision(addr modules.NetAddress, id types.FileContractID, sk crypto.SecretKey, timeout time.Duration) (types.Transaction, error) {
+	conn, err := net.DialTimeout("tcp", string(addr), timeout)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := encoding.WriteObject(conn, modules.RPCLastRevision); err != nil {
+		return types.Transaction{}, err
+	}
+	if err := encoding.WriteObject(conn, id); err != nil {
+		return types.Transaction{}, err
+	}
+	var challenge crypto.Hash
+	if err := encoding.ReadObject(conn, &challenge, crypto.HashSize); err != nil {
+		return types.Transaction{}, err
+	}
+	sig, err := modules.SignChallenge(modules.RPCLastRevision, challenge, sk)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	if err := encoding.WriteObject(conn, sig); err != nil {
+		return types.Transaction{}, err
+	}
+	var response string
+	if err := encoding.ReadObject(conn, &response, 128); err != nil {
+		return types.Transaction{}, err
+	}
+	if response != modules.AcceptResponse {
+		return types.Transaction{}, errors.New(response)
+	}
+	var revTxn types.Transaction
+	err = encoding.ReadObject(conn, &revTxn, types.BlockSizeLimit)
+	return revTxn, err
+}
+
+// checkRevisionTxn checks that a revision transaction sent by a host revises
+// the given contract without changing any of the fields that are fixed for
+// the life of the contract, and that it is signed by both parties.
+func checkRevisionTxn(hc hostContract, revTxn types.Transaction, height types.BlockHeight) error {
+	if len(revTxn.FileContractRevisions) != 1 {
+		return errRevisionMismatch
+	}
+	rev := revTxn.FileContractRevisions[0]
+	fc := hc.FileContract
+	switch {
+	case rev.ParentID != hc.ID,
+		rev.UnlockConditions.UnlockHash() != fc.UnlockHash,
+		rev.NewUnlockHash != fc.UnlockHash,
+		rev.NewWindowStart != fc.WindowStart,
+		rev.NewWindowEnd != fc.WindowEnd:
+		return errRevisionMismatch
+	}
+	return revTxn.StandaloneValid(height)
+}
+
+// reconcileContract compares the revision of a contract held by the host with
+// the renter's revision and the revision in the blockchain. A newer valid
+// revision from the host is adopted; otherwise, any disagreement is recorded
+// by flagging the contract. reconcileContract must be called under lock.
+func (hdb *HostDB) reconcileContract(hc hostContract, revTxn types.Transaction) hostContract {
+	hc.Flag = ""
+	if err := checkRevisionTxn(hc, revTxn, hdb.blockHeight); err != nil {
+		hdb.log.Printf("WARN: host %v sent an invalid revision of contract %v: %v", hc.IP, hc.ID, err)
+		hc.Flag = flagInvalidRevision
+		return hc
+	}
+
+	hostRev := revTxn.FileContractRevisions[0]
+	switch {
+	case hostRev.NewRevisionNumber > hc.LastRevision.NewRevisionNumber:
+		hdb.log.Printf("INFO: adopted revision %v of contract %v from host %v, replacing revision %v",
+			hostRev.NewRevisionNumber, hc.ID, hc.IP, hc.LastRevision.NewRevisionNumber)
+		hc.LastRevision = hostRev
+		hc.LastRevisionTxn = revTxn
+		err := hdb.tpool.AcceptTransactionSet([]types.Transaction{revTxn})
+		if err != nil && err != modules.ErrDuplicateTransactionSet {
+			hdb.log.Println("WARN: transaction pool rejected adopted revision:", err)
+		}
+	case hostRev.NewRevisionNumber < hc.LastRevision.NewRevisionNumber:
+		hdb.log.Printf("WARN: host %v has revision %v of contract %v, but the renter has revision %v",
+			hc.IP, hostRev.NewRevisionNumber, hc.ID, hc.LastRevision.NewRevisionNumber)
+		hc.Flag = flagHostBehind
+	}
+
+	// Neither party should be behind the blockchain.
+	if onChain, exists := hdb.consensusContracts[hc.ID]; exists && onChain.RevisionNumber > hc.LastRevision.NewRevisionNumber {
+		hdb.log.Printf("WARN: contract %v has revision %v in the blockchain, but only revision %v is known",
+			hc.ID, onChain.RevisionNumber, hc.LastRevision.NewRevisionNumber)
+		hc.Flag = flagBehindConsensus
+	}
+	return hc
+}
+
+// threadedReconcileContracts reconciles every contract that can still be
+// revised with its host. Hosts that cannot be reached are skipped; their
+// contracts are left untouched.
+func (hdb *HostDB) threadedReconcileContracts() {
+	hdb.mu.RLock()
+	timeout := hdb.scanPolicy.RequestTimeout
+	var contracts []hostContract
+	for _, hc := range hdb.contracts {
+		if hc.ProofStatus == "" && hdb.blockHeight < hc.FileContract.WindowStart {
+			contracts = append(contracts, hc)
+		}
+	}
+	hdb.mu.RUnlock()
+
+	for _, hc := range contracts {
+		revTxn, err := fetchLastRevision(hc.IP, hc.ID, hc.SecretKey, timeout)
+		if err != nil {
+			hdb.log.Printf("WARN: could not reconcile contract %v with host %v: %v", hc.ID, hc.IP, err)
+			continue
+		}
+
+		hdb.mu.Lock()
+		// The contract may have been revised while the request was in
+		// flight; reconcile against the current state.
+		current, exists := hdb.contracts[hc.ID]
+		if exists {
+			hdb.contracts[hc.ID] = hdb.reconcileContract(current, revTxn)
+			if err := hdb.save(); err != nil {
+				hdb.log.Println("WARN: could not save hostdb:", err)
+			}
+		}
+		hdb.mu.Unlock()
+	}
+}
@@ -0,0 +1,163 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestReconcileContract checks that newer valid revisions from the host are
+// adopted, and that disagreements with the host or the blockchain are
+// flagged.
+func TestReconcileContract(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostDBTester("TestReconcileContract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+	hdb := ht.hostdb
+
+	sk, pk, err := crypto.StdKeyGen.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{{Algorithm: types.SignatureEd25519, Key: pk[:]}},
+		SignaturesRequired: 1,
+	}
+	fc := types.FileContract{
+		WindowStart: 100,
+		WindowEnd:   1000,
+		UnlockHash:  uc.UnlockHash(),
+	}
+	fcid := types.FileContractID{1}
+
+	// signedRevision returns a signed transaction containing the given
+	// revision of the contract.
+	signedRevision := func(revNum uint64, windowEnd types.BlockHeight) types.Transaction {
+		txn := types.Transaction{
+			FileContractRevisions: []types.FileContractRevision{{
+				ParentID:          fcid,
+				UnlockConditions:  uc,
+				NewRevisionNumber: revNum,
+				NewFileSize:       revNum * 10,
+				NewWindowStart:    fc.WindowStart,
+				NewWindowEnd:      windowEnd,
+				NewUnlockHash:     fc.UnlockHash,
+			}},
+			TransactionSignatures: []types.TransactionSignature{{
+				ParentID:      crypto.Hash(fcid),
+				CoveredFields: types.CoveredFields{FileContractRevisions: []uint64{0}},
+			}},
+		}
+		sig, err := crypto.SignHash(txn.SigHash(0), sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txn.TransactionSignatures[0].Signature = sig[:]
+		return txn
+	}
+	local := hostContract{
+		IP:              "foo.com:1234",
+		ID:              fcid,
+		FileContract:    fc,
+		LastRevisionTxn: signedRevision(2, fc.WindowEnd),
+	}
+	local.LastRevision = local.LastRevisionTxn.FileContractRevisions[0]
+
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	// A newer revision from the host is adopted.
+	hc := hdb.reconcileContract(local, signedRevision(3, fc.WindowEnd))
+	if hc.Flag != "" || hc.LastRevision.NewRevisionNumber != 3 {
+		t.Fatal("newer revision was not adopted:", hc.Flag, hc.LastRevision.NewRevisionNumber)
+	}
+
+	// A host with an older revision is flagged.
+	hc = hdb.reconcileContract(local, signedRevision(1, fc.WindowEnd))
+	if hc.Flag != flagHostBehind || hc.LastRevision.NewRevisionNumber != 2 {
+		t.Fatal("host with an older revision was not flagged:", hc.Flag)
+	}
+
+	// A revision that changes the contract's fixed fields is rejected.
+	hc = hdb.reconcileContract(local, signedRevision(3, fc.WindowEnd+1))
+	if hc.Flag != flagInvalidRevision || hc.LastRevision.NewRevisionNumber != 2 {
+		t.Fatal("invalid revision was not flagged:", hc.Flag)
+	}
+
+	// A revision with a bad signature is rejected.
+	badSig := signedRevision(3, fc.WindowEnd)
+	badSig.TransactionSignatures[0].Signature[0]++
+	hc = hdb.reconcileContract(local, badSig)
+	if hc.Flag != flagInvalidRevision {
+		t.Fatal("revision with a bad signature was not flagged:", hc.Flag)
+	}
+
+	// A revision older than the blockchain's is flagged.
+	onChain := fc
+	onChain.RevisionNumber = 5
+	hdb.consensusContracts[fcid] = onChain
+	hc = hdb.reconcileContract(local, signedRevision(3, fc.WindowEnd))
+	if hc.Flag != flagBehindConsensus {
+		t.Fatal("contract behind the blockchain was not flagged:", hc.Flag)
+	}
+}
+
+// TestFetchLastRevision checks that a host only returns the last revision of
+// a contract to a caller that signs its challenge with the renter's key.
+func TestFetchLastRevision(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostDBTester("TestFetchLastRevision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+	h, settings, err := ht.addTestHost("TestFetchLastRevision")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// form a contract and revise it by uploading some data
+	data, err := crypto.RandBytes(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, err := ht.hostdb.newContract(settings, uint64(len(data)), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hu, err := ht.hostdb.newHostUploader(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hu.Upload(data); err != nil {
+		t.Fatal(err)
+	}
+	hu.Close()
+	hc := ht.hostdb.contracts[contract.ID]
+
+	revTxn, err := fetchLastRevision(hc.IP, hc.ID, hc.SecretKey, ht.hostdb.scanPolicy.RequestTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revTxn.FileContractRevisions) != 1 || revTxn.FileContractRevisions[0].NewRevisionNumber != hc.LastRevision.NewRevisionNumber {
+		t.Fatal("host returned the wrong revision:", revTxn.FileContractRevisions)
+	}
+
+	// a caller without the renter's key is refused
+	sk, _, err := crypto.StdKeyGen.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchLastRevision(hc.IP, hc.ID, sk, ht.hostdb.scanPolicy.RequestTimeout); err == nil {
+		t.Fatal("host returned the revision without a valid challenge response")
+	}
+}
@@ -11,34 +11,120 @@ import (
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// The following constants are the defaults of the scan policy, which can be
+// changed at runtime.
 const (
-	DefaultScanSleep = 1*time.Hour + 37*time.Minute
-	MaxScanSleep     = 4 * time.Hour
-	MinScanSleep     = 1 * time.Hour
+	MaxScanSleep = 4 * time.Hour
+	MinScanSleep = 1 * time.Hour
 
 	MaxActiveHosts              = 500
 	InactiveHostCheckupQuantity = 250
 
-	maxSettingsLen = 2e3
-
 	hostRequestTimeout = 5 * time.Second
 
 	// scanningThreads is the number of threads that will be probing hosts for
 	// their settings and checking for reliability.
 	scanningThreads = 25
+
+	// maxScanBackoff is the longest that a host which keeps failing to
+	// respond will go without being scanned.
+	maxScanBackoff = 48 * time.Hour
 )
 
+const (
+	maxSettingsLen = 2e3
+
+	// paidDownloadVersion is the first version in which hosts charge for
+	// downloads.
+	paidDownloadVersion = "0.4.8"
+)
+
+// MaxReliability and UnreachablePenalty are the defaults of the scan policy.
+// New hosts start with DefaultReliability, or the policy's MaxReliability if
+// that is lower.
 var (
 	MaxReliability     = types.NewCurrency64(225) // Given the scanning defaults, about 3 weeks of survival.
 	DefaultReliability = types.NewCurrency64(75)  // Given the scanning defaults, about 1 week of survival.
 	UnreachablePenalty = types.NewCurrency64(1)
 )
 
+// legacyHostSettings are the settings sent by hosts that do not report their
+// version.
+type legacyHostSettings struct {
+	IPAddress    modules.NetAddress
+	TotalStorage int64
+	MinFilesize  uint64
+	MaxFilesize  uint64
+	MinDuration  types.BlockHeight
+	MaxDuration  types.BlockHeight
+	WindowSize   types.BlockHeight
+	Price        types.Currency
+	Collateral   types.Currency
+	UnlockHash   types.UnlockHash
+}
+
+// unpricedHostSettings are the settings sent by hosts that report their
+// version but do not charge for downloads.
+type unpricedHostSettings struct {
+	Legacy  legacyHostSettings
+	Version string
+}
+
+// unsizedHostSettings are the settings sent by hosts that charge for
+// downloads but do not report their remaining storage.
+type unsizedHostSettings struct {
+	Unpriced      unpricedHostSettings
+	DownloadPrice types.Currency
+}
+
+// decodeHostSettings decodes the settings sent by a host, falling back to the
+// older formats if the host did not send its remaining storage, download
+// price, or version. Hosts that do not report their remaining storage are
+// assumed to have all of their storage remaining. The returned bool reports
+// whether the host used a format that predates download pricing.
+func decodeHostSettings(b []byte, settings *modules.HostSettings) (bool, error) {
+	if encoding.Unmarshal(b, settings) == nil {
+		return false, nil
+	}
+	var unsized unsizedHostSettings
+	priced := encoding.Unmarshal(b, &unsized) == nil
+	if !priced {
+		unsized = unsizedHostSettings{}
+		if encoding.Unmarshal(b, &unsized.Unpriced) != nil {
+			unsized.Unpriced = unpricedHostSettings{}
+			err := encoding.Unmarshal(b, &unsized.Unpriced.Legacy)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	unpriced := unsized.Unpriced
+	legacy := unpriced.Legacy
+	*settings = modules.HostSettings{
+		IPAddress:    legacy.IPAddress,
+		TotalStorage: legacy.TotalStorage,
+		MinFilesize:  legacy.MinFilesize,
+		MaxFilesize:  legacy.MaxFilesize,
+		MinDuration:  legacy.MinDuration,
+		MaxDuration:  legacy.MaxDuration,
+		WindowSize:   legacy.WindowSize,
+		Price:        legacy.Price,
+		Collateral:   legacy.Collateral,
+		UnlockHash:   legacy.UnlockHash,
+		Version:      unpriced.Version,
+
+		DownloadPrice:    unsized.DownloadPrice,
+		RemainingStorage: legacy.TotalStorage,
+	}
+	return !priced, nil
+}
+
 // addHostToScanPool creates a gofunc that adds a host to the scan pool. If the
 // scan pool is currently full, the blocking gofunc will not cause a deadlock.
 // The gofunc is created inside of this function to eliminate the burden of
@@ -57,7 +143,11 @@ func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.C
 	if !exists {
 		return
 	}
-	entry.reliability = entry.reliability.Sub(penalty)
+	if entry.reliability.Cmp(penalty) <= 0 {
+		entry.reliability = types.ZeroCurrency
+	} else {
+		entry.reliability = entry.reliability.Sub(penalty)
+	}
 
 	// If the entry is in the active database, remove it from the active
 	// database.
@@ -74,52 +164,138 @@ func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.C
 	}
 }
 
-// threadedProbeHost tries to fetch the settings of a host. If successful, the
-// host is put in the set of active hosts. If unsuccessful, the host id deleted
-// from the set of active hosts.
+// threadedProbeHosts scans the hosts in the scan pool until the number of
+// scanning threads exceeds the number allowed by the scan policy.
 func (hdb *HostDB) threadedProbeHosts() {
 	for hostEntry := range hdb.scanPool {
-		// Request settings from the queued host entry.
-		var settings modules.HostSettings
-		err := func() error {
-			conn, err := net.DialTimeout("tcp", string(hostEntry.IPAddress), hostRequestTimeout)
-			if err != nil {
-				return err
-			}
-			defer conn.Close()
-			err = encoding.WriteObject(conn, modules.RPCSettings)
-			if err != nil {
-				return err
-			}
-			return encoding.ReadObject(conn, &settings, maxSettingsLen)
-		}()
+		hdb.probeHost(hostEntry)
 
-		// Now that network communication is done, lock the hostdb to modify the
-		// host entry.
 		hdb.mu.Lock()
-		{
-			if err != nil {
-				hdb.decrementReliability(hostEntry.IPAddress, UnreachablePenalty)
-				hdb.mu.Unlock()
-				continue
-			}
+		if hdb.scanThreads > hdb.scanPolicy.ScanThreads {
+			hdb.scanThreads--
+			hdb.mu.Unlock()
+			return
+		}
+		hdb.mu.Unlock()
+	}
+}
 
-			// Update the host settings, reliability, and weight. The old IPAddress
-			// must be preserved.
-			settings.IPAddress = hostEntry.HostSettings.IPAddress
-			hostEntry.HostSettings = settings
-			hostEntry.reliability = MaxReliability
-			hostEntry.weight = calculateHostWeight(*hostEntry)
-
-			// If the host is not already in the database and 'MaxActiveHosts' has not
-			// been reached, add the host to the database.
-			_, exists1 := hdb.activeHosts[hostEntry.IPAddress]
-			_, exists2 := hdb.allHosts[hostEntry.IPAddress]
-			if !exists1 && exists2 && len(hdb.activeHosts) < MaxActiveHosts {
-				hdb.insertNode(hostEntry)
+// proveHostKey asks the host at addr to prove that it holds the secret key of
+// its public key by signing a random challenge, and returns the proven key.
+func proveHostKey(addr modules.NetAddress, timeout time.Duration) (types.SiaPublicKey, error) {
+	conn, err := net.DialTimeout("tcp", string(addr), timeout)
+	if err != nil {
+		return types.SiaPublicKey{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var challenge crypto.Hash
+	if _, err := rand.Read(challenge[:]); err != nil {
+		return types.SiaPublicKey{}, err
+	}
+	if err := encoding.WriteObject(conn, modules.RPCKeyProof); err != nil {
+		return types.SiaPublicKey{}, err
+	}
+	if err := encoding.WriteObject(conn, challenge); err != nil {
+		return types.SiaPublicKey{}, err
+	}
+	var pk types.SiaPublicKey
+	if err := encoding.ReadObject(conn, &pk, 256); err != nil {
+		return types.SiaPublicKey{}, err
+	}
+	var sig crypto.Signature
+	if err := encoding.ReadObject(conn, &sig, crypto.SignatureSize); err != nil {
+		return types.SiaPublicKey{}, err
+	}
+	if err := modules.VerifyChallenge(modules.RPCKeyProof, challenge, pk, sig); err != nil {
+		return types.SiaPublicKey{}, err
+	}
+	return pk, nil
+}
+
+// probeHost tries to fetch the settings of a host. If successful, the host is
+// put in the set of active hosts. If unsuccessful, the host is deleted from
+// the set of active hosts. Hosts that made signed announcements are also
+// asked to prove their key.
+func (hdb *HostDB) probeHost(hostEntry *hostEntry) {
+	hdb.mu.RLock()
+	timeout := hdb.scanPolicy.RequestTimeout
+	signed := hostEntry.signed
+	hdb.mu.RUnlock()
+
+	// Request settings from the queued host entry.
+	var settings modules.HostSettings
+	var ip net.IP
+	var oldFormat bool
+	err := func() error {
+		conn, err := net.DialTimeout("tcp", string(hostEntry.IPAddress), timeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(timeout))
+		if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			ip = tcpAddr.IP
+		}
+		err = encoding.WriteObject(conn, modules.RPCSettings)
+		if err != nil {
+			return err
+		}
+		b, err := encoding.ReadPrefix(conn, maxSettingsLen)
+		if err != nil {
+			return err
+		}
+		oldFormat, err = decodeHostSettings(b, &settings)
+		return err
+	}()
+
+	// Hosts that predate key proofs do not support the RPC, so a failed
+	// proof is not penalized.
+	var proven types.SiaPublicKey
+	var proofErr error
+	if err == nil && signed {
+		proven, proofErr = proveHostKey(hostEntry.IPAddress, timeout)
+	}
+
+	// Now that network communication is done, lock the hostdb to modify the
+	// host entry.
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.recordInteraction(hostEntry.IPAddress, interactionScan, err == nil)
+	if err != nil {
+		hdb.decrementReliability(hostEntry.IPAddress, hdb.scanPolicy.UnreachablePenalty)
+		return
+	}
+
+	// Update the host settings, reliability, and weight. The old IPAddress
+	// must be preserved.
+	settings.IPAddress = hostEntry.HostSettings.IPAddress
+	hostEntry.HostSettings = settings
+	hostEntry.ip = ip
+	hostEntry.freeDownloads = oldFormat || build.VersionCmp(settings.Version, paidDownloadVersion) < 0
+	hostEntry.reliability = hdb.scanPolicy.MaxReliability
+	hdb.updateHistoryStats(hostEntry)
+	hostEntry.weight = calculateHostWeight(*hostEntry, hdb.blockHeight)
+
+	// Bind the proven key to the host, unless the host was removed while it
+	// was being scanned.
+	if current, exists := hdb.allHosts[hostEntry.IPAddress]; signed && exists && current == hostEntry {
+		if proofErr != nil {
+			hdb.log.Printf("WARN: host %v did not prove its key: %v", hostEntry.IPAddress, proofErr)
+		} else if hdb.bindHostKey(hostEntry, proven) {
+			if err := hdb.save(); err != nil {
+				hdb.log.Println("WARN: could not save hostdb:", err)
 			}
 		}
-		hdb.mu.Unlock()
+	}
+
+	// If the host is not already in the database and the active host cap has
+	// not been reached, add the host to the database.
+	_, exists1 := hdb.activeHosts[hostEntry.IPAddress]
+	_, exists2 := hdb.allHosts[hostEntry.IPAddress]
+	if !exists1 && exists2 && len(hdb.activeHosts) < hdb.scanPolicy.MaxActiveHosts {
+		hdb.insertNode(hostEntry)
 	}
 }
 
@@ -127,22 +303,33 @@ func (hdb *HostDB) threadedProbeHosts() {
 // every few hours to see who is online and available for uploading.
 func (hdb *HostDB) threadedScan() {
 	for {
-		// Determine who to scan. At most 'MaxActiveHosts' will be scanned,
-		// starting with the active hosts followed by a random selection of the
-		// inactive hosts.
+		// Determine who to scan. All of the active hosts are scanned, followed
+		// by a random selection of the inactive hosts that are not backing
+		// off.
 		hdb.mu.Lock()
+		now := time.Now()
 		{
+			// Save the results of the previous round of scanning. Scans are
+			// not saved individually to avoid rewriting the hostdb for every
+			// host that is scanned.
+			if err := hdb.save(); err != nil {
+				hdb.log.Println("WARN: could not save hostdb:", err)
+			}
+
 			// Scan all active hosts.
 			for _, host := range hdb.activeHosts {
 				hdb.scanHostEntry(host.hostEntry)
 			}
 
-			// Assemble all of the inactive hosts into a single array.
+			// Assemble all of the inactive hosts that are due for a scan
+			// into a single array.
 			var random []*hostEntry
 			for _, entry := range hdb.allHosts {
 				entry2, exists := hdb.activeHosts[entry.IPAddress]
 				if !exists {
-					random = append(random, entry)
+					if hdb.scanDue(entry.IPAddress, now) {
+						random = append(random, entry)
+					}
 				} else {
 					if build.DEBUG {
 						if entry2.hostEntry != entry {
@@ -170,34 +357,39 @@ func (hdb *HostDB) threadedScan() {
 				random[n] = tmp
 			}
 
-			// Select the first InactiveHostCheckupQuantity hosts from the
-			// shuffled list and scan them.
-			n := InactiveHostCheckupQuantity
-			if len(random) < InactiveHostCheckupQuantity {
+			// Select the first InactiveHostCheckups hosts from the shuffled
+			// list and scan them.
+			n := hdb.scanPolicy.InactiveHostCheckups
+			if len(random) < n {
 				n = len(random)
 			}
 			for i := 0; i < n; i++ {
 				hdb.scanHostEntry(random[i])
 			}
 		}
+		minSleep := hdb.scanPolicy.MinScanInterval
+		maxSleep := hdb.scanPolicy.MaxScanInterval
 		hdb.mu.Unlock()
 
 		// Sleep for a random amount of time before doing another round of
 		// scanning. The minimums and maximums keep the scan time reasonable,
 		// while the randomness prevents the scanning from always happening at
 		// the same time of day or week.
-		maxBig := big.NewInt(int64(MaxScanSleep))
-		minBig := big.NewInt(int64(MinScanSleep))
-		randSleep, err := rand.Int(rand.Reader, maxBig.Sub(maxBig, minBig))
-		if err != nil {
-			if build.DEBUG {
-				panic(err)
-			} else {
-				// If there's an error, sleep for the default amount of time.
-				defaultBig := big.NewInt(int64(DefaultScanSleep))
-				randSleep = defaultBig.Sub(defaultBig, minBig)
+		sleep := minSleep
+		if maxSleep > minSleep {
+			randSleep, err := rand.Int(rand.Reader, big.NewInt(int64(maxSleep-minSleep)))
+			if err != nil {
+				if build.DEBUG {
+					panic(err)
+				}
+				// If there's an error, sleep halfway between the bounds.
+				randSleep = big.NewInt(int64(maxSleep-minSleep) / 2)
 			}
+			sleep += time.Duration(randSleep.Int64())
+		}
+		select {
+		case <-time.After(sleep):
+		case <-hdb.scanWake:
 		}
-		time.Sleep(time.Duration(randSleep.Int64()) + MinScanSleep) // this means the MaxScanSleep is actual Max+Min.
 	}
 }
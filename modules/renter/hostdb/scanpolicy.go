@@ -0,0 +1,146 @@
+package hostdb
+
+// scanpolicy.go contains the functions that manage the scan policy, which
+// controls how often hosts are scanned, how many hosts are scanned at once,
+// and how quickly the hostdb gives up on hosts that are offline.
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// maxScanThreads is the largest number of scanning threads that the scan
+	// policy may request.
+	maxScanThreads = 250
+)
+
+var (
+	errBadScanInterval   = errors.New("scan intervals must be positive, with the maximum no less than the minimum")
+	errBadScanThreads    = errors.New("number of scan threads is out of range")
+	errBadRequestTimeout = errors.New("request timeout must be positive")
+	errBadMaxActiveHosts = errors.New("max active hosts must be at least 1")
+	errNegativeScanValue = errors.New("inactive host checkups and max scan backoff cannot be negative")
+	errBadReliability    = errors.New("max reliability and unreachable penalty must be positive, with the penalty no greater than the max reliability")
+
+	// defaultScanPolicy is the scan policy used until a different policy is
+	// set.
+	defaultScanPolicy = modules.HostScanPolicy{
+		MinScanInterval:      MinScanSleep,
+		MaxScanInterval:      MaxScanSleep,
+		ScanThreads:          scanningThreads,
+		RequestTimeout:       hostRequestTimeout,
+		MaxActiveHosts:       MaxActiveHosts,
+		InactiveHostCheckups: InactiveHostCheckupQuantity,
+		MaxScanBackoff:       maxScanBackoff,
+		MaxReliability:       MaxReliability,
+		UnreachablePenalty:   UnreachablePenalty,
+	}
+)
+
+// validateScanPolicy checks that a scan policy is usable.
+func validateScanPolicy(sp modules.HostScanPolicy) error {
+	switch {
+	case sp.MinScanInterval <= 0 || sp.MaxScanInterval < sp.MinScanInterval:
+		return errBadScanInterval
+	case sp.ScanThreads < 1 || sp.ScanThreads > maxScanThreads:
+		return errBadScanThreads
+	case sp.RequestTimeout <= 0:
+		return errBadRequestTimeout
+	case sp.MaxActiveHosts < 1:
+		return errBadMaxActiveHosts
+	case sp.InactiveHostCheckups < 0 || sp.MaxScanBackoff < 0:
+		return errNegativeScanValue
+	case sp.MaxReliability.IsZero() || sp.UnreachablePenalty.IsZero() || sp.UnreachablePenalty.Cmp(sp.MaxReliability) > 0:
+		return errBadReliability
+	}
+	return nil
+}
+
+// consecutiveScanFailures returns the number of scans that the host has
+// failed since it last responded, along with the time of the most recent
+// scan.
+func (h hostHistory) consecutiveScanFailures() (failures int, lastScan time.Time) {
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i].Type != interactionScan {
+			continue
+		}
+		if lastScan.IsZero() {
+			lastScan = h[i].Timestamp
+		}
+		if h[i].Success {
+			break
+		}
+		failures++
+	}
+	return failures, lastScan
+}
+
+// scanBackoff returns how long to wait between scans of a host that has
+// failed the given number of consecutive scans. The wait doubles with each
+// failure, up to MaxScanBackoff. A MaxScanBackoff of 0 disables backoff.
+// scanBackoff must be called under lock.
+func (hdb *HostDB) scanBackoff(failures int) time.Duration {
+	if failures == 0 || hdb.scanPolicy.MaxScanBackoff == 0 {
+		return 0
+	}
+	backoff := hdb.scanPolicy.MinScanInterval
+	for i := 0; i < failures && backoff < hdb.scanPolicy.MaxScanBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > hdb.scanPolicy.MaxScanBackoff {
+		backoff = hdb.scanPolicy.MaxScanBackoff
+	}
+	return backoff
+}
+
+// scanDue reports whether an inactive host should be considered for scanning,
+// taking into account how many times in a row the host has failed to respond.
+// scanDue must be called under lock.
+func (hdb *HostDB) scanDue(addr modules.NetAddress, now time.Time) bool {
+	failures, lastScan := hdb.history[addr].consecutiveScanFailures()
+	return !now.Before(lastScan.Add(hdb.scanBackoff(failures)))
+}
+
+// adjustScanThreads starts scanning threads until the number of threads
+// matches the scan policy. Surplus threads stop on their own after finishing
+// their current scan. adjustScanThreads must be called under lock.
+func (hdb *HostDB) adjustScanThreads() {
+	for hdb.scanThreads < hdb.scanPolicy.ScanThreads {
+		hdb.scanThreads++
+		go hdb.threadedProbeHosts()
+	}
+}
+
+// HostScanPolicy returns the policy used to scan hosts.
+func (hdb *HostDB) HostScanPolicy() modules.HostScanPolicy {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return hdb.scanPolicy
+}
+
+// wakeScan interrupts the sleep of threadedScan, so that a new round of
+// scanning starts immediately.
+func (hdb *HostDB) wakeScan() {
+	select {
+	case hdb.scanWake <- struct{}{}:
+	default:
+	}
+}
+
+// SetHostScanPolicy changes the policy used to scan hosts. A new round of
+// scanning starts immediately under the new policy.
+func (hdb *HostDB) SetHostScanPolicy(sp modules.HostScanPolicy) error {
+	if err := validateScanPolicy(sp); err != nil {
+		return err
+	}
+
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.scanPolicy = sp
+	hdb.adjustScanThreads()
+	hdb.wakeScan()
+	return hdb.save()
+}
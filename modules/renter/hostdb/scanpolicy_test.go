@@ -0,0 +1,174 @@
+package hostdb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestScanBackoff checks that hosts which repeatedly fail to respond are
+// scanned less often.
+func TestScanBackoff(t *testing.T) {
+	hdb := &HostDB{
+		history:    make(map[modules.NetAddress]hostHistory),
+		scanPolicy: defaultScanPolicy,
+	}
+	hdb.scanPolicy.MinScanInterval = time.Hour
+	hdb.scanPolicy.MaxScanBackoff = 10 * time.Hour
+	now := time.Now()
+
+	// A host that has never been scanned is always due.
+	if !hdb.scanDue(fakeAddr(0), now) {
+		t.Fatal("unscanned host should be due for a scan")
+	}
+
+	// The backoff doubles with each consecutive failure, up to the maximum.
+	expected := []time.Duration{0, 2 * time.Hour, 4 * time.Hour, 8 * time.Hour, 10 * time.Hour, 10 * time.Hour}
+	for failures, backoff := range expected {
+		if b := hdb.scanBackoff(failures); b != backoff {
+			t.Errorf("backoff after %v failures: expected %v, got %v", failures, backoff, b)
+		}
+	}
+
+	// Only failures since the last successful scan count.
+	hdb.history[fakeAddr(1)] = hostHistory{
+		{Type: interactionScan, Success: false, Timestamp: now.Add(-5 * time.Hour)},
+		{Type: interactionScan, Success: true, Timestamp: now.Add(-4 * time.Hour)},
+		{Type: interactionScan, Success: false, Timestamp: now.Add(-3 * time.Hour)},
+		{Type: interactionUpload, Success: false, Timestamp: now.Add(-2 * time.Hour)},
+		{Type: interactionScan, Success: false, Timestamp: now.Add(-90 * time.Minute)},
+	}
+	failures, lastScan := hdb.history[fakeAddr(1)].consecutiveScanFailures()
+	if failures != 2 || !lastScan.Equal(now.Add(-90*time.Minute)) {
+		t.Fatal("wrong consecutive failures:", failures, lastScan)
+	}
+	if hdb.scanDue(fakeAddr(1), now) {
+		t.Fatal("host should be backing off")
+	}
+	if !hdb.scanDue(fakeAddr(1), now.Add(3*time.Hour)) {
+		t.Fatal("host should be due once its backoff has elapsed")
+	}
+
+	// Disabling backoff makes every host due.
+	hdb.scanPolicy.MaxScanBackoff = 0
+	if !hdb.scanDue(fakeAddr(1), now) {
+		t.Fatal("host should be due with backoff disabled")
+	}
+}
+
+// TestScanPolicyPersist checks that invalid scan policies are rejected and
+// that the scan policy survives a restart of the hostdb.
+func TestScanPolicyPersist(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdbt, err := newHostDBTester("TestScanPolicyPersist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hdbt.Close()
+
+	if !reflect.DeepEqual(hdbt.hostdb.HostScanPolicy(), defaultScanPolicy) {
+		t.Fatal("new hostdb should use the default scan policy")
+	}
+
+	sp := defaultScanPolicy
+	sp.MaxScanInterval = sp.MinScanInterval - 1
+	if err := hdbt.hostdb.SetHostScanPolicy(sp); err != errBadScanInterval {
+		t.Fatal("expected errBadScanInterval, got", err)
+	}
+	sp = defaultScanPolicy
+	sp.ScanThreads = 0
+	if err := hdbt.hostdb.SetHostScanPolicy(sp); err != errBadScanThreads {
+		t.Fatal("expected errBadScanThreads, got", err)
+	}
+	sp = defaultScanPolicy
+	sp.UnreachablePenalty = sp.MaxReliability.Add(types.NewCurrency64(1))
+	if err := hdbt.hostdb.SetHostScanPolicy(sp); err != errBadReliability {
+		t.Fatal("expected errBadReliability, got", err)
+	}
+
+	sp = defaultScanPolicy
+	sp.ScanThreads = 40
+	sp.RequestTimeout = 10 * time.Second
+	sp.MaxScanBackoff = 0
+	err = hdbt.hostdb.SetHostScanPolicy(sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdbt.hostdb.mu.RLock()
+	threads := hdbt.hostdb.scanThreads
+	hdbt.hostdb.mu.RUnlock()
+	if threads != 40 {
+		t.Fatal("expected 40 scan threads, got", threads)
+	}
+
+	hdb, err := New(hdbt.cs, hdbt.wallet, hdbt.tpool, hdbt.hostdb.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hdb.HostScanPolicy(), sp) {
+		t.Fatal("wrong scan policy after reload:", hdb.HostScanPolicy())
+	}
+
+	// An invalid policy on disk is replaced by the default policy.
+	hdb.mu.Lock()
+	hdb.scanPolicy.ScanThreads = 0
+	err = hdb.save()
+	hdb.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb, err = New(hdbt.cs, hdbt.wallet, hdbt.tpool, hdbt.hostdb.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hdb.HostScanPolicy(), defaultScanPolicy) {
+		t.Fatal("invalid scan policy was loaded:", hdb.HostScanPolicy())
+	}
+}
+
+// TestReliabilityPolicy checks that hosts are penalized according
+// to the reliability settings of the scan policy.
+func TestReliabilityPolicy(t *testing.T) {
+	hdb := &HostDB{
+		allHosts:    make(map[modules.NetAddress]*hostEntry),
+		activeHosts: make(map[modules.NetAddress]*hostNode),
+		scanPolicy:  defaultScanPolicy,
+		scanPool:    make(chan *hostEntry, scanPoolSize),
+	}
+	hdb.scanPolicy.MaxReliability = types.NewCurrency64(10)
+	hdb.scanPolicy.UnreachablePenalty = types.NewCurrency64(4)
+
+	// New hosts start with no more than the policy's maximum reliability.
+	hdb.insertHost(hostAnnouncement{IPAddress: fakeAddr(1)})
+	entry := hdb.allHosts[fakeAddr(1)]
+	if entry.reliability.Cmp(types.NewCurrency64(10)) != 0 {
+		t.Fatal("wrong starting reliability:", entry.reliability)
+	}
+
+	// A penalty larger than the remaining reliability removes the host.
+	hdb.decrementReliability(entry.IPAddress, hdb.scanPolicy.UnreachablePenalty)
+	hdb.decrementReliability(entry.IPAddress, hdb.scanPolicy.UnreachablePenalty)
+	if entry.reliability.Cmp(types.NewCurrency64(2)) != 0 {
+		t.Fatal("wrong reliability after penalties:", entry.reliability)
+	}
+	hdb.decrementReliability(entry.IPAddress, hdb.scanPolicy.UnreachablePenalty)
+	if _, exists := hdb.allHosts[fakeAddr(1)]; exists {
+		t.Fatal("unreliable host was not removed")
+	}
+}
+
+// TestWakeScan checks that waking the scan loop never blocks, and leaves at
+// most one pending wakeup.
+func TestWakeScan(t *testing.T) {
+	hdb := &HostDB{scanWake: make(chan struct{}, 1)}
+	hdb.wakeScan()
+	hdb.wakeScan()
+	if len(hdb.scanWake) != 1 {
+		t.Fatal("expected one pending wakeup, got", len(hdb.scanWake))
+	}
+}
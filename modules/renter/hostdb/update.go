@@ -1,39 +1,35 @@
 package hostdb
 
 import (
-	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// A hostAnnouncement is a host announcement found in the blockchain. The
+// public key is empty for legacy announcements, which are not signed.
+type hostAnnouncement struct {
+	IPAddress modules.NetAddress
+	PublicKey types.SiaPublicKey
+}
+
 // findHostAnnouncements returns a list of the host announcements found within
-// a given block. No check is made to see that the ip address found in the
-// announcement is actually a valid ip address.
-func findHostAnnouncements(b types.Block) (announcements []modules.HostSettings) {
+// a given block. Both signed and legacy announcements are returned; signed
+// announcements with invalid signatures are skipped. No check is made to see
+// that the ip address found in the announcement is actually a valid ip
+// address.
+func findHostAnnouncements(b types.Block) (announcements []hostAnnouncement) {
 	for _, t := range b.Transactions {
-		// the HostAnnouncement must be prefaced by the standard host
-		// announcement string
-		var prefix types.Specifier
 		for _, arb := range t.ArbitraryData {
-			copy(prefix[:], arb)
-			if prefix != modules.PrefixHostAnnouncement {
-				continue
-			}
-
-			// decode the HostAnnouncement
-			var ha modules.HostAnnouncement
-			err := encoding.Unmarshal(arb[types.SpecifierLen:], &ha)
+			addr, pk, err := modules.DecodeAnnouncement(arb)
 			if err != nil {
 				continue
 			}
-
-			// Add the announcement to the slice being returned.
-			announcements = append(announcements, modules.HostSettings{
-				IPAddress: ha.IPAddress,
+			announcements = append(announcements, hostAnnouncement{
+				IPAddress: addr,
+				PublicKey: pk,
 			})
 		}
 	}
-
 	return
 }
 
@@ -42,13 +38,63 @@ func findHostAnnouncements(b types.Block) (announcements []modules.HostSettings)
 func (hdb *HostDB) ProcessConsensusChange(cc modules.ConsensusChange) {
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
-	hdb.blockHeight += types.BlockHeight(len(cc.AppliedBlocks))
-	hdb.blockHeight -= types.BlockHeight(len(cc.RevertedBlocks))
 
-	// Add hosts announced in blocks that were applied.
+	// The consensus set replays the blockchain from the genesis block at
+	// startup. The persistent state of the hostdb, such as the moves of hosts
+	// and the market history, already reflects the replayed blocks, so it is
+	// not changed until the replay is complete.
+	replaying := hdb.blockHeight < hdb.replayHeight
+
+	// Undo the announcements made in blocks that were reverted, from the
+	// most recent block back.
+	numMoves := len(hdb.moves)
+	for _, block := range cc.RevertedBlocks {
+		for _, host := range findHostAnnouncements(block) {
+			if !replaying {
+				hdb.revertHostMoves(host.IPAddress, hdb.blockHeight)
+			}
+			hdb.revertAnnouncement(host.IPAddress, hdb.blockHeight)
+		}
+		hdb.blockHeight--
+	}
+	movesChanged := len(hdb.moves) != numMoves
+	var marketChanged bool
+	if !replaying && len(cc.RevertedBlocks) != 0 {
+		marketChanged = hdb.revertMarketSamples()
+	}
+
+	// Add hosts announced in blocks that were applied. The height is
+	// advanced one block at a time so that each host records the height at
+	// which it was announced. The market is only sampled once the hostdb has
+	// caught up with the blockchain, since the hosts have not been scanned
+	// during the replay.
+	var proofsChanged bool
 	for _, block := range cc.AppliedBlocks {
+		hdb.blockHeight++
 		for _, host := range findHostAnnouncements(block) {
 			hdb.insertHost(host)
 		}
+		if hdb.processStorageProofs(block) {
+			proofsChanged = true
+		}
+		if hdb.blockHeight > hdb.replayHeight && hdb.blockHeight%marketSampleInterval == 0 && hdb.blockHeight > hdb.lastMarketSample() {
+			hdb.sampleMarket()
+			marketChanged = true
+		}
+	}
+	for _, diff := range cc.FileContractDiffs {
+		if _, exists := hdb.contracts[diff.ID]; !exists {
+			continue
+		}
+		if diff.Direction == modules.DiffApply {
+			hdb.consensusContracts[diff.ID] = diff.FileContract
+		} else {
+			delete(hdb.consensusContracts, diff.ID)
+		}
+	}
+	if proofsChanged || marketChanged || movesChanged {
+		if err := hdb.save(); err != nil {
+			hdb.log.Println("WARN: could not save hostdb:", err)
+		}
 	}
 }
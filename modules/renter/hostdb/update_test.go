@@ -3,6 +3,7 @@ package hostdb
 import (
 	"testing"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -38,6 +39,22 @@ func TestFindHostAnnouncements(t *testing.T) {
 	if len(announcements) != 0 {
 		t.Error("host announcement found when there was an invalid encoding of a host announcement")
 	}
+
+	// Try with a signed announcement.
+	sk, pk, err := crypto.StdKeyGen.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spk := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}
+	signed, err := modules.CreateSignedAnnouncement("foo.com:1234", spk, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Transactions[0].ArbitraryData[0] = signed
+	announcements = findHostAnnouncements(b)
+	if len(announcements) != 1 || string(announcements[0].PublicKey.Key) != string(spk.Key) {
+		t.Error("signed host announcement not found in block")
+	}
 }
 
 // TestReceiveConsensusSetUpdate probes the ReveiveConsensusSetUpdate method of
@@ -83,3 +100,134 @@ func TestReceiveConsensusSetUpdate(t *testing.T) {
 		t.Fatal("hostdb should have a host after getting a host announcement transcation")
 	}
 }
+
+// TestSignedAnnouncementMove checks that a host is only moved, along with its
+// history and contracts, once it has proven its key at a new address, and
+// that the move is undone if the announcement of the new address is reverted.
+func TestSignedAnnouncementMove(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostDBTester("TestSignedAnnouncementMove")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+	hdb := ht.hostdb
+
+	newKey := func() types.SiaPublicKey {
+		_, pk, err := crypto.StdKeyGen.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}
+	}
+	newContract := func(id types.FileContractID, addr modules.NetAddress, hostKey types.SiaPublicKey) {
+		hdb.contracts[id] = hostContract{
+			IP: addr,
+			ID: id,
+			LastRevision: types.FileContractRevision{
+				UnlockConditions: types.UnlockConditions{PublicKeys: []types.SiaPublicKey{newKey(), hostKey}},
+			},
+		}
+	}
+	pk1, pk2 := newKey(), newKey()
+	oldAddr := modules.NetAddress("1.2.3.4:9982")
+	newAddr := modules.NetAddress("5.6.7.8:9982")
+	attackAddr := modules.NetAddress("9.9.9.9:9982")
+
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.insertHost(hostAnnouncement{IPAddress: oldAddr, PublicKey: pk1})
+	hdb.recordInteraction(oldAddr, interactionUpload, true)
+	newContract(types.FileContractID{1}, oldAddr, pk1)
+	newContract(types.FileContractID{2}, oldAddr, pk2)
+	if len(hdb.allHosts[oldAddr].publicKey.Key) != 0 {
+		t.Fatal("key was bound to the host without a proof")
+	}
+
+	// An announcement alone does not move the host, even after the key was
+	// proven at the old address.
+	hdb.bindHostKey(hdb.allHosts[oldAddr], pk1)
+	hdb.insertHost(hostAnnouncement{IPAddress: attackAddr, PublicKey: pk1})
+	if _, exists := hdb.allHosts[oldAddr]; !exists {
+		t.Fatal("host was moved by an announcement")
+	}
+	if hdb.contracts[types.FileContractID{1}].IP != oldAddr {
+		t.Fatal("contract was moved by an announcement")
+	}
+
+	// Proving the key at a new address moves the host and the contracts
+	// formed with the key.
+	hdb.blockHeight++
+	hdb.insertHost(hostAnnouncement{IPAddress: newAddr, PublicKey: pk1})
+	if !hdb.bindHostKey(hdb.allHosts[newAddr], pk1) {
+		t.Fatal("no contracts were moved")
+	}
+	if _, exists := hdb.allHosts[oldAddr]; exists {
+		t.Fatal("host still exists at its old address")
+	}
+	if len(hdb.history[newAddr]) != 1 || len(hdb.history[oldAddr]) != 0 {
+		t.Fatal("history was not moved:", hdb.history)
+	}
+	if hdb.contracts[types.FileContractID{1}].IP != newAddr {
+		t.Fatal("contract was not moved to the new address")
+	}
+	if hdb.contracts[types.FileContractID{2}].IP != oldAddr {
+		t.Fatal("contract formed with a different key was moved")
+	}
+
+	// Reverting the announcement of the new address moves the host back.
+	hdb.revertHostMoves(newAddr, hdb.blockHeight)
+	hdb.revertAnnouncement(newAddr, hdb.blockHeight)
+	if _, exists := hdb.allHosts[newAddr]; exists {
+		t.Fatal("host announced in a reverted block still exists")
+	}
+	if hdb.contracts[types.FileContractID{1}].IP != oldAddr {
+		t.Fatal("contract was not moved back")
+	}
+	if hdb.hostsByKey[crypto.HashObject(pk1)] != oldAddr {
+		t.Fatal("key was not moved back")
+	}
+	if len(hdb.moves) != 0 {
+		t.Fatal("reverted move was not forgotten")
+	}
+}
+
+// TestProveHostKey checks that a host can prove that it holds its key, and
+// that the proven key is bound to the host when it is scanned.
+func TestProveHostKey(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ht, err := newHostDBTester("TestProveHostKey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	_, settings, err := ht.addTestHost("TestProveHostKey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := proveHostKey(settings.IPAddress, hostRequestTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ht.hostdb.mu.Lock()
+	entry := ht.hostdb.allHosts[settings.IPAddress]
+	entry.signed = true
+	entry.reliability = DefaultReliability
+	ht.hostdb.mu.Unlock()
+	ht.hostdb.probeHost(entry)
+
+	ht.hostdb.mu.RLock()
+	defer ht.hostdb.mu.RUnlock()
+	if string(entry.publicKey.Key) != string(pk.Key) {
+		t.Fatal("proven key was not bound to the host")
+	}
+	if ht.hostdb.hostsByKey[crypto.HashObject(pk)] != settings.IPAddress {
+		t.Fatal("proven key does not map to the host")
+	}
+}
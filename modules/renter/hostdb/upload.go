@@ -74,6 +74,15 @@ func (hu *hostUploader) Close() error {
 // Upload revises an existing file contract with a host, and then uploads a
 // piece to it.
 func (hu *hostUploader) Upload(data []byte) (uint64, error) {
+	// downloads from the host revise the contract too, so pick up the latest
+	// revision before building a new one
+	hu.hdb.mu.RLock()
+	if hc, exists := hu.hdb.contracts[hu.contract.ID]; exists {
+		hu.contract.LastRevision = hc.LastRevision
+		hu.contract.LastRevisionTxn = hc.LastRevisionTxn
+	}
+	hu.hdb.mu.RUnlock()
+
 	// offset is old filesize
 	offset := hu.contract.LastRevision.NewFileSize
 
@@ -94,6 +103,9 @@ func (hu *hostUploader) Upload(data []byte) (uint64, error) {
 	rev := newRevision(hu.contract.LastRevision, uint64(len(data)), merkleRoot, piecePrice)
 	signedTxn, err := negotiateRevision(hu.conn, rev, data, hu.contract.SecretKey)
 	if err != nil {
+		hu.hdb.mu.Lock()
+		hu.hdb.recordInteraction(hu.contract.IP, interactionUpload, false)
+		hu.hdb.mu.Unlock()
 		return 0, err
 	}
 
@@ -101,6 +113,7 @@ func (hu *hostUploader) Upload(data []byte) (uint64, error) {
 	hu.contract.LastRevision = rev
 	hu.contract.LastRevisionTxn = signedTxn
 	hu.hdb.mu.Lock()
+	hu.hdb.recordInteraction(hu.contract.IP, interactionUpload, true)
 	hu.hdb.contracts[hu.contract.ID] = hu.contract
 	hu.hdb.save()
 	hu.hdb.mu.Unlock()
@@ -186,7 +199,15 @@ func (p *pool) UniqueHosts(n int, exclude []modules.NetAddress) (hosts []Uploade
 		return
 	}
 
-	// first reuse existing connections
+	// first reuse existing connections, keeping at most one host per subnet
+	p.hdb.mu.Lock()
+	usedSubnets := make(map[string]struct{})
+	for _, addr := range exclude {
+		if subnet := p.hdb.hostSubnet(addr); subnet != "" {
+			usedSubnets[subnet] = struct{}{}
+		}
+	}
+	ignore := append([]modules.NetAddress(nil), exclude...)
 outer:
 	for _, h := range p.hosts {
 		for _, ip := range exclude {
@@ -194,19 +215,29 @@ outer:
 				continue outer
 			}
 		}
+		ignore = append(ignore, h.Address())
+		subnet := p.hdb.hostSubnet(h.Address())
+		if _, used := usedSubnets[subnet]; used {
+			continue
+		} else if subnet != "" {
+			usedSubnets[subnet] = struct{}{}
+		}
 		hosts = append(hosts, h)
 		if len(hosts) >= n {
+			p.hdb.mu.Unlock()
 			return hosts
 		}
 	}
 
 	// form new contracts from randomly-picked nodes
-	p.hdb.mu.Lock()
-	randHosts := p.hdb.randomHosts(n*2, exclude)
+	randHosts := p.hdb.randomHosts(n*2, ignore)
 	p.hdb.mu.Unlock()
 	for _, host := range randHosts {
 		contract, err := p.hdb.newContract(host, p.filesize, p.duration)
 		if err != nil {
+			p.hdb.mu.Lock()
+			p.hdb.recordInteraction(host.IPAddress, interactionUpload, false)
+			p.hdb.mu.Unlock()
 			continue
 		}
 		hu, err := p.hdb.newHostUploader(contract)
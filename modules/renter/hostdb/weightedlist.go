@@ -158,7 +158,8 @@ func (hdb *HostDB) isEmpty() bool {
 // no repeats, but the length of the slice returned may be less than 'n', and
 // may even be 0. The hosts that get returned first have the higher priority.
 // Hosts specified in 'ignore' will not be considered; pass 'nil' if no
-// blacklist is desired.
+// blacklist is desired. Hosts excluded by the host filter are never returned.
+// No two returned hosts share a subnet with each other or with an ignored host.
 func (hdb *HostDB) randomHosts(n int, ignore []modules.NetAddress) (hosts []modules.HostSettings) {
 	if hdb.isEmpty() {
 		return
@@ -167,8 +168,14 @@ func (hdb *HostDB) randomHosts(n int, ignore []modules.NetAddress) (hosts []modu
 	// These will be restored after selection is finished.
 	var removedEntries []*hostEntry
 
-	// Remove hosts that we want to ignore.
-	for _, addr := range ignore {
+	// Remove hosts that we want to ignore, and hosts excluded by the filter.
+	exclude := append([]modules.NetAddress(nil), ignore...)
+	for addr := range hdb.activeHosts {
+		if hdb.filtered(addr) {
+			exclude = append(exclude, addr)
+		}
+	}
+	for _, addr := range exclude {
 		node, exists := hdb.activeHosts[addr]
 		if !exists {
 			continue
@@ -178,8 +185,18 @@ func (hdb *HostDB) randomHosts(n int, ignore []modules.NetAddress) (hosts []modu
 		removedEntries = append(removedEntries, node.hostEntry)
 	}
 
+	// At most one host may be picked from each subnet, including the subnets
+	// of the ignored hosts.
+	usedSubnets := make(map[string]struct{})
+	for _, addr := range ignore {
+		if subnet := hdb.hostSubnet(addr); subnet != "" {
+			usedSubnets[subnet] = struct{}{}
+		}
+	}
+
 	// Pick a host, remove it from the tree, and repeat until we have n hosts
-	// or the tree is empty.
+	// or the tree is empty. Hosts in a subnet that has already been used are
+	// removed without being picked.
 	for len(hosts) < n && !hdb.isEmpty() {
 		randWeight, err := rand.Int(rand.Reader, hdb.hostTree.weight.Big())
 		if err != nil {
@@ -189,7 +206,13 @@ func (hdb *HostDB) randomHosts(n int, ignore []modules.NetAddress) (hosts []modu
 		if err != nil {
 			break
 		}
-		hosts = append(hosts, node.hostEntry.HostSettings)
+		subnet := hdb.hostSubnet(node.hostEntry.IPAddress)
+		if _, used := usedSubnets[subnet]; !used {
+			hosts = append(hosts, node.hostEntry.HostSettings)
+			if subnet != "" {
+				usedSubnets[subnet] = struct{}{}
+			}
+		}
 
 		node.removeNode()
 		delete(hdb.activeHosts, node.hostEntry.IPAddress)
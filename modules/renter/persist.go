@@ -12,7 +12,9 @@ import (
 	"strconv"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -29,7 +31,11 @@ var (
 	ErrIncompatible   = errors.New("file is not compatible with current version")
 
 	shareHeader  = [15]byte{'S', 'i', 'a', ' ', 'S', 'h', 'a', 'r', 'e', 'd', ' ', 'F', 'i', 'l', 'e'}
-	shareVersion = "0.4"
+	shareVersion = "0.5"
+
+	// COMPATv0.4.8 - files shared before cipher types were introduced do not
+	// specify a cipher, and are always encrypted with Twofish.
+	shareVersionNoCipher = "0.4"
 
 	saveMetadata = persist.Metadata{
 		Header:  "Renter Persistence",
@@ -37,6 +43,60 @@ var (
 	}
 )
 
+// encodeErasureCode writes the name and parameters of an erasure code to enc.
+// Only codes that appear in the erasureCoders registry can be encoded.
+func encodeErasureCode(enc *encoding.Encoder, code modules.ErasureCoder) error {
+	pc, ok := code.(persistableCoder)
+	if !ok {
+		if build.DEBUG {
+			panic("unknown erasure code")
+		}
+		return errors.New("unknown erasure code")
+	}
+	err := enc.Encode(pc.codeName())
+	if err != nil {
+		return err
+	}
+	for _, param := range pc.codeParams() {
+		err = enc.Encode(param)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeErasureCode reads an erasure code written by encodeErasureCode and
+// constructs it using the erasureCoders registry.
+func decodeErasureCode(dec *encoding.Decoder) (modules.ErasureCoder, error) {
+	var codeType string
+	if err := dec.Decode(&codeType); err != nil {
+		return nil, err
+	}
+	ect, exists := erasureCoders[codeType]
+	if !exists {
+		return nil, errors.New("unrecognized erasure code type: " + codeType)
+	}
+	// Every parameter of the registered codes is a number of pieces. The
+	// parameters are bounded before the code is constructed, since a code
+	// with too many pieces would cause huge allocations.
+	params := make([]uint64, ect.numParams)
+	var numPieces uint64
+	for i := range params {
+		if err := dec.Decode(&params[i]); err != nil {
+			return nil, err
+		}
+		if params[i] > maxErasurePieces {
+			return nil, errTooManyPieces
+		}
+		numPieces += params[i]
+	}
+	if numPieces > maxErasurePieces {
+		return nil, errTooManyPieces
+	}
+	return ect.new(params)
+}
+
 // save saves a file to w in shareable form. Files are stored in binary format
 // and gzipped to reduce size.
 func (f *file) save(w io.Writer) error {
@@ -62,22 +122,16 @@ func (f *file) save(w io.Writer) error {
 		return err
 	}
 
+	// encode cipher type
+	err = enc.Encode(f.cipherType)
+	if err != nil {
+		return err
+	}
+
 	// encode erasureCode
-	switch code := f.erasureCode.(type) {
-	case *rsCode:
-		err = enc.EncodeAll(
-			"Reed-Solomon",
-			uint64(code.dataPieces),
-			uint64(code.numPieces-code.dataPieces),
-		)
-		if err != nil {
-			return err
-		}
-	default:
-		if build.DEBUG {
-			panic("unknown erasure code")
-		}
-		return errors.New("unknown erasure code")
+	err = encodeErasureCode(enc, f.erasureCode)
+	if err != nil {
+		return err
 	}
 	// encode contracts
 	if err := enc.Encode(uint64(len(f.contracts))); err != nil {
@@ -91,8 +145,9 @@ func (f *file) save(w io.Writer) error {
 	return nil
 }
 
-// load loads a file created by save.
-func (f *file) load(r io.Reader) error {
+// load loads a file created by save. version is the version of the .sia
+// format that the file was saved with.
+func (f *file) load(r io.Reader, version string) error {
 	zip, err := gzip.NewReader(r)
 	if err != nil {
 		return err
@@ -117,28 +172,19 @@ func (f *file) load(r io.Reader) error {
 		return err
 	}
 
-	// decode erasure coder
-	var codeType string
-	if err := dec.Decode(&codeType); err != nil {
-		return err
-	}
-	switch codeType {
-	case "Reed-Solomon":
-		var nData, nParity uint64
-		err = dec.DecodeAll(
-			&nData,
-			&nParity,
-		)
-		if err != nil {
-			return err
-		}
-		rsc, err := NewRSCode(int(nData), int(nParity))
+	// decode cipher type
+	f.cipherType = crypto.TypeTwofish
+	if version != shareVersionNoCipher {
+		err = dec.Decode(&f.cipherType)
 		if err != nil {
 			return err
 		}
-		f.erasureCode = rsc
-	default:
-		return errors.New("unrecognized erasure code type: " + codeType)
+	}
+
+	// decode erasure coder
+	f.erasureCode, err = decodeErasureCode(dec)
+	if err != nil {
+		return err
 	}
 
 	// decode contracts
@@ -157,94 +203,116 @@ func (f *file) load(r io.Reader) error {
 	return nil
 }
 
-// saveFile saves a file to the renter directory.
-func (r *Renter) saveFile(f *file) error {
-	handle, err := persist.NewSafeFile(filepath.Join(r.persistDir, f.name+ShareExtension))
+// legacyFiles returns the names of the files in the persist directory that
+// were written by versions of the renter that predate the renter database:
+// one .sia file per upload, plus the renter.json tracking file.
+func (r *Renter) legacyFiles() ([]string, error) {
+	dir, err := os.Open(r.persistDir)
 	if err != nil {
-		return err
-	}
-	defer handle.Close()
-
-	// Write header with length of 1.
-	err = encoding.NewEncoder(handle).EncodeAll(
-		shareHeader,
-		shareVersion,
-		uint64(1),
-	)
-	if err != nil {
-		return err
-	}
-
-	// Write file.
-	err = f.save(handle)
-	if err != nil {
-		return err
-	}
-
-	// Commit the SafeFile.
-	return handle.Commit()
-}
-
-// save stores the current renter data to disk.
-func (r *Renter) save() error {
-	data := struct {
-		Tracking map[string]trackedFile
-	}{r.tracking}
-	return persist.SaveFile(saveMetadata, data, filepath.Join(r.persistDir, PersistFilename))
-}
-
-// load fetches the saved renter data from disk.
-func (r *Renter) load() error {
-	// Load all files found in renter directory.
-	dir, err := os.Open(r.persistDir) // TODO: store in a subdir?
-	if err != nil {
-		return err
+		return nil, err
 	}
 	defer dir.Close()
 	filenames, err := dir.Readdirnames(-1)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	var legacy []string
 	for _, path := range filenames {
+		if filepath.Ext(path) == ShareExtension || path == PersistFilename {
+			legacy = append(legacy, path)
+		}
+	}
+	return legacy, nil
+}
+
+// migrateLegacy loads the .sia files and renter.json file written by older
+// versions of the renter and copies their contents into the renter database.
+// Once the migration has succeeded, the legacy files are renamed with a .bck
+// suffix so that they are not migrated a second time. If the migration is
+// interrupted, it is repeated on the next startup; files that are already in
+// the database are skipped, so they are not duplicated.
+func (r *Renter) migrateLegacy(legacy []string) error {
+	r.log.Println("Migrating legacy renter files to the renter database")
+	for _, path := range legacy {
 		// Skip non-sia files.
 		if filepath.Ext(path) != ShareExtension {
 			continue
 		}
 		file, err := os.Open(filepath.Join(r.persistDir, path))
 		if err != nil {
-			// maybe just skip?
 			return err
 		}
-		_, err = r.loadSharedFiles(file)
+		files, err := readSharedFiles(file)
 		file.Close() // defer is probably a bad idea
 		if err != nil {
-			// maybe just skip?
 			return err
 		}
+		for _, f := range files {
+			if _, exists := r.files[f.name]; exists {
+				continue
+			}
+			err = r.saveFile(f)
+			if err != nil {
+				return err
+			}
+			r.files[f.name] = f
+		}
 	}
 
-	// Load contracts, repair set, and entropy.
+	// Load the tracking set.
 	data := struct {
 		Tracking  map[string]trackedFile
 		Repairing map[string]string // COMPATv0.4.8
 	}{}
-	err = persist.LoadFile(saveMetadata, &data, filepath.Join(r.persistDir, PersistFilename))
-	if err != nil {
+	err := persist.LoadFile(saveMetadata, &data, filepath.Join(r.persistDir, PersistFilename))
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	if data.Tracking != nil {
-		r.tracking = data.Tracking
-	} else if data.Repairing != nil {
+	tracking := data.Tracking
+	if tracking == nil && data.Repairing != nil {
 		// COMPATv0.4.8
+		tracking = make(map[string]trackedFile)
 		for nick, path := range data.Repairing {
 			// these files will be renewed indefinitely
-			r.tracking[nick] = trackedFile{RepairPath: path, EndHeight: 0}
+			tracking[nick] = trackedFile{RepairPath: path, EndHeight: 0}
 		}
 	}
+	for nick, tf := range tracking {
+		err = r.saveTracking(nick, tf)
+		if err != nil {
+			return err
+		}
+		r.tracking[nick] = tf
+	}
 
+	// Move the legacy files out of the way.
+	for _, path := range legacy {
+		filename := filepath.Join(r.persistDir, path)
+		err = os.Rename(filename, filename+".bck")
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// load fetches the saved renter data from disk, migrating any data stored in
+// the legacy format.
+func (r *Renter) load() error {
+	err := r.loadDB()
+	if err != nil {
+		return err
+	}
+	legacy, err := r.legacyFiles()
+	if err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+	return r.migrateLegacy(legacy)
+}
+
 // shareFiles writes the specified files to w.
 func (r *Renter) shareFiles(nicknames []string, w io.Writer) error {
 	// Write header.
@@ -311,9 +379,8 @@ func (r *Renter) ShareFilesAscii(nicknames []string) (string, error) {
 	return buf.String(), nil
 }
 
-// loadSharedFiles reads .sia data from reader and registers the contained
-// files in the renter. It returns the nicknames of the loaded files.
-func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
+// readSharedFiles reads the files contained in .sia data from reader.
+func readSharedFiles(reader io.Reader) ([]*file, error) {
 	// read header
 	var header [15]byte
 	var version string
@@ -327,7 +394,7 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 		return nil, err
 	} else if header != shareHeader {
 		return nil, ErrBadFile
-	} else if version != shareVersion {
+	} else if version != shareVersion && version != shareVersionNoCipher {
 		return nil, ErrIncompatible
 	}
 
@@ -335,33 +402,48 @@ func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
 	files := make([]*file, numFiles)
 	for i := range files {
 		files[i] = new(file)
-		err := files[i].load(reader)
+		err := files[i].load(reader, version)
 		if err != nil {
 			return nil, err
 		}
+	}
+	return files, nil
+}
 
-		// Make sure the file's name does not conflict with existing files.
+// loadSharedFiles reads .sia data from reader and registers the contained
+// files in the renter. It returns the nicknames of the loaded files.
+func (r *Renter) loadSharedFiles(reader io.Reader) ([]string, error) {
+	files, err := readSharedFiles(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the files' names do not conflict with existing files.
+	for _, f := range files {
 		dupCount := 0
-		origName := files[i].name
+		origName := f.name
 		for {
-			_, exists := r.files[files[i].name]
+			_, exists := r.files[f.name]
 			if !exists {
 				break
 			}
 			dupCount++
-			files[i].name = origName + "_" + strconv.Itoa(dupCount)
+			f.name = origName + "_" + strconv.Itoa(dupCount)
 		}
 	}
 
 	// Add files to renter.
-	names := make([]string, numFiles)
+	names := make([]string, len(files))
 	for i, f := range files {
 		r.files[f.name] = f
 		names[i] = f.name
 	}
 	// Save the files.
 	for _, f := range files {
-		r.saveFile(f)
+		err := r.saveFile(f)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return names, nil
@@ -384,6 +466,12 @@ func (r *Renter) initPersist() error {
 	r.log = log.New(logFile, "", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
 	r.log.Println("STARTUP: Renter has started logging")
 
+	// Open the database.
+	err = r.openDB(filepath.Join(r.persistDir, DatabaseFilename))
+	if err != nil {
+		return err
+	}
+
 	// Load the prior persistance structures.
 	err = r.load()
 	if err != nil && !os.IsNotExist(err) {
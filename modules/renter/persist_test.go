@@ -2,6 +2,7 @@ package renter
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -11,6 +12,8 @@ import (
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
 )
 
 // newTestingFile initializes a file object with random parameters.
@@ -57,7 +60,7 @@ func TestFileSaveLoad(t *testing.T) {
 	savedFile.save(buf)
 
 	loadedFile := new(file)
-	err := loadedFile.load(buf)
+	err := loadedFile.load(buf, shareVersion)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -68,6 +71,107 @@ func TestFileSaveLoad(t *testing.T) {
 	}
 }
 
+// TestFileSaveLoadErasureCoders checks that every registered erasure coder
+// survives a save/load cycle.
+func TestFileSaveLoadErasureCoders(t *testing.T) {
+	rsc, _ := NewRSCode(3, 5)
+	rssc, _ := NewRSSubCode(4, 6)
+	rc, _ := NewReplicationCode(7)
+	for _, code := range []modules.ErasureCoder{rsc, rssc, rc} {
+		savedFile := newTestingFile()
+		savedFile.erasureCode = code
+		buf := new(bytes.Buffer)
+		err := savedFile.save(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loadedFile := new(file)
+		err = loadedFile.load(buf, shareVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved, loaded := code.(persistableCoder), loadedFile.erasureCode.(persistableCoder)
+		if saved.codeName() != loaded.codeName() {
+			t.Fatalf("erasure code types do not match: %v %v", saved.codeName(), loaded.codeName())
+		}
+		if fmt.Sprint(saved.codeParams()) != fmt.Sprint(loaded.codeParams()) {
+			t.Fatalf("erasure code params do not match: %v %v", saved.codeParams(), loaded.codeParams())
+		}
+	}
+}
+
+// TestDecodeErasureCodeBounds checks that erasure codes with too many pieces
+// are rejected when they are loaded.
+func TestDecodeErasureCodeBounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []uint64
+	}{
+		{replicationCodeName, []uint64{1 << 40}},
+		{rsCodeName, []uint64{1 << 62, 1 << 62}},
+		{rsSubCodeName, []uint64{200, 100}},
+	}
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		enc := encoding.NewEncoder(buf)
+		enc.Encode(test.name)
+		for _, p := range test.params {
+			enc.Encode(p)
+		}
+		_, err := decodeErasureCode(encoding.NewDecoder(buf))
+		if err != errTooManyPieces {
+			t.Errorf("%v %v: expected errTooManyPieces, got %v", test.name, test.params, err)
+		}
+	}
+}
+
+// TestFileLoadNoCipher checks that files saved before cipher types were
+// introduced are loaded as Twofish files, and that the cipher type of newer
+// files is preserved.
+func TestFileLoadNoCipher(t *testing.T) {
+	// Write a file in the v0.4 format, which has no cipher type.
+	key, _ := crypto.GenerateTwofishKey()
+	buf := new(bytes.Buffer)
+	zip := gzip.NewWriter(buf)
+	err := encoding.NewEncoder(zip).EncodeAll(
+		"foo", uint64(100), key, uint64(10), uint32(0600), // easy fields
+		uint64(200), uint64(10), // bytesUploaded and chunksUploaded
+		"Reed-Solomon", uint64(1), uint64(1), // erasure code
+		uint64(0), // contracts
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zip.Close()
+
+	f := new(file)
+	err = f.load(buf, shareVersionNoCipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.cipherType != crypto.TypeTwofish {
+		t.Fatal("v0.4 file should be loaded as a Twofish file, got", f.cipherType)
+	}
+	if f.name != "foo" || f.size != 100 || f.masterKey != key {
+		t.Fatal("v0.4 file was not loaded correctly")
+	}
+
+	// Save and load the file using a different cipher.
+	f.cipherType = crypto.TypeXChaCha20
+	err = f.save(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedFile := new(file)
+	err = loadedFile.load(buf, shareVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadedFile.cipherType != crypto.TypeXChaCha20 {
+		t.Fatal("cipher type was not preserved, got", loadedFile.cipherType)
+	}
+}
+
 // TestFileSaveLoadASCII tests the ASCII saving/loading functions.
 func TestFileSaveLoadASCII(t *testing.T) {
 	if testing.Short() {
@@ -150,7 +254,7 @@ func TestRenterSaveLoad(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Corrupt a renter file and try to reload it.
+	// Corrupt a legacy renter file and try to migrate it.
 	err = ioutil.WriteFile(filepath.Join(rt.renter.persistDir, "corrupt"+ShareExtension), []byte{1, 2, 3}, 0660)
 	if err != nil {
 		t.Fatal(err)
@@ -161,3 +265,85 @@ func TestRenterSaveLoad(t *testing.T) {
 		t.Fatal("expected error, got nil")
 	}
 }
+
+// TestRenterMigrateLegacy checks that .sia files and the renter.json file
+// written by older versions of the renter are moved into the renter database.
+func TestRenterMigrateLegacy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestRenterMigrateLegacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+
+	// Write a file in the legacy .sia format, along with a legacy tracking
+	// file.
+	f := newTestingFile()
+	rt.renter.files[f.name] = f
+	siaPath := filepath.Join(rt.renter.persistDir, f.name+ShareExtension)
+	err = rt.renter.ShareFiles([]string{f.name}, siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(rt.renter.files, f.name)
+	tracking := map[string]trackedFile{f.name: {RepairPath: "foo", EndHeight: 10}}
+	data := struct {
+		Tracking map[string]trackedFile
+	}{tracking}
+	err = persist.SaveFile(saveMetadata, data, filepath.Join(rt.renter.persistDir, PersistFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading should migrate the legacy files and move them out of the way.
+	id := rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(siaPath); !os.IsNotExist(err) {
+		t.Fatal("legacy .sia file was not moved:", err)
+	}
+	if _, err := os.Stat(siaPath + ".bck"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload the database contents and check that the file and its tracking
+	// information survived the migration.
+	rt.renter.files = make(map[string]*file)
+	rt.renter.tracking = make(map[string]trackedFile)
+	err = rt.renter.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := equalFiles(f, rt.renter.files[f.name]); err != nil {
+		t.Fatal(err)
+	}
+	if rt.renter.tracking[f.name] != tracking[f.name] {
+		t.Fatal("tracking information was not migrated:", rt.renter.tracking[f.name])
+	}
+
+	// Simulate a migration that was interrupted before the legacy files were
+	// moved. Migrating again should not duplicate the file.
+	err = os.Rename(siaPath+".bck", siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = rt.renter.mu.Lock()
+	err = rt.renter.load()
+	rt.renter.mu.Unlock(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.renter.files = make(map[string]*file)
+	err = rt.renter.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.renter.files) != 1 {
+		t.Fatal("expected 1 file after repeating the migration, got", len(rt.renter.files))
+	}
+}
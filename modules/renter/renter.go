@@ -5,6 +5,7 @@ import (
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
+	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/sync"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -22,10 +23,59 @@ type hostDB interface {
 	// AveragePrice returns the average price of a host.
 	AveragePrice() types.Currency
 
+	// ContractAddress returns the current address of the host that formed
+	// the given contract, which changes if the host announces a new
+	// address.
+	ContractAddress(types.FileContractID) (modules.NetAddress, bool)
+
+	// Host returns detailed information about a known host.
+	Host(modules.NetAddress) (modules.HostDBEntry, error)
+
+	// Hosts returns summary information about every known host.
+	Hosts() []modules.HostDBEntry
+
+	// HostDiversity returns the subnet sizes used to keep the hosts of a
+	// chunk on different networks.
+	HostDiversity() modules.HostDiversity
+
+	// HostFilter returns the host filter mode and the hosts in the filter.
+	HostFilter() (modules.HostFilterMode, []modules.NetAddress)
+
+	// HostMarket returns statistics about the settings of the active hosts,
+	// both current and historical.
+	HostMarket() modules.HostMarket
+
+	// HostScanPolicy returns the policy used to scan hosts.
+	HostScanPolicy() modules.HostScanPolicy
+
+	// HostScore returns a breakdown of the score of a known host.
+	HostScore(modules.NetAddress) (modules.HostScoreBreakdown, error)
+
+	// NewDownloader returns a Downloader, which pays the host that stores
+	// the data of a contract for each download.
+	NewDownloader(types.FileContractID) (hostdb.Downloader, error)
+
 	// NewPool returns a new HostPool, which can negotiate contracts with
 	// hosts. The size and duration of these contracts are supplied as
 	// arguments.
 	NewPool(filesize uint64, duration types.BlockHeight) (hostdb.HostPool, error)
+
+	// RecordDownload records the outcome of a download from a host.
+	RecordDownload(addr modules.NetAddress, success bool)
+
+	// RescanHost schedules an immediate scan of a known host.
+	RescanHost(modules.NetAddress) error
+
+	// SetHostDiversity changes the subnet sizes used to keep the hosts of a
+	// chunk on different networks.
+	SetHostDiversity(modules.HostDiversity) error
+
+	// SetHostFilter changes the host filter mode and the hosts in the
+	// filter.
+	SetHostFilter(mode modules.HostFilterMode, hosts []modules.NetAddress) error
+
+	// SetHostScanPolicy changes the policy used to scan hosts.
+	SetHostScanPolicy(modules.HostScanPolicy) error
 }
 
 // A trackedFile contains metadata about files being tracked by the Renter.
@@ -48,11 +98,14 @@ type Renter struct {
 	wallet modules.Wallet
 
 	// resources
+	db     *persist.BoltDatabase
 	hostDB hostDB
 	log    *log.Logger
 
 	// variables
 	files         map[string]*file
+	versions      map[string][]priorVersion // prior versions, oldest first
+	retention     modules.RetentionPolicy
 	tracking      map[string]trackedFile // map from nickname to metadata
 	downloadQueue []*download
 
@@ -74,8 +127,10 @@ func New(cs modules.ConsensusSet, wallet modules.Wallet, tpool modules.Transacti
 		wallet: wallet,
 		hostDB: hdb,
 
-		files:    make(map[string]*file),
-		tracking: make(map[string]trackedFile),
+		files:     make(map[string]*file),
+		versions:  make(map[string][]priorVersion),
+		retention: defaultRetentionPolicy,
+		tracking:  make(map[string]trackedFile),
 
 		persistDir: persistDir,
 		mu:         sync.New(modules.SafeMutexDelay, 1),
@@ -90,6 +145,13 @@ func New(cs modules.ConsensusSet, wallet modules.Wallet, tpool modules.Transacti
 	return r, nil
 }
 
+// Close closes the renter database.
+func (r *Renter) Close() error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	return r.db.Close()
+}
+
 // Info returns generic information about the renter and the files that are
 // being rented.
 func (r *Renter) Info() (ri modules.RentInfo) {
@@ -116,6 +178,31 @@ func (r *Renter) Info() (ri modules.RentInfo) {
 // hostdb passthroughs
 func (r *Renter) ActiveHosts() []modules.HostSettings { return r.hostDB.ActiveHosts() }
 func (r *Renter) AllHosts() []modules.HostSettings    { return r.hostDB.AllHosts() }
+func (r *Renter) Host(addr modules.NetAddress) (modules.HostDBEntry, error) {
+	return r.hostDB.Host(addr)
+}
+func (r *Renter) Hosts() []modules.HostDBEntry { return r.hostDB.Hosts() }
+func (r *Renter) RescanHost(addr modules.NetAddress) error {
+	return r.hostDB.RescanHost(addr)
+}
+func (r *Renter) HostDiversity() modules.HostDiversity { return r.hostDB.HostDiversity() }
+func (r *Renter) SetHostDiversity(hd modules.HostDiversity) error {
+	return r.hostDB.SetHostDiversity(hd)
+}
+func (r *Renter) HostMarket() modules.HostMarket         { return r.hostDB.HostMarket() }
+func (r *Renter) HostScanPolicy() modules.HostScanPolicy { return r.hostDB.HostScanPolicy() }
+func (r *Renter) SetHostScanPolicy(sp modules.HostScanPolicy) error {
+	return r.hostDB.SetHostScanPolicy(sp)
+}
+func (r *Renter) HostFilter() (modules.HostFilterMode, []modules.NetAddress) {
+	return r.hostDB.HostFilter()
+}
+func (r *Renter) HostScore(addr modules.NetAddress) (modules.HostScoreBreakdown, error) {
+	return r.hostDB.HostScore(addr)
+}
+func (r *Renter) SetHostFilter(mode modules.HostFilterMode, hosts []modules.NetAddress) error {
+	return r.hostDB.SetHostFilter(mode, hosts)
+}
 
 // enforce that Renter satisfies the modules.Renter interface
 var _ modules.Renter = (*Renter)(nil)
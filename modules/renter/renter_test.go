@@ -29,6 +29,7 @@ type renterTester struct {
 // Close shuts down the renter tester.
 func (rt *renterTester) Close() error {
 	rt.wallet.Lock()
+	rt.renter.Close()
 	rt.cs.Close()
 	rt.gateway.Close()
 	return nil
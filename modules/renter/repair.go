@@ -8,6 +8,7 @@ import (
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/renter/hostdb"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 const (
@@ -19,24 +20,27 @@ const (
 )
 
 // repair attempts to repair a file chunk by uploading its pieces to more
-// hosts.
-func (f *file) repair(chunkIndex uint64, missingPieces []uint64, r io.ReaderAt, hosts []hostdb.Uploader) error {
+// hosts. It returns the IDs of the contracts that received new pieces.
+func (f *file) repair(chunkIndex uint64, missingPieces []uint64, r io.ReaderAt, hosts []hostdb.Uploader) ([]types.FileContractID, error) {
 	// read chunk data and encode
 	chunk := make([]byte, f.chunkSize())
 	_, err := r.ReadAt(chunk, int64(chunkIndex*f.chunkSize()))
 	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-		return err
+		return nil, err
 	}
 	pieces, err := f.erasureCode.Encode(chunk)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// encrypt pieces
 	for i := range pieces {
-		key := deriveKey(f.masterKey, chunkIndex, uint64(i))
+		key, err := deriveKey(f.cipherType, f.masterKey, chunkIndex, uint64(i))
+		if err != nil {
+			return nil, err
+		}
 		pieces[i], err = key.EncryptBytes(pieces[i])
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -45,6 +49,7 @@ func (f *file) repair(chunkIndex uint64, missingPieces []uint64, r io.ReaderAt,
 	if len(hosts) < numPieces {
 		numPieces = len(hosts)
 	}
+	var updated []types.FileContractID
 	var wg sync.WaitGroup
 	wg.Add(numPieces)
 	for i := 0; i < numPieces; i++ {
@@ -74,11 +79,12 @@ func (f *file) repair(chunkIndex uint64, missingPieces []uint64, r io.ReaderAt,
 				Offset: offset,
 			})
 			f.contracts[host.ContractID()] = contract
+			updated = append(updated, host.ContractID())
 		}(hosts[i], uint64(i), pieces[missingPieces[i]])
 	}
 	wg.Wait()
 
-	return nil
+	return updated, nil
 }
 
 // threadedRepairLoop improves the health of files tracked by the renter by
@@ -103,6 +109,9 @@ func (r *Renter) threadedRepairLoop() {
 		for name, meta := range repairing {
 			r.threadedRepairFile(name, meta)
 		}
+
+		// prune prior versions that have outlived the retention policy
+		r.pruneAllVersions()
 	}
 }
 
@@ -133,8 +142,9 @@ func (f *file) incompleteChunks() map[uint64][]uint64 {
 	return incomplete
 }
 
-// chunkHosts returns the hosts storing the given chunk.
-func (f *file) chunkHosts(chunk uint64) []modules.NetAddress {
+// chunkHosts returns the hosts storing the given chunk of f. Hosts that have
+// announced a new address are reported at their new address.
+func (r *Renter) chunkHosts(f *file, chunk uint64) []modules.NetAddress {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
@@ -142,7 +152,11 @@ func (f *file) chunkHosts(chunk uint64) []modules.NetAddress {
 	for _, fc := range f.contracts {
 		for _, p := range fc.Pieces {
 			if p.Chunk == chunk {
-				old = append(old, fc.IP)
+				addr, ok := r.hostDB.ContractAddress(fc.ID)
+				if !ok {
+					addr = fc.IP
+				}
+				old = append(old, addr)
 				break
 			}
 		}
@@ -158,6 +172,9 @@ func (r *Renter) threadedRepairFile(name string, meta trackedFile) {
 		id := r.mu.Lock()
 		delete(r.tracking, name)
 		r.mu.Unlock(id)
+		if err := r.deleteTracking(name); err != nil {
+			r.log.Printf("failed to remove %v from the renter database: %v", name, err)
+		}
 	}
 
 	id := r.mu.RLock()
@@ -200,24 +217,40 @@ func (r *Renter) threadedRepairFile(name string, meta trackedFile) {
 	}
 	defer pool.Close() // heh
 
+	var updated []types.FileContractID
 	for chunk, pieces := range badChunks {
 		// determine host set
-		old := f.chunkHosts(chunk)
+		old := r.chunkHosts(f, chunk)
 		hosts := pool.UniqueHosts(f.erasureCode.NumPieces()-len(old), old)
 		if len(hosts) == 0 {
 			r.log.Printf("aborting repair of %v: not enough hosts", name)
 			break
 		}
 		// upload to new hosts
-		err = f.repair(chunk, pieces, handle, hosts)
+		ids, err := f.repair(chunk, pieces, handle, hosts)
+		updated = append(updated, ids...)
 		if err != nil {
 			r.log.Printf("aborting repair of %v: %v", name, err)
 			break
 		}
 	}
 
-	// save the repaired file data
-	err = r.saveFile(f)
+	// save the contracts that received new pieces. If a new version was
+	// uploaded during the repair, f is now a prior version and is saved as
+	// one. The lock prevents f from being replaced or pruned while it is
+	// saved.
+	id = r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	if v, err := r.findVersion(name, f.version); err != nil || v != f {
+		r.log.Printf("%v was removed during repair", name)
+		return
+	}
+	if r.files[name] == f {
+		err = r.saveContracts(f, updated)
+	} else {
+		r.log.Printf("%v was replaced by a new version during repair", name)
+		err = r.saveVersionContracts(f, updated)
+	}
 	if err != nil {
 		// definitely bad, but we probably shouldn't delete from the
 		// repair set if this happens
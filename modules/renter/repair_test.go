@@ -40,7 +40,7 @@ func TestRepair(t *testing.T) {
 	f := newFile("foo", rsc, pieceSize, dataSize)
 	r := bytes.NewReader(data)
 	for chunk, pieces := range f.incompleteChunks() {
-		err = f.repair(chunk, pieces, r, hosts)
+		_, err = f.repair(chunk, pieces, r, hosts)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -55,7 +55,7 @@ func TestRepair(t *testing.T) {
 	const maxAttempts = 20
 	for i := 0; i < maxAttempts; i++ {
 		for chunk, pieces := range f.incompleteChunks() {
-			err = f.repair(chunk, pieces, r, hosts)
+			_, err = f.repair(chunk, pieces, r, hosts)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -15,11 +15,18 @@ const (
 	defaultParityPieces = 8    // Parity pieces per erasure-coded chunk
 
 	// piece sizes
-	// NOTE: The encryption overhead is subtracted so that encrypted piece
-	// will always be a multiple of 64 (i.e. crypto.SegmentSize). Without this
-	// property, revisions break the file's Merkle root.
-	defaultPieceSize = 1<<22 - crypto.TwofishOverhead // 4 MiB
-	smallPieceSize   = 1<<16 - crypto.TwofishOverhead // 64 KiB
+	// NOTE: The encryption overhead of the file's cipher is subtracted from
+	// these sizes so that encrypted pieces will always be a multiple of 64
+	// (i.e. crypto.SegmentSize). Without this property, revisions break the
+	// file's Merkle root.
+	defaultPieceSize = 1 << 22 // 4 MiB
+	smallPieceSize   = 1 << 16 // 64 KiB
+)
+
+var (
+	// defaultCipherType is the cipher used to encrypt uploads that do not
+	// specify a cipher type.
+	defaultCipherType = crypto.TypeTwofish
 )
 
 // checkWalletBalance looks at an upload and determines if there is enough
@@ -45,16 +52,11 @@ func (r *Renter) checkWalletBalance(up modules.FileUploadParams) error {
 }
 
 // Upload instructs the renter to start tracking a file. The renter will
-// automatically upload and repair tracked files using a background loop.
+// automatically upload and repair tracked files using a background loop. If a
+// file with the same nickname already exists, the upload becomes the newest
+// version of that file, and the chunks that did not change are not uploaded
+// again.
 func (r *Renter) Upload(up modules.FileUploadParams) error {
-	// Check for a nickname conflict.
-	lockID := r.mu.RLock()
-	_, exists := r.files[up.Nickname]
-	r.mu.RUnlock(lockID)
-	if exists {
-		return errors.New("file with that nickname already exists")
-	}
-
 	// Fill in any missing upload params with sensible defaults.
 	fileInfo, err := os.Stat(up.Filename)
 	if err != nil {
@@ -65,13 +67,22 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 		up.Duration = defaultDuration
 	}
 	if up.ErasureCode == nil {
-		up.ErasureCode, _ = NewRSCode(defaultDataPieces, defaultParityPieces)
+		up.ErasureCode, err = newErasureCoder(up.ErasureCodeType, up.DataPieces, up.ParityPieces)
+		if err != nil {
+			return err
+		}
+	}
+	if up.CipherType == (crypto.CipherType{}) {
+		up.CipherType = defaultCipherType
+	}
+	if _, err := up.CipherType.NewKey(crypto.TwofishKey{}); err != nil {
+		return err
 	}
 	if up.PieceSize == 0 {
 		if fileInfo.Size() > defaultPieceSize {
-			up.PieceSize = defaultPieceSize
+			up.PieceSize = defaultPieceSize - up.CipherType.Overhead()
 		} else {
-			up.PieceSize = smallPieceSize
+			up.PieceSize = smallPieceSize - up.CipherType.Overhead()
 		}
 	}
 
@@ -84,22 +95,45 @@ func (r *Renter) Upload(up modules.FileUploadParams) error {
 	// Create file object.
 	f := newFile(up.Nickname, up.ErasureCode, up.PieceSize, uint64(fileInfo.Size()))
 	f.mode = uint32(fileInfo.Mode())
+	f.cipherType = up.CipherType
+	f.chunkHashes, err = hashFileChunks(up.Filename, f.chunkSize())
+	if err != nil {
+		return err
+	}
 
-	// Add file to renter.
-	lockID = r.mu.Lock()
-	r.files[up.Nickname] = f
-	r.tracking[up.Nickname] = trackedFile{
+	// Add file to renter, replacing the current version if one exists.
+	height := r.cs.Height()
+	tf := trackedFile{
 		RepairPath: up.Filename,
-		EndHeight:  r.cs.Height() + up.Duration,
+		EndHeight:  height + up.Duration,
 	}
-	r.save()
-	r.mu.Unlock(lockID)
-
-	// Save the .sia file to the renter directory.
-	err = r.saveFile(f)
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+	prev, exists := r.files[up.Nickname]
+	if exists {
+		f.version = prev.version + 1
+		if f.canReuse(prev) {
+			f.masterKey = prev.masterKey
+			reused := f.reusePieces(prev)
+			r.log.Printf("version %v of %v reuses %v of %v chunks", f.version, f.name, reused, len(f.chunkHashes))
+		}
+		pv := priorVersion{file: prev, replacedHeight: height}
+		err = r.replaceFile(pv, f)
+		if err != nil {
+			return err
+		}
+		r.versions[up.Nickname] = append(r.versions[up.Nickname], pv)
+	} else {
+		err = r.saveFile(f)
+		if err != nil {
+			return err
+		}
+	}
+	r.files[up.Nickname] = f
+	r.tracking[up.Nickname] = tf
+	err = r.saveTracking(up.Nickname, tf)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return r.pruneVersions(up.Nickname, height)
 }
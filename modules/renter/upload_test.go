@@ -59,6 +59,21 @@ func TestErasureUpload(t *testing.T) {
 	if testing.Short() {
 		t.SkipNow()
 	}
+	testErasureUpload(t, defaultCipherType)
+}
+
+// TestErasureUploadXChaCha20 tests parallel uploading of erasure-coded data
+// encrypted with XChaCha20-Poly1305.
+func TestErasureUploadXChaCha20(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	testErasureUpload(t, crypto.TypeXChaCha20)
+}
+
+// testErasureUpload uploads erasure-coded data encrypted with cipherType to
+// unreliable hosts, and checks that it can be recovered.
+func testErasureUpload(t *testing.T, cipherType crypto.CipherType) {
 
 	// generate data
 	const dataSize = 777
@@ -88,9 +103,10 @@ func TestErasureUpload(t *testing.T) {
 
 	// upload data to hosts
 	f := newFile("foo", rsc, pieceSize, dataSize)
+	f.cipherType = cipherType
 	r := bytes.NewReader(data)
 	for chunk, pieces := range f.incompleteChunks() {
-		err = f.repair(chunk, pieces, r, hosts)
+		_, err = f.repair(chunk, pieces, r, hosts)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -107,8 +123,12 @@ func TestErasureUpload(t *testing.T) {
 			continue
 		}
 		for _, p := range contract.Pieces {
-			encPiece := h.(*testHost).data[p.Offset : p.Offset+pieceSize+crypto.TwofishOverhead]
-			piece, err := deriveKey(f.masterKey, p.Chunk, p.Piece).DecryptBytes(encPiece)
+			encPiece := h.(*testHost).data[p.Offset : p.Offset+pieceSize+f.cipherType.Overhead()]
+			key, err := deriveKey(f.cipherType, f.masterKey, p.Chunk, p.Piece)
+			if err != nil {
+				t.Fatal(err)
+			}
+			piece, err := key.DecryptBytes(encPiece)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -0,0 +1,235 @@
+package renter
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	ErrUnknownVersion = errors.New("no version of that file with the given version number")
+
+	// defaultRetentionPolicy keeps the ten most recent prior versions of each
+	// file, regardless of their age.
+	defaultRetentionPolicy = modules.RetentionPolicy{
+		Versions: 10,
+	}
+)
+
+// A priorVersion is a version of a file that has been replaced by a newer
+// upload using the same nickname. Prior versions are not repaired, but can be
+// listed and downloaded until they are pruned by the retention policy.
+type priorVersion struct {
+	file           *file
+	replacedHeight types.BlockHeight
+}
+
+// hashChunks returns the hash of each chunk of the data read from r. The final
+// chunk is hashed without padding.
+func hashChunks(r io.Reader, chunkSize uint64) ([]crypto.Hash, error) {
+	var hashes []crypto.Hash
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		hashes = append(hashes, crypto.HashBytes(buf[:n]))
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+	return hashes, nil
+}
+
+// hashFileChunks returns the chunk hashes of the file at path.
+func hashFileChunks(path string, chunkSize uint64) ([]crypto.Hash, error) {
+	handle, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+	return hashChunks(handle, chunkSize)
+}
+
+// canReuse reports whether the pieces of prev can be reused by f. Pieces are
+// only interchangeable if both versions split, encode, and encrypt their
+// chunks identically.
+func (f *file) canReuse(prev *file) bool {
+	if prev.chunkHashes == nil || f.pieceSize != prev.pieceSize || f.cipherType != prev.cipherType {
+		return false
+	}
+	fc, ok1 := f.erasureCode.(persistableCoder)
+	pc, ok2 := prev.erasureCode.(persistableCoder)
+	if !ok1 || !ok2 || fc.codeName() != pc.codeName() {
+		return false
+	}
+	fp, pp := fc.codeParams(), pc.codeParams()
+	if len(fp) != len(pp) {
+		return false
+	}
+	for i := range fp {
+		if fp[i] != pp[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// reusePieces adds the pieces of prev that belong to unchanged chunks to f, so
+// that they do not need to be uploaded again. f must use the same master key
+// as prev. The number of reused chunks is returned.
+func (f *file) reusePieces(prev *file) int {
+	prev.mu.RLock()
+	defer prev.mu.RUnlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	unchanged := make(map[uint64]bool)
+	for i := range f.chunkHashes {
+		if i < len(prev.chunkHashes) && f.chunkHashes[i] == prev.chunkHashes[i] {
+			unchanged[uint64(i)] = true
+		}
+	}
+	for id, fc := range prev.contracts {
+		var pieces []pieceData
+		for _, p := range fc.Pieces {
+			if unchanged[p.Chunk] {
+				pieces = append(pieces, p)
+			}
+		}
+		if len(pieces) == 0 {
+			continue
+		}
+		fc.Pieces = pieces
+		f.contracts[id] = fc
+	}
+	return len(unchanged)
+}
+
+// versionInfo returns information about a version of a file.
+func (f *file) versionInfo() modules.FileVersionInfo {
+	return modules.FileVersionInfo{
+		Nickname:       f.name,
+		Version:        f.version,
+		Filesize:       f.size,
+		Available:      f.available(),
+		UploadProgress: f.uploadProgress(),
+		Expiration:     f.expiration(),
+	}
+}
+
+// pruneVersions removes the prior versions of a file that are no longer
+// permitted by the retention policy. Only the renter's record of the pruned
+// versions is removed: hosts have no RPC for deleting data, so the pieces of a
+// pruned version stay on their hosts, and keep counting against the contract's
+// storage, until the contract expires. pruneVersions must be called under
+// lock.
+func (r *Renter) pruneVersions(nickname string, height types.BlockHeight) error {
+	versions := r.versions[nickname]
+	var keep []priorVersion
+	var pruned []*file
+	for i, pv := range versions {
+		tooMany := r.retention.Versions != 0 && uint64(len(versions)-i) > r.retention.Versions
+		tooOld := r.retention.Blocks != 0 && height >= pv.replacedHeight+r.retention.Blocks
+		if tooMany || tooOld {
+			pruned = append(pruned, pv.file)
+		} else {
+			keep = append(keep, pv)
+		}
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+
+	var prunedVersions []uint64
+	for _, f := range pruned {
+		prunedVersions = append(prunedVersions, f.version)
+	}
+	if len(keep) == 0 {
+		delete(r.versions, nickname)
+	} else {
+		r.versions[nickname] = keep
+	}
+	return r.deleteVersions(nickname, prunedVersions)
+}
+
+// pruneAllVersions applies the retention policy to the prior versions of
+// every file.
+func (r *Renter) pruneAllVersions() {
+	height := r.cs.Height()
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	for nickname := range r.versions {
+		if err := r.pruneVersions(nickname, height); err != nil {
+			r.log.Printf("failed to prune versions of %v: %v", nickname, err)
+		}
+	}
+}
+
+// findVersion returns the requested version of a file, which may be either
+// the current version or a prior version. findVersion must be called under
+// lock.
+func (r *Renter) findVersion(nickname string, version uint64) (*file, error) {
+	f, exists := r.files[nickname]
+	if !exists {
+		return nil, ErrUnknownNickname
+	}
+	if f.version == version {
+		return f, nil
+	}
+	for _, pv := range r.versions[nickname] {
+		if pv.file.version == version {
+			return pv.file, nil
+		}
+	}
+	return nil, ErrUnknownVersion
+}
+
+// FileVersions returns information about every version of a file, ordered from
+// oldest to newest.
+func (r *Renter) FileVersions(nickname string) ([]modules.FileVersionInfo, error) {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+
+	f, exists := r.files[nickname]
+	if !exists {
+		return nil, ErrUnknownNickname
+	}
+	var infos []modules.FileVersionInfo
+	for _, pv := range r.versions[nickname] {
+		info := pv.file.versionInfo()
+		info.ReplacedHeight = pv.replacedHeight
+		infos = append(infos, info)
+	}
+	info := f.versionInfo()
+	info.Current = true
+	return append(infos, info), nil
+}
+
+// RetentionPolicy returns the policy used to prune prior file versions.
+func (r *Renter) RetentionPolicy() modules.RetentionPolicy {
+	lockID := r.mu.RLock()
+	defer r.mu.RUnlock(lockID)
+	return r.retention
+}
+
+// SetRetentionPolicy changes the policy used to prune prior file versions.
+// Versions that are not permitted by the new policy are pruned immediately.
+func (r *Renter) SetRetentionPolicy(rp modules.RetentionPolicy) error {
+	lockID := r.mu.Lock()
+	r.retention = rp
+	err := r.saveRetentionPolicy(rp)
+	r.mu.Unlock(lockID)
+	if err != nil {
+		return err
+	}
+	r.pruneAllVersions()
+	return nil
+}
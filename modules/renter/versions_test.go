@@ -0,0 +1,158 @@
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestHashChunks checks that hashChunks hashes each chunk, including a
+// partial final chunk.
+func TestHashChunks(t *testing.T) {
+	data, _ := crypto.RandBytes(250)
+	hashes, err := hashChunks(bytes.NewReader(data), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 {
+		t.Fatal("expected 3 hashes, got", len(hashes))
+	}
+	if hashes[2] != crypto.HashBytes(data[200:]) {
+		t.Fatal("final chunk hashed incorrectly")
+	}
+	hashes, err = hashChunks(bytes.NewReader(data[:200]), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 2 {
+		t.Fatal("expected 2 hashes, got", len(hashes))
+	}
+}
+
+// TestFileVersions uploads several versions of a file and checks that
+// unchanged chunks are reused, that versions survive a reload, and that the
+// retention policy prunes old versions.
+func TestFileVersions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	rt, err := newRenterTester("TestFileVersions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Close()
+	r := rt.renter
+
+	// Upload the first version of a file spanning several chunks.
+	source := filepath.Join(r.persistDir, "source")
+	data, _ := crypto.RandBytes(300e3)
+	err = ioutil.WriteFile(source, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := modules.FileUploadParams{Filename: source, Nickname: "foo"}
+	err = r.Upload(up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v0 := r.files["foo"]
+	if len(v0.chunkHashes) != int(v0.numChunks()) {
+		t.Fatal("wrong number of chunk hashes:", len(v0.chunkHashes))
+	}
+
+	// Pretend that every chunk has been uploaded to a host.
+	fc := fileContract{ID: types.FileContractID{1}, IP: "foo:1234"}
+	for chunk := uint64(0); chunk < v0.numChunks(); chunk++ {
+		fc.Pieces = append(fc.Pieces, pieceData{Chunk: chunk, Piece: 0, Offset: chunk * v0.pieceSize})
+	}
+	v0.contracts[fc.ID] = fc
+
+	// Change the last chunk and upload a second version.
+	data[len(data)-1]++
+	err = ioutil.WriteFile(source, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Upload(up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := r.files["foo"]
+	if v1.version != 1 {
+		t.Fatal("expected version 1, got", v1.version)
+	}
+	if v1.masterKey != v0.masterKey {
+		t.Fatal("new version does not reuse the master key")
+	}
+	if pieces := v1.contracts[fc.ID].Pieces; uint64(len(pieces)) != v0.numChunks()-1 {
+		t.Fatal("expected all but the last chunk to be reused, got", len(pieces))
+	}
+	infos, err := r.FileVersions("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Version != 0 || infos[0].Current || !infos[1].Current {
+		t.Fatal("bad version info:", infos)
+	}
+
+	// Versions should survive a reload of the database.
+	r.files = make(map[string]*file)
+	r.versions = make(map[string][]priorVersion)
+	err = r.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.versions["foo"]) != 1 {
+		t.Fatal("expected 1 prior version after reload, got", len(r.versions["foo"]))
+	}
+	if err := equalFiles(v0, r.versions["foo"][0].file); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep only one prior version; uploading a third version should prune
+	// the first.
+	err = r.SetRetentionPolicy(modules.RetentionPolicy{Versions: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Upload(up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err = r.FileVersions("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Version != 1 || infos[1].Version != 2 {
+		t.Fatal("bad version info after pruning:", infos)
+	}
+	if _, err := r.findVersion("foo", 0); err != ErrUnknownVersion {
+		t.Fatal("expected ErrUnknownVersion, got", err)
+	}
+
+	err = r.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.versions["foo"]) != 1 || r.versions["foo"][0].file.version != 1 {
+		t.Fatal("pruned version survived a reload")
+	}
+
+	// Deleting the file removes every version.
+	err = r.DeleteFile("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.loadDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.versions["foo"]) != 0 {
+		t.Fatal("versions remain after deleting file")
+	}
+}
@@ -3,10 +3,15 @@ package main
 import (
 	"fmt"
 	"math/big"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/NebulousLabs/Sia/api"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 var (
@@ -29,7 +34,9 @@ Available settings:
 	maxduration
 	windowsize
 	price (in SC per GB per month)
-	collateral`,
+	downloadprice (in SC per GB)
+	collateral (in SC per GB per month)
+	collateralbudget (in SC)`,
 		Run: wrap(hostconfigcmd),
 	}
 
@@ -43,6 +50,120 @@ Doing so will override the standard connectivity checks.`,
 		Run: hostannouncecmd,
 	}
 
+	hostConnectionsCmd = &cobra.Command{
+		Use:   "connections",
+		Short: "View the host's connection limits",
+		Long:  "View the host's limits on incoming connections and RPCs, and how many connections and RPCs it has rejected.",
+		Run:   wrap(hostconnectionscmd),
+	}
+
+	hostConnectionsSetCmd = &cobra.Command{
+		Use:   "set [limit] [value]",
+		Short: "Change a connection limit",
+		Long: `Change one of the host's connection limits. A value of 0 means no limit.
+Available limits:
+	maxconnections      (connections served at once)
+	maxconnectionsperip (connections served at once from one IP address)
+	maxrpcsperminute    (calls of each RPC per minute from one IP address)`,
+		Run: wrap(hostconnectionssetcmd),
+	}
+
+	hostContractsCmd = &cobra.Command{
+		Use:   "contracts [status]",
+		Short: "View the host's file contracts",
+		Long: `List the file contracts that the host must submit storage proofs for.
+You may supply a status to only list contracts with that status:
+	active    (the proof window has not opened)
+	proving   (the proof window is open)
+	submitted (the storage proof is waiting to be confirmed)
+	confirmed (the storage proof is in the blockchain)
+	expired   (the proof window has closed)`,
+		Run: hostcontractscmd,
+	}
+
+	hostFinancialsCmd = &cobra.Command{
+		Use:   "financials",
+		Short: "View the host's revenue",
+		Long:  "View the host's potential revenue, and the revenue it realized and lost in each 30 day accounting period.",
+		Run:   wrap(hostfinancialscmd),
+	}
+
+	hostFolderCmd = &cobra.Command{
+		Use:   "folder",
+		Short: "View the host's storage folders",
+		Long:  "List the folders in which the host stores contract data, along with their capacity and usage.",
+		Run:   wrap(hostfoldercmd),
+	}
+
+	hostFolderAddCmd = &cobra.Command{
+		Use:   "add [path] [size]",
+		Short: "Add a storage folder to the host",
+		Long: `Add a folder in which the host may store up to [size] of contract data, e.g.:
+	siac host folder add /mnt/disk2/sia 2TB
+The folder is created if it does not exist.`,
+		Run: wrap(hostfolderaddcmd),
+	}
+
+	hostFolderRemoveCmd = &cobra.Command{
+		Use:   "remove [path]",
+		Short: "Remove a storage folder from the host",
+		Long:  "Move the contract data in a storage folder to the host's other folders, and stop using the folder.",
+		Run:   wrap(hostfolderremovecmd),
+	}
+
+	hostFolderResizeCmd = &cobra.Command{
+		Use:   "resize [path] [size]",
+		Short: "Resize a storage folder",
+		Long:  "Change the amount of contract data that the host may store in a storage folder.",
+		Run:   wrap(hostfolderresizecmd),
+	}
+
+	hostMaintenanceCmd = &cobra.Command{
+		Use:   "maintenance [on|off]",
+		Short: "Stop or resume accepting new contracts",
+		Long: `Put the host in or take it out of maintenance mode.
+In maintenance mode the host rejects new file contracts, but continues to
+revise existing contracts, serve downloads, and submit storage proofs.`,
+		Run: wrap(hostmaintenancecmd),
+	}
+
+	hostPricingCmd = &cobra.Command{
+		Use:   "pricing",
+		Short: "View the host's pricing policy",
+		Long:  "View the bounds between which the host adjusts its storage price, and its current price.",
+		Run:   wrap(hostpricingcmd),
+	}
+
+	hostPricingEnableCmd = &cobra.Command{
+		Use:   "enable [minprice] [maxprice]",
+		Short: "Adjust the storage price automatically",
+		Long: `Adjust the host's storage price automatically between two bounds, in SC per GB per month, e.g.:
+	siac host pricing enable 100 400
+The price rises as the host's storage fills up and as demand for new contracts grows.`,
+		Run: wrap(hostpricingenablecmd),
+	}
+
+	hostPricingDisableCmd = &cobra.Command{
+		Use:   "disable",
+		Short: "Stop adjusting the storage price",
+		Long:  "Stop adjusting the host's storage price automatically. The host keeps its current price.",
+		Run:   wrap(hostpricingdisablecmd),
+	}
+
+	hostScrubCmd = &cobra.Command{
+		Use:   "scrub",
+		Short: "View the integrity of the host's contract data",
+		Long:  "View the results of the host's last check of its contract data, including the contracts whose data is corrupt.",
+		Run:   wrap(hostscrubcmd),
+	}
+
+	hostScrubStartCmd = &cobra.Command{
+		Use:   "start",
+		Short: "Check the integrity of the host's contract data",
+		Long:  "Start checking that the host's contract data matches the Merkle roots in its file contracts. The host also does this once a day.",
+		Run:   wrap(hostscrubstartcmd),
+	}
+
 	hostStatusCmd = &cobra.Command{
 		Use:   "status",
 		Short: "View host settings",
@@ -52,16 +173,36 @@ Doing so will override the standard connectivity checks.`,
 )
 
 func hostconfigcmd(param, value string) {
-	// convert price to hastings/byte/block
-	if param == "price" {
+	// convert price and collateral to hastings/byte/block
+	if param == "price" || param == "collateral" {
 		p, ok := new(big.Rat).SetString(value)
 		if !ok {
-			fmt.Println("could not parse price")
+			fmt.Println("could not parse " + param)
 			return
 		}
 		p.Mul(p, big.NewRat(1e24/1e9, 4320))
 		value = new(big.Int).Div(p.Num(), p.Denom()).String()
 	}
+	// convert download price to hastings/byte
+	if param == "downloadprice" {
+		p, ok := new(big.Rat).SetString(value)
+		if !ok {
+			fmt.Println("could not parse download price")
+			return
+		}
+		p.Mul(p, big.NewRat(1e24/1e9, 1))
+		value = new(big.Int).Div(p.Num(), p.Denom()).String()
+	}
+	// convert collateral budget to hastings
+	if param == "collateralbudget" {
+		p, ok := new(big.Rat).SetString(value)
+		if !ok {
+			fmt.Println("could not parse collateral budget")
+			return
+		}
+		p.Mul(p, new(big.Rat).SetInt(types.SiacoinPrecision.Big()))
+		value = new(big.Int).Div(p.Num(), p.Denom()).String()
+	}
 	// parse sizes of form 10GB, 10TB, 1TiB etc
 	if param == "totalstorage" || param == "minfilesize" || param == "maxfilesize" {
 		var err error // must be pre-declared because value is
@@ -106,12 +247,303 @@ func hoststatuscmd() {
 	// convert price to SC/GB/mo
 	price := new(big.Rat).SetInt(hg.Price.Big())
 	price.Mul(price, big.NewRat(4320, 1e24/1e9))
+	// convert download price to SC/GB
+	downloadPrice := new(big.Rat).SetInt(hg.DownloadPrice.Big())
+	downloadPrice.Mul(downloadPrice, big.NewRat(1, 1e24/1e9))
+	// convert collateral to SC/GB/mo
+	collateral := new(big.Rat).SetInt(hg.Collateral.Big())
+	collateral.Mul(collateral, big.NewRat(4320, 1e24/1e9))
 	fmt.Printf(`Host settings:
-Storage:      %v (%v used)
-Price:        %v SC per GB per month
-Collateral:   %v
-Max Duration: %v
-Contracts:    %v
+Storage:        %v (%v used)
+Price:          %v SC per GB per month
+Download Price: %v SC per GB
+Collateral:     %v SC per GB per month (%v of %v SC locked)
+Max Duration:   %v
+Contracts:      %v
 `, filesizeUnits(hg.TotalStorage), filesizeUnits(hg.TotalStorage-hg.StorageRemaining),
-		price.FloatString(3), hg.Collateral, hg.MaxDuration, hg.NumContracts)
+		price.FloatString(3), downloadPrice.FloatString(3), collateral.FloatString(3),
+		hg.LockedCollateral.Div(types.SiacoinPrecision), hg.CollateralBudget.Div(types.SiacoinPrecision), hg.MaxDuration, hg.NumContracts)
+	if hg.Maintenance {
+		fmt.Println("The host is in maintenance mode and is not accepting new contracts.")
+	}
+}
+
+func hostconnectionscmd() {
+	var hcg api.HostConnectionsGET
+	err := getAPI("/host/connections", &hcg)
+	if err != nil {
+		fmt.Println("Could not fetch connection limits:", err)
+		return
+	}
+	limit := func(n int) string {
+		if n == 0 {
+			return "unlimited"
+		}
+		return fmt.Sprint(n)
+	}
+	fmt.Printf(`Limits:
+	Connections:        %v
+	Connections per IP: %v
+	RPCs per minute:    %v
+Active Connections:     %v
+Rejected Connections:   %v (%v over the per IP limit)
+Rate Limited RPCs:      %v
+`, limit(hcg.Limits.MaxConnections), limit(hcg.Limits.MaxConnectionsPerIP), limit(hcg.Limits.MaxRPCsPerMinute),
+		hcg.Metrics.ActiveConnections, hcg.Metrics.RejectedConnections+hcg.Metrics.RejectedIPConnections,
+		hcg.Metrics.RejectedIPConnections, hcg.Metrics.RateLimitedRPCs)
+}
+
+func hostconnectionssetcmd(limit, value string) {
+	err := post("/host/connections", limit+"="+value)
+	if err != nil {
+		fmt.Println("Could not set connection limit:", err)
+		return
+	}
+	fmt.Println("Connection limit updated.")
+}
+
+func hostcontractscmd(cmd *cobra.Command, args []string) {
+	var contracts api.HostContractsGET
+	var err error
+	switch len(args) {
+	case 0:
+		err = getAPI("/host/contracts", &contracts)
+	case 1:
+		err = getAPI("/host/contracts?status="+url.QueryEscape(args[0]), &contracts)
+	default:
+		cmd.Usage()
+		return
+	}
+	if err != nil {
+		fmt.Println("Could not fetch contracts:", err)
+		return
+	}
+	if len(contracts.Contracts) == 0 {
+		fmt.Println("No contracts.")
+		return
+	}
+	for _, c := range contracts.Contracts {
+		fmt.Printf(`%v
+	Size:     %v (revision %v)
+	Payout:   %v SC
+	Window:   %v - %v (%v)
+	Folders:  %v
+`, c.ID, filesizeUnits(int64(c.FileSize)), c.RevisionNumber, c.Payout.Div(types.SiacoinPrecision),
+			c.WindowStart, c.WindowEnd, c.ProofStatus, strings.Join(c.StorageFolders, ", "))
+		if c.Corrupt {
+			fmt.Println("\tWARNING: the contract's data is corrupt")
+		}
+	}
+}
+
+func hostfinancialscmd() {
+	var fin api.HostFinancialsGET
+	err := getAPI("/host/financials", &fin)
+	if err != nil {
+		fmt.Println("Could not fetch financials:", err)
+		return
+	}
+	sc := func(c types.Currency) types.Currency { return c.Div(types.SiacoinPrecision) }
+	fmt.Printf(`Unresolved contracts:
+	Storage Revenue:   %v SC
+	Bandwidth Revenue: %v SC
+	Locked Collateral: %v SC
+`, sc(fin.PotentialStorageRevenue), sc(fin.PotentialBandwidthRevenue), sc(fin.LockedCollateral))
+	for _, p := range fin.Periods {
+		fmt.Printf(`Blocks %v - %v:
+	Storage Revenue:   %v SC
+	Bandwidth Revenue: %v SC
+	Lost Revenue:      %v SC
+	Lost Collateral:   %v SC
+	Proof Fees:        %v SC
+`, p.StartHeight, p.EndHeight, sc(p.StorageRevenue), sc(p.BandwidthRevenue), sc(p.LostRevenue), sc(p.LostCollateral), sc(p.ProofFees))
+	}
+}
+
+func hostmaintenancecmd(mode string) {
+	var maintenance bool
+	switch mode {
+	case "on":
+		maintenance = true
+	case "off":
+		maintenance = false
+	default:
+		fmt.Println("Maintenance mode must be 'on' or 'off'")
+		return
+	}
+	err := post("/host", fmt.Sprintf("maintenance=%v", maintenance))
+	if err != nil {
+		fmt.Println("Could not set maintenance mode:", err)
+		return
+	}
+	if maintenance {
+		fmt.Println("Host is in maintenance mode and will reject new contracts.")
+	} else {
+		fmt.Println("Host is accepting new contracts.")
+	}
+}
+
+// scPerGBPerMonth converts a price in hastings per byte per block to SC per GB
+// per month.
+func scPerGBPerMonth(price types.Currency) string {
+	r := new(big.Rat).SetInt(price.Big())
+	r.Mul(r, big.NewRat(4320, 1e24/1e9))
+	return r.FloatString(3)
+}
+
+// hastingsPerBytePerBlock converts a price in SC per GB per month to hastings
+// per byte per block.
+func hastingsPerBytePerBlock(price string) (string, error) {
+	p, ok := new(big.Rat).SetString(price)
+	if !ok {
+		return "", fmt.Errorf("could not parse price %q", price)
+	}
+	p.Mul(p, big.NewRat(1e24/1e9, 4320))
+	return new(big.Int).Div(p.Num(), p.Denom()).String(), nil
+}
+
+func hostpricingcmd() {
+	var hpg api.HostPricingGET
+	err := getAPI("/host/pricing", &hpg)
+	if err != nil {
+		fmt.Println("Could not fetch pricing policy:", err)
+		return
+	}
+	if !hpg.Enabled {
+		fmt.Printf("Automatic pricing is disabled.\nPrice: %v SC per GB per month\n", scPerGBPerMonth(hpg.Price))
+		return
+	}
+	fmt.Printf(`Automatic pricing is enabled.
+Price:         %v SC per GB per month
+Minimum Price: %v SC per GB per month
+Maximum Price: %v SC per GB per month
+`, scPerGBPerMonth(hpg.Price), scPerGBPerMonth(hpg.MinPrice), scPerGBPerMonth(hpg.MaxPrice))
+}
+
+func hostpricingenablecmd(minPrice, maxPrice string) {
+	min, err := hastingsPerBytePerBlock(minPrice)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	max, err := hastingsPerBytePerBlock(maxPrice)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = post("/host/pricing", "enabled=true&minprice="+min+"&maxprice="+max)
+	if err != nil {
+		fmt.Println("Could not enable automatic pricing:", err)
+		return
+	}
+	fmt.Println("Automatic pricing enabled.")
+}
+
+func hostpricingdisablecmd() {
+	err := post("/host/pricing", "enabled=false")
+	if err != nil {
+		fmt.Println("Could not disable automatic pricing:", err)
+		return
+	}
+	fmt.Println("Automatic pricing disabled.")
+}
+
+func hostscrubcmd() {
+	var status api.HostScrubGET
+	err := getAPI("/host/scrub", &status)
+	if err != nil {
+		fmt.Println("Could not fetch scrub status:", err)
+		return
+	}
+	if status.Scrubbing {
+		fmt.Println("A scrub is in progress.")
+	}
+	if status.LastScrub.IsZero() {
+		fmt.Println("The host has not finished a scrub.")
+		return
+	}
+	fmt.Println("Last scrub finished at", status.LastScrub.Format(time.RFC822))
+	if len(status.CorruptContracts) == 0 {
+		fmt.Println("No corrupt contracts.")
+		return
+	}
+	fmt.Println("Corrupt contracts:")
+	for _, c := range status.CorruptContracts {
+		fmt.Printf("%v\n\t%v\n", c.ID, c.Error)
+	}
+}
+
+func hostscrubstartcmd() {
+	err := post("/host/scrub", "")
+	if err != nil {
+		fmt.Println("Could not start scrub:", err)
+		return
+	}
+	fmt.Println("Started scrub. Run 'siac host scrub' to view the results.")
+}
+
+func hostfoldercmd() {
+	var storage api.HostStorageGET
+	err := getAPI("/host/storage", &storage)
+	if err != nil {
+		fmt.Println("Could not fetch storage folders:", err)
+		return
+	}
+	fmt.Println("Capacity     Remaining    Sectors    Path")
+	for _, folder := range storage.Folders {
+		fmt.Printf("%-12v %-12v %-10v %v\n", filesizeUnits(folder.Capacity), filesizeUnits(folder.CapacityRemaining), folder.Sectors, folder.Path)
+	}
+}
+
+func hostfolderaddcmd(path, size string) {
+	size, err := parseSize(size)
+	if err != nil {
+		fmt.Println("Could not parse size:", err)
+		return
+	}
+	// The daemon may run in a different directory.
+	path, err = filepath.Abs(path)
+	if err != nil {
+		fmt.Println("Could not resolve path:", err)
+		return
+	}
+	err = post("/host/storage/folders/add", "path="+url.QueryEscape(path)+"&size="+size)
+	if err != nil {
+		fmt.Println("Could not add storage folder:", err)
+		return
+	}
+	fmt.Println("Added storage folder", path)
+}
+
+func hostfolderremovecmd(path string) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		fmt.Println("Could not resolve path:", err)
+		return
+	}
+	err = post("/host/storage/folders/remove", "path="+url.QueryEscape(path))
+	if err != nil {
+		fmt.Println("Could not remove storage folder:", err)
+		return
+	}
+	fmt.Println("Removed storage folder", path)
+}
+
+func hostfolderresizecmd(path, size string) {
+	size, err := parseSize(size)
+	if err != nil {
+		fmt.Println("Could not parse size:", err)
+		return
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		fmt.Println("Could not resolve path:", err)
+		return
+	}
+	err = post("/host/storage/folders/resize", "path="+url.QueryEscape(path)+"&newsize="+size)
+	if err != nil {
+		fmt.Println("Could not resize storage folder:", err)
+		return
+	}
+	fmt.Println("Resized storage folder", path)
 }
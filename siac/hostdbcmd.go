@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/NebulousLabs/Sia/api"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -16,6 +18,108 @@ var (
 		Long:  "List active hosts on the network",
 		Run:   wrap(hostdbhostscmd),
 	}
+
+	hostdbListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List known hosts",
+		Long:  "List the hosts known to the hostdb, sorted by score or price.",
+		Run:   wrap(hostdblistcmd),
+	}
+
+	hostdbViewCmd = &cobra.Command{
+		Use:   "view [address]",
+		Short: "View a host in detail",
+		Long:  "View the score, reliability, scan history, and contracts of a host.",
+		Run:   wrap(hostdbviewcmd),
+	}
+
+	hostdbRescanCmd = &cobra.Command{
+		Use:   "rescan [address]",
+		Short: "Scan a host immediately",
+		Long:  "Scan a host immediately instead of waiting for the next round of scanning.",
+		Run:   wrap(hostdbrescancmd),
+	}
+
+	hostdbScoreCmd = &cobra.Command{
+		Use:   "score [address]",
+		Short: "Explain the score of a host",
+		Long:  "Show the factors that make up the score of a host, which determines how likely it is to be selected for uploads.",
+		Run:   wrap(hostdbscorecmd),
+	}
+
+	hostdbDiversityCmd = &cobra.Command{
+		Use:   "diversity",
+		Short: "View the subnet diversity setting",
+		Long:  "View the subnet sizes used to keep the hosts of a chunk on different networks.",
+		Run:   wrap(hostdbdiversitycmd),
+	}
+
+	hostdbDiversitySetCmd = &cobra.Command{
+		Use:   "set [ipv4 bits] [ipv6 bits]",
+		Short: "Change the subnet diversity setting",
+		Long: `Change the prefix lengths of the subnets within which at most one host is
+selected for each chunk. A prefix length of 0 disables the restriction.`,
+		Run: wrap(hostdbdiversitysetcmd),
+	}
+
+	hostdbMarketCmd = &cobra.Command{
+		Use:   "market",
+		Short: "View host market statistics",
+		Long:  "View the distribution of prices and collateral offered by the active hosts, along with their total storage and versions.",
+		Run:   wrap(hostdbmarketcmd),
+	}
+
+	hostdbScanPolicyCmd = &cobra.Command{
+		Use:   "scanpolicy",
+		Short: "View the host scan policy",
+		Long:  "View how often and how aggressively the hostdb scans hosts.",
+		Run:   wrap(hostdbscanpolicycmd),
+	}
+
+	hostdbScanPolicySetCmd = &cobra.Command{
+		Use:   "set [setting] [value]",
+		Short: "Change the host scan policy",
+		Long: `Change a setting of the host scan policy.
+Available settings:
+	minscaninterval (e.g. 1h)
+	maxscaninterval (e.g. 4h)
+	scanthreads
+	requesttimeout (e.g. 5s)
+	maxactivehosts
+	inactivehostcheckups
+	maxscanbackoff (e.g. 48h, 0 to disable)
+	maxreliability
+	unreachablepenalty`,
+		Run: wrap(hostdbscanpolicysetcmd),
+	}
+
+	hostdbFilterCmd = &cobra.Command{
+		Use:   "filter",
+		Short: "View the host filter",
+		Long:  "View the blacklist or whitelist that restricts which hosts are used for uploads.",
+		Run:   wrap(hostdbfiltercmd),
+	}
+
+	hostdbFilterBlacklistCmd = &cobra.Command{
+		Use:   "blacklist [host] [host]...",
+		Short: "Never upload to the given hosts",
+		Long:  "Replace the host filter with a blacklist of the given hosts.",
+		Run:   hostdbfiltersetcmd("blacklist"),
+	}
+
+	hostdbFilterWhitelistCmd = &cobra.Command{
+		Use:   "whitelist [host] [host]...",
+		Short: "Only upload to the given hosts",
+		Long:  "Replace the host filter with a whitelist of the given hosts.",
+		Run:   hostdbfiltersetcmd("whitelist"),
+	}
+
+	hostdbFilterDisableCmd = &cobra.Command{
+		Use:   "disable",
+		Short: "Disable the host filter",
+		Long:  "Clear the host filter, allowing uploads to any host.",
+		Run:   wrap(hostdbfilterdisablecmd),
+	}
 )
 
 func hostdbhostscmd() {
@@ -34,3 +138,225 @@ func hostdbhostscmd() {
 		fmt.Printf("\t%v - %v SC / GB / Mo\n", host.IPAddress, host.Price.Mul(types.NewCurrency64(4320e9)).Div(types.SiacoinPrecision))
 	}
 }
+
+func hostdbdiversitycmd() {
+	var hd modules.HostDiversity
+	err := getAPI("/hostdb/diversity", &hd)
+	if err != nil {
+		fmt.Println("Could not fetch host diversity:", err)
+		return
+	}
+	fmt.Printf(`IPv4 subnet: /%v
+IPv6 subnet: /%v
+`, hd.IPv4SubnetBits, hd.IPv6SubnetBits)
+}
+
+func hostdbdiversitysetcmd(ipv4Bits, ipv6Bits string) {
+	err := post("/hostdb/diversity", fmt.Sprintf("ipv4subnetbits=%s&ipv6subnetbits=%s", ipv4Bits, ipv6Bits))
+	if err != nil {
+		fmt.Println("Could not set host diversity:", err)
+		return
+	}
+	fmt.Println("Host diversity updated.")
+}
+
+func hostdbmarketcmd() {
+	var market modules.HostMarket
+	err := getAPI("/hostdb/market", &market)
+	if err != nil {
+		fmt.Println("Could not fetch host market:", err)
+		return
+	}
+	// convert from hastings/byte/block to SC/GB/month
+	perGBMonth := func(c types.Currency) types.Currency {
+		return c.Mul(types.NewCurrency64(4320e9)).Div(types.SiacoinPrecision)
+	}
+	cur := market.Current
+	fmt.Printf("Active hosts:  %v (at height %v)\n", cur.Hosts, cur.Height)
+	fmt.Printf("Total storage: %v\n", filesizeUnits(cur.TotalStorage))
+	fmt.Println("Percentile  Price (SC / GB / Mo)  Collateral (SC / GB / Mo)")
+	rows := []struct {
+		name              string
+		price, collateral types.Currency
+	}{
+		{"10th", cur.Price.P10, cur.Collateral.P10},
+		{"25th", cur.Price.P25, cur.Collateral.P25},
+		{"median", cur.Price.P50, cur.Collateral.P50},
+		{"75th", cur.Price.P75, cur.Collateral.P75},
+		{"90th", cur.Price.P90, cur.Collateral.P90},
+	}
+	for _, row := range rows {
+		fmt.Printf("%-10v  %-20v  %v\n", row.name, perGBMonth(row.price), perGBMonth(row.collateral))
+	}
+	fmt.Println("Versions:")
+	for version, n := range cur.Versions {
+		fmt.Printf("\t%v: %v\n", version, n)
+	}
+	if len(market.History) > 0 {
+		fmt.Println("History:")
+		fmt.Println("Height  Hosts  Median Price (SC / GB / Mo)")
+		for _, stats := range market.History {
+			fmt.Printf("%-6v  %-5v  %v\n", stats.Height, stats.Hosts, perGBMonth(stats.Price.P50))
+		}
+	}
+}
+
+func hostdbscanpolicycmd() {
+	var sp modules.HostScanPolicy
+	err := getAPI("/hostdb/scanpolicy", &sp)
+	if err != nil {
+		fmt.Println("Could not fetch scan policy:", err)
+		return
+	}
+	fmt.Printf(`Scan interval:          %v - %v
+Scan threads:           %v
+Request timeout:        %v
+Max active hosts:       %v
+Inactive host checkups: %v
+Max scan backoff:       %v
+Max reliability:        %v
+Unreachable penalty:    %v
+`, sp.MinScanInterval, sp.MaxScanInterval, sp.ScanThreads, sp.RequestTimeout,
+		sp.MaxActiveHosts, sp.InactiveHostCheckups, sp.MaxScanBackoff,
+		sp.MaxReliability, sp.UnreachablePenalty)
+}
+
+func hostdbscanpolicysetcmd(param, value string) {
+	err := post("/hostdb/scanpolicy", param+"="+value)
+	if err != nil {
+		fmt.Println("Could not update scan policy:", err)
+		return
+	}
+	fmt.Println("Scan policy updated.")
+}
+
+func hostdbfiltercmd() {
+	var hf api.HostdbFilterGET
+	err := getAPI("/hostdb/filter", &hf)
+	if err != nil {
+		fmt.Println("Could not fetch host filter:", err)
+		return
+	}
+	if hf.Mode == "disable" {
+		fmt.Println("Host filter is disabled.")
+		return
+	}
+	fmt.Printf("Host %v (%v hosts):\n", hf.Mode, len(hf.Hosts))
+	for _, host := range hf.Hosts {
+		fmt.Printf("\t%v\n", host)
+	}
+}
+
+// hostdbfiltersetcmd returns a command that replaces the host filter with the
+// given mode and the hosts supplied as arguments.
+func hostdbfiltersetcmd(mode string) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, hosts []string) {
+		if len(hosts) == 0 {
+			cmd.Usage()
+			return
+		}
+		err := post("/hostdb/filter", fmt.Sprintf("mode=%s&hosts=%s", mode, strings.Join(hosts, ",")))
+		if err != nil {
+			fmt.Println("Could not set host filter:", err)
+			return
+		}
+		fmt.Printf("Host %v set to %v hosts.\n", mode, len(hosts))
+	}
+}
+
+func hostdbfilterdisablecmd() {
+	err := post("/hostdb/filter", "mode=disable")
+	if err != nil {
+		fmt.Println("Could not disable host filter:", err)
+		return
+	}
+	fmt.Println("Host filter disabled.")
+}
+
+func hostdbscorecmd(address string) {
+	var sb modules.HostScoreBreakdown
+	err := getAPI("/hostdb/score?address="+address, &sb)
+	if err != nil {
+		fmt.Println("Could not fetch host score:", err)
+		return
+	}
+	fmt.Println("Score:", sb.Score)
+	for _, c := range sb.Components {
+		fmt.Printf("\t%-12s %g\n", c.Name, c.Multiplier)
+	}
+}
+
+func hostdblistcmd() {
+	var hosts api.HostdbHostsGET
+	call := fmt.Sprintf("/hostdb/hosts?sort=%s&active=%v&limit=%d", hostdbSort, hostdbActiveOnly, hostdbLimit)
+	if hostdbMinScore != "" {
+		call += "&minscore=" + hostdbMinScore
+	}
+	err := getAPI(call, &hosts)
+	if err != nil {
+		fmt.Println("Could not fetch host list:", err)
+		return
+	}
+	if len(hosts.Hosts) == 0 {
+		fmt.Println("No known hosts")
+		return
+	}
+	fmt.Println("Address                    Active  Uptime  Price (SC / GB / Mo)")
+	for _, host := range hosts.Hosts {
+		fmt.Printf("%-26v %-7v %5.1f%%  %v\n", host.IPAddress, host.Active, 100*host.Uptime, host.Price.Mul(types.NewCurrency64(4320e9)).Div(types.SiacoinPrecision))
+	}
+}
+
+func hostdbviewcmd(address string) {
+	var host modules.HostDBEntry
+	err := getAPI("/hostdb/host?address="+address, &host)
+	if err != nil {
+		fmt.Println("Could not fetch host:", err)
+		return
+	}
+	fmt.Printf(`Host %v:
+	Active:       %v
+	Price:        %v SC / GB / Mo
+	Collateral:   %v SC / GB / Mo
+	Storage:      %v bytes
+	Remaining:    %v bytes
+	Max Duration: %v blocks
+	First Seen:   block %v
+	Reliability:  %v
+	Uptime:       %.1f%%
+	Failure Rate: %.1f%%
+	Score:        %v
+`, host.IPAddress, host.Active, host.Price.Mul(types.NewCurrency64(4320e9)).Div(types.SiacoinPrecision),
+		host.Collateral.Mul(types.NewCurrency64(4320e9)).Div(types.SiacoinPrecision), host.TotalStorage,
+		host.RemainingStorage, host.MaxDuration, host.FirstSeen, host.Reliability, 100*host.Uptime, 100*host.FailureRate, host.Score.Score)
+	for _, c := range host.Score.Components {
+		fmt.Printf("\t\t%-12s %g\n", c.Name, c.Multiplier)
+	}
+
+	fmt.Println("\nContracts:")
+	for _, c := range host.Contracts {
+		status := c.ProofStatus
+		if status == "" {
+			status = "pending"
+		}
+		fmt.Printf("\t%v  %v bytes, ends at block %v (%v)\n", c.ID, c.FileSize, c.WindowEnd, status)
+	}
+
+	fmt.Println("\nHistory:")
+	for _, hi := range host.History {
+		result := "ok"
+		if !hi.Success {
+			result = "failed"
+		}
+		fmt.Printf("\t%v  %-8s %v\n", hi.Timestamp.Format("Jan 02 15:04:05"), hi.Type, result)
+	}
+}
+
+func hostdbrescancmd(address string) {
+	err := post("/hostdb/host/rescan", "address="+address)
+	if err != nil {
+		fmt.Println("Could not rescan host:", err)
+		return
+	}
+	fmt.Println("Scanning", address)
+}
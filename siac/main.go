@@ -17,8 +17,17 @@ import (
 )
 
 var (
-	addr         string
-	initPassword bool
+	addr             string
+	initPassword     bool
+	uploadCipher     string
+	uploadCode       string
+	uploadData       int
+	uploadParity     int
+	downloadVersion  string
+	hostdbSort       string
+	hostdbActiveOnly bool
+	hostdbLimit      int
+	hostdbMinScore   string
 )
 
 // apiGet wraps a GET request with a status code check, such that if the GET does
@@ -163,9 +172,21 @@ func main() {
 	})
 
 	root.AddCommand(hostCmd)
-	hostCmd.AddCommand(hostConfigCmd, hostAnnounceCmd, hostStatusCmd)
+	hostCmd.AddCommand(hostConfigCmd, hostAnnounceCmd, hostConnectionsCmd, hostContractsCmd, hostFinancialsCmd, hostFolderCmd, hostMaintenanceCmd, hostPricingCmd, hostScrubCmd, hostStatusCmd)
+	hostConnectionsCmd.AddCommand(hostConnectionsSetCmd)
+	hostFolderCmd.AddCommand(hostFolderAddCmd, hostFolderRemoveCmd, hostFolderResizeCmd)
+	hostPricingCmd.AddCommand(hostPricingEnableCmd, hostPricingDisableCmd)
+	hostScrubCmd.AddCommand(hostScrubStartCmd)
 
 	root.AddCommand(hostdbCmd)
+	hostdbCmd.AddCommand(hostdbDiversityCmd, hostdbFilterCmd, hostdbListCmd, hostdbMarketCmd, hostdbRescanCmd, hostdbScanPolicyCmd, hostdbScoreCmd, hostdbViewCmd)
+	hostdbListCmd.Flags().StringVarP(&hostdbSort, "sort", "s", "score", "Sort hosts by score or price")
+	hostdbListCmd.Flags().BoolVarP(&hostdbActiveOnly, "active", "a", false, "Only list active hosts")
+	hostdbListCmd.Flags().IntVarP(&hostdbLimit, "limit", "n", 0, "Maximum number of hosts to list")
+	hostdbListCmd.Flags().StringVarP(&hostdbMinScore, "minscore", "m", "", "Only list hosts with at least this score")
+	hostdbDiversityCmd.AddCommand(hostdbDiversitySetCmd)
+	hostdbScanPolicyCmd.AddCommand(hostdbScanPolicySetCmd)
+	hostdbFilterCmd.AddCommand(hostdbFilterBlacklistCmd, hostdbFilterWhitelistCmd, hostdbFilterDisableCmd)
 	hostCmd.AddCommand(hostdbCmd)
 
 	root.AddCommand(minerCmd)
@@ -182,7 +203,14 @@ func main() {
 	root.AddCommand(renterCmd)
 	renterCmd.AddCommand(renterDownloadQueueCmd, renterFilesDeleteCmd, renterFilesDownloadCmd,
 		renterFilesListCmd, renterFilesLoadCmd, renterFilesLoadASCIICmd, renterFilesRenameCmd,
-		renterFilesShareCmd, renterFilesShareASCIICmd, renterFilesUploadCmd)
+		renterFilesShareCmd, renterFilesShareASCIICmd, renterFilesUploadCmd, renterFilesVersionsCmd,
+		renterRetentionCmd)
+	renterRetentionCmd.AddCommand(renterRetentionSetCmd)
+	renterFilesUploadCmd.Flags().StringVarP(&uploadCipher, "cipher", "c", "", "Encryption scheme for the file's pieces (twofish or xchacha20)")
+	renterFilesUploadCmd.Flags().StringVarP(&uploadCode, "erasure-code", "e", "", "Erasure code for the file (reedsolomon, reedsolomon-subchunk, or replication)")
+	renterFilesUploadCmd.Flags().IntVarP(&uploadData, "data-pieces", "d", 0, "Number of data pieces per chunk (defaults to the erasure code's default)")
+	renterFilesUploadCmd.Flags().IntVarP(&uploadParity, "parity-pieces", "p", 0, "Number of parity pieces per chunk (defaults to the erasure code's default)")
+	renterFilesDownloadCmd.Flags().StringVarP(&downloadVersion, "version", "v", "", "Version of the file to download (defaults to the current version)")
 
 	root.AddCommand(gatewayCmd)
 	gatewayCmd.AddCommand(gatewayAddCmd, gatewayRemoveCmd, gatewayStatusCmd)
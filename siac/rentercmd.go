@@ -8,6 +8,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/NebulousLabs/Sia/api"
+	"github.com/NebulousLabs/Sia/modules"
 )
 
 // filesize returns a string that displays a filesize in human-readable units.
@@ -94,9 +95,32 @@ var (
 	renterFilesUploadCmd = &cobra.Command{
 		Use:   "upload [filename] [nickname]",
 		Short: "Upload a file",
-		Long:  "Upload a file using a given nickname.",
+		Long:  "Upload a file using a given nickname. Uploading to an existing nickname creates a new version of that file.",
 		Run:   wrap(renterfilesuploadcmd),
 	}
+
+	renterFilesVersionsCmd = &cobra.Command{
+		Use:   "versions [nickname]",
+		Short: "List the versions of a file",
+		Long:  "List every version of a file, from oldest to newest.",
+		Run:   wrap(renterfilesversionscmd),
+	}
+
+	renterRetentionCmd = &cobra.Command{
+		Use:   "retention",
+		Short: "View the version retention policy",
+		Long:  "View the policy used to prune prior versions of files.",
+		Run:   wrap(renterretentioncmd),
+	}
+
+	renterRetentionSetCmd = &cobra.Command{
+		Use:   "set [versions] [blocks]",
+		Short: "Change the version retention policy",
+		Long: `Change the policy used to prune prior versions of files.
+versions is the number of prior versions to keep, and blocks is the number of
+blocks to keep a version after it is replaced. 0 means no limit.`,
+		Run: wrap(renterretentionsetcmd),
+	}
 )
 
 // abs returns the absolute representation of a path.
@@ -137,7 +161,7 @@ func renterfilesdeletecmd(nickname string) {
 }
 
 func renterfilesdownloadcmd(nickname, destination string) {
-	err := post("/renter/files/download", fmt.Sprintf("nickname=%s&destination=%s", nickname, abs(destination)))
+	err := post("/renter/files/download", fmt.Sprintf("nickname=%s&destination=%s&version=%s", nickname, abs(destination), downloadVersion))
 	if err != nil {
 		fmt.Println("Could not download file:", err)
 		return
@@ -222,10 +246,52 @@ func renterfilesshareasciicmd(nickname string) {
 }
 
 func renterfilesuploadcmd(source, nickname string) {
-	err := post("/renter/files/upload", fmt.Sprintf("source=%s&nickname=%s", abs(source), nickname))
+	err := post("/renter/files/upload", fmt.Sprintf("source=%s&nickname=%s&cipher=%s&erasurecode=%s&datapieces=%d&paritypieces=%d",
+		abs(source), nickname, uploadCipher, uploadCode, uploadData, uploadParity))
 	if err != nil {
 		fmt.Println("Could not upload file:", err)
 		return
 	}
 	fmt.Printf("Uploaded '%s' as %s.\n", abs(source), nickname)
 }
+
+func renterfilesversionscmd(nickname string) {
+	var resp api.RenterFilesVersionsResponse
+	err := getAPI("/renter/files/versions?nickname="+nickname, &resp)
+	if err != nil {
+		fmt.Println("Could not get file versions:", err)
+		return
+	}
+	fmt.Println(len(resp.Versions), "versions of", nickname+":")
+	for _, v := range resp.Versions {
+		status := fmt.Sprintf("replaced at height %d", v.ReplacedHeight)
+		if v.Current {
+			status = "current"
+		}
+		if !v.Available {
+			status += fmt.Sprintf(", uploading, %0.2f%%", v.UploadProgress)
+		}
+		fmt.Printf("%5d  %13s  (%s)\n", v.Version, filesizeUnits(int64(v.Filesize)), status)
+	}
+}
+
+func renterretentioncmd() {
+	var rp modules.RetentionPolicy
+	err := getAPI("/renter/retention", &rp)
+	if err != nil {
+		fmt.Println("Could not get retention policy:", err)
+		return
+	}
+	fmt.Printf(`Versions kept: %v
+Blocks kept:   %v
+`, rp.Versions, rp.Blocks)
+}
+
+func renterretentionsetcmd(versions, blocks string) {
+	err := post("/renter/retention", fmt.Sprintf("versions=%s&blocks=%s", versions, blocks))
+	if err != nil {
+		fmt.Println("Could not set retention policy:", err)
+		return
+	}
+	fmt.Println("Retention policy updated.")
+}